@@ -3,14 +3,13 @@ package cmd
 import (
 	"github.com/calebschoepp/playlist-rotator/pkg/build"
 	"github.com/calebschoepp/playlist-rotator/pkg/config"
+	"github.com/calebschoepp/playlist-rotator/pkg/events"
 	"github.com/calebschoepp/playlist-rotator/pkg/motify"
+	"github.com/calebschoepp/playlist-rotator/pkg/notify"
 	"github.com/calebschoepp/playlist-rotator/pkg/store"
 	"github.com/jmoiron/sqlx"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
-
-	// This driver here is okay because test cmd is ran seperate from serve cmd
-	_ "github.com/lib/pq"
 )
 
 func init() {
@@ -19,7 +18,7 @@ func init() {
 
 var buildCmd = &cobra.Command{
 	Use:   "build",
-	Short: "Build any scheduled playlists with deadlines that have passed",
+	Short: "Build any scheduled playlists with deadlines that have passed and send failure digests",
 	Run: func(cmd *cobra.Command, args []string) {
 		// Setup log
 		logger, _ := zap.NewDevelopment()
@@ -33,20 +32,33 @@ var buildCmd = &cobra.Command{
 
 		// Setup DB
 		var db *sqlx.DB
-		db, err = sqlx.Open("postgres", conf.DatabaseURL)
+		db, err = store.Open(conf.DatabaseURL)
 		if err != nil {
 			sugarLogger.Fatalw("failed to setup db", "err", err)
 		}
 
+		// Make sure the schema is what this binary expects
+		checkSchema(db, sugarLogger, false)
+
 		// Setup store
 		store := store.New(db)
 
 		// Setup spotify auth
 		spotify := motify.New("", conf.ClientID, conf.ClientSecret)
 
+		// Setup event broker
+		broker := events.New(db, sugarLogger)
+
+		// Setup failure notifications
+		notifier := notify.New(store, notify.NewMailer(conf), sugarLogger)
+
 		// Setup build service
-		buildService := build.New(store, spotify, sugarLogger)
+		buildService := build.New(store, spotify, broker, notifier, sugarLogger, conf)
+
+		ctx := shutdownContext()
+		buildService.BuildScheduledPlaylists(ctx)
 
-		buildService.BuildScheduledPlaylists()
+		// Send out digests of any failures, including the ones just now
+		notifier.SendDigests(ctx)
 	},
 }
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/calebschoepp/playlist-rotator/migrations"
+	"github.com/calebschoepp/playlist-rotator/pkg/config"
+	"github.com/calebschoepp/playlist-rotator/pkg/migrate"
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func init() {
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateStatusCmd, migrateToCmd)
+	rootCmd.AddCommand(migrateCmd)
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply or roll back the database migrations built into the binary",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cmd.Help(); err != nil {
+			log.Fatalf("cmd: failed to get help: %v", err)
+		}
+	},
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply every pending migration",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		migrator, sugarLogger := newMigrator()
+		err := migrator.Up(shutdownContext())
+		if err != nil {
+			sugarLogger.Fatalw("failed to migrate up", "err", err)
+		}
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down [steps]",
+	Short: "Roll back the last migration, or the last few",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		migrator, sugarLogger := newMigrator()
+		steps := 1
+		if len(args) == 1 {
+			var err error
+			steps, err = strconv.Atoi(args[0])
+			if err != nil || steps < 1 {
+				sugarLogger.Fatalw("steps must be a positive number", "steps", args[0])
+			}
+		}
+		err := migrator.Down(shutdownContext(), steps)
+		if err != nil {
+			sugarLogger.Fatalw("failed to migrate down", "err", err)
+		}
+	},
+}
+
+var migrateToCmd = &cobra.Command{
+	Use:   "to <version>",
+	Short: "Migrate up or down to a version, 0 rolling back everything",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		migrator, sugarLogger := newMigrator()
+		version, err := strconv.Atoi(args[0])
+		if err != nil || version < 0 {
+			sugarLogger.Fatalw("version must be a number", "version", args[0])
+		}
+		err = migrator.To(shutdownContext(), version)
+		if err != nil {
+			sugarLogger.Fatalw("failed to migrate", "err", err, "version", version)
+		}
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the schema's version and the migrations left to apply",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		migrator, sugarLogger := newMigrator()
+		status, err := migrator.Status(shutdownContext())
+		if err != nil {
+			sugarLogger.Fatalw("failed to get migration status", "err", err)
+		}
+
+		fmt.Printf("Schema version: %d of %d\n", status.Current, status.Latest)
+		if status.Dirty {
+			fmt.Println("The schema is dirty, a migration failed partway and needs fixing by hand")
+		}
+		if len(status.Pending) == 0 {
+			fmt.Println("No pending migrations")
+		}
+		for _, m := range status.Pending {
+			fmt.Printf("Pending: %03d_%s\n", m.Version, m.Name)
+		}
+	},
+}
+
+// checkSchema exits unless the database schema is at the version this binary expects, first
+// applying any pending migrations if autoMigrate is set. Every command that opens the store
+// runs it so none of them fail halfway through on a missing table or column.
+func checkSchema(db *sqlx.DB, log *zap.SugaredLogger, autoMigrate bool) {
+	migrator, err := migrate.New(db, migrations.For(db.DriverName()), log)
+	if err != nil {
+		log.Fatalw("failed to load migrations", "err", err)
+	}
+	status, err := migrator.Status(context.Background())
+	if err != nil {
+		log.Fatalw("failed to get migration status", "err", err)
+	}
+	if status.Dirty {
+		log.Fatalw("database schema is dirty, fix it by hand before starting", "version", status.Current)
+	} else if status.Behind() && autoMigrate {
+		err = migrator.Up(context.Background())
+		if err != nil {
+			log.Fatalw("failed to migrate database", "err", err)
+		}
+	} else if status.Behind() {
+		log.Fatalw("database schema is behind, run the migrate up command or serve with --migrate", "version", status.Current, "latest", status.Latest)
+	}
+}
+
+// newMigrator sets up a migrator for the configured database along with a logger for the command
+func newMigrator() (*migrate.Migrator, *zap.SugaredLogger) {
+	// Setup log
+	logger, _ := zap.NewDevelopment()
+	sugarLogger := logger.Sugar()
+
+	// Setup config
+	conf, err := config.New()
+	if err != nil {
+		sugarLogger.Fatalw("failed to build config", "err", err)
+	}
+
+	// Setup DB
+	db, err := store.Open(conf.DatabaseURL)
+	if err != nil {
+		sugarLogger.Fatalw("failed to setup db", "err", err)
+	}
+
+	migrator, err := migrate.New(db, migrations.For(db.DriverName()), sugarLogger)
+	if err != nil {
+		sugarLogger.Fatalw("failed to load migrations", "err", err)
+	}
+	return migrator, sugarLogger
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"github.com/calebschoepp/playlist-rotator/pkg/build"
+	"github.com/calebschoepp/playlist-rotator/pkg/config"
+	"github.com/calebschoepp/playlist-rotator/pkg/events"
+	"github.com/calebschoepp/playlist-rotator/pkg/motify"
+	"github.com/calebschoepp/playlist-rotator/pkg/notify"
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func init() {
+	rootCmd.AddCommand(schedulerCmd)
+}
+
+var schedulerCmd = &cobra.Command{
+	Use:   "scheduler",
+	Short: "Build scheduled playlists as they come due and send failure digests",
+	Run: func(cmd *cobra.Command, args []string) {
+		// Setup log
+		logger, _ := zap.NewDevelopment()
+		sugarLogger := logger.Sugar()
+
+		// Setup config
+		conf, err := config.New()
+		if err != nil {
+			sugarLogger.Fatalw("failed to build config", "err", err)
+		}
+
+		// Setup DB
+		var db *sqlx.DB
+		db, err = store.Open(conf.DatabaseURL)
+		if err != nil {
+			sugarLogger.Fatalw("failed to setup db", "err", err)
+		}
+
+		// Make sure the schema is what this binary expects
+		checkSchema(db, sugarLogger, false)
+
+		// Setup store
+		store := store.New(db)
+
+		// Setup spotify auth
+		spotify := motify.New("", conf.ClientID, conf.ClientSecret)
+
+		// Setup event broker
+		broker := events.New(db, sugarLogger)
+
+		// Setup failure notifications
+		notifier := notify.New(store, notify.NewMailer(conf), sugarLogger)
+
+		// Setup build service
+		buildService := build.New(store, spotify, broker, notifier, sugarLogger, conf)
+
+		buildService.RunScheduler(shutdownContext(), conf.DatabaseURL)
+	},
+}
@@ -3,14 +3,23 @@ package cmd
 import (
 	"github.com/calebschoepp/playlist-rotator/pkg/config"
 	"github.com/calebschoepp/playlist-rotator/pkg/server"
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+	"github.com/calebschoepp/playlist-rotator/pkg/webhook"
+	"github.com/calebschoepp/playlist-rotator/pkg/worker"
 	"github.com/gorilla/mux"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
 
+var withWorker bool
+var withScheduler bool
+var autoMigrate bool
+
 func init() {
+	serveCmd.Flags().BoolVar(&withWorker, "with-worker", false, "also process queued jobs in this process")
+	serveCmd.Flags().BoolVar(&withScheduler, "with-scheduler", false, "also build scheduled playlists in this process")
+	serveCmd.Flags().BoolVar(&autoMigrate, "migrate", false, "apply pending database migrations before serving instead of refusing to start")
 	rootCmd.AddCommand(serveCmd)
 }
 
@@ -30,11 +39,14 @@ var serveCmd = &cobra.Command{
 
 		// Setup DB
 		var db *sqlx.DB
-		db, err = sqlx.Open("postgres", conf.DatabaseURL)
+		db, err = store.Open(conf.DatabaseURL)
 		if err != nil {
 			sugarLogger.Fatalw("failed to setup db", "err", err)
 		}
 
+		// Make sure the schema is what this binary expects
+		checkSchema(db, sugarLogger, autoMigrate)
+
 		// Setup router
 		router := mux.NewRouter()
 
@@ -45,7 +57,33 @@ var serveCmd = &cobra.Command{
 		}
 		server.SetupRoutes()
 
+		ctx := shutdownContext()
+
+		// Optionally process jobs alongside the server, handy for local development
+		workerDone := make(chan struct{})
+		if withWorker {
+			go func() {
+				worker.New(server.Store, server.Builder, webhook.New(server.Store, sugarLogger), sugarLogger, conf).Run(ctx)
+				close(workerDone)
+			}()
+		} else {
+			close(workerDone)
+		}
+
+		// Optionally build scheduled playlists alongside the server too
+		schedulerDone := make(chan struct{})
+		if withScheduler {
+			go func() {
+				server.Builder.RunScheduler(ctx, conf.DatabaseURL)
+				close(schedulerDone)
+			}()
+		} else {
+			close(schedulerDone)
+		}
+
 		// Start serving requests
-		server.Run()
+		server.Run(ctx)
+		<-workerDone
+		<-schedulerDone
 	},
 }
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"github.com/calebschoepp/playlist-rotator/pkg/build"
+	"github.com/calebschoepp/playlist-rotator/pkg/config"
+	"github.com/calebschoepp/playlist-rotator/pkg/events"
+	"github.com/calebschoepp/playlist-rotator/pkg/motify"
+	"github.com/calebschoepp/playlist-rotator/pkg/notify"
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+	"github.com/calebschoepp/playlist-rotator/pkg/webhook"
+	"github.com/calebschoepp/playlist-rotator/pkg/worker"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func init() {
+	rootCmd.AddCommand(workerCmd)
+}
+
+var workerCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "Process queued playlist builds, deletes and webhook deliveries",
+	Run: func(cmd *cobra.Command, args []string) {
+		// Setup log
+		logger, _ := zap.NewDevelopment()
+		sugarLogger := logger.Sugar()
+
+		// Setup config
+		conf, err := config.New()
+		if err != nil {
+			sugarLogger.Fatalw("failed to build config", "err", err)
+		}
+
+		// Setup DB
+		var db *sqlx.DB
+		db, err = store.Open(conf.DatabaseURL)
+		if err != nil {
+			sugarLogger.Fatalw("failed to setup db", "err", err)
+		}
+
+		// Make sure the schema is what this binary expects
+		checkSchema(db, sugarLogger, false)
+
+		// Setup store
+		store := store.New(db)
+
+		// Setup spotify auth
+		spotify := motify.New("", conf.ClientID, conf.ClientSecret)
+
+		// Setup event broker
+		broker := events.New(db, sugarLogger)
+
+		// Setup failure notifications
+		notifier := notify.New(store, notify.NewMailer(conf), sugarLogger)
+
+		// Setup build service
+		buildService := build.New(store, spotify, broker, notifier, sugarLogger, conf)
+
+		// Setup webhook deliverer
+		deliverer := webhook.New(store, sugarLogger)
+
+		// Process jobs
+		worker.New(store, buildService, deliverer, sugarLogger, conf).Run(shutdownContext())
+	},
+}
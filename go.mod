@@ -1,6 +1,6 @@
 module github.com/calebschoepp/playlist-rotator
 
-go 1.13
+go 1.16
 
 require (
 	github.com/Shaked/gomobiledetect v0.0.0-20171211181707-25f014f66568
@@ -10,6 +10,7 @@ require (
 	github.com/gorilla/mux v1.7.4
 	github.com/jmoiron/sqlx v1.2.0
 	github.com/lib/pq v1.8.0
+	github.com/mattn/go-sqlite3 v1.14.15
 	github.com/spf13/cobra v1.0.0
 	github.com/zmb3/spotify v0.0.0-20200814173021-9bec46940cc0
 	go.uber.org/zap v1.15.0
@@ -17,4 +18,4 @@ require (
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
 )
 
-// +heroku goVersion go1.13
+// +heroku goVersion go1.16
@@ -0,0 +1,2 @@
+DROP TRIGGER update_time_source_tracks ON source_tracks;
+DROP TABLE source_tracks;
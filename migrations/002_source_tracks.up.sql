@@ -0,0 +1,13 @@
+CREATE TABLE source_tracks (
+  source_id   TEXT PRIMARY KEY,
+  snapshot_id TEXT NOT NULL,
+  tracks      JSONB NOT NULL,
+
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER update_time_source_tracks
+  BEFORE UPDATE
+  ON source_tracks
+  FOR EACH ROW EXECUTE PROCEDURE update_modified_column();
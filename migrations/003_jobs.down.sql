@@ -0,0 +1,2 @@
+DROP TRIGGER update_time_jobs ON jobs;
+DROP TABLE jobs;
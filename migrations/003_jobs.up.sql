@@ -0,0 +1,23 @@
+CREATE TABLE jobs (
+  id          UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  kind        VARCHAR(64) NOT NULL,
+  user_id     UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+  playlist_id UUID NOT NULL,
+
+  status       VARCHAR(64) NOT NULL DEFAULT 'Queued',
+  attempts     INTEGER NOT NULL DEFAULT 0,
+  max_attempts INTEGER NOT NULL DEFAULT 3,
+  last_error   TEXT,
+  run_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  locked_at    TIMESTAMPTZ,
+
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX jobs_claimable ON jobs (run_at) WHERE status IN ('Queued', 'Running');
+
+CREATE TRIGGER update_time_jobs
+  BEFORE UPDATE
+  ON jobs
+  FOR EACH ROW EXECUTE PROCEDURE update_modified_column();
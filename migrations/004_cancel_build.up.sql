@@ -0,0 +1 @@
+ALTER TABLE playlists ADD COLUMN cancel_requested BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,5 @@
+ALTER TABLE jobs DROP COLUMN delivery_id;
+DROP TRIGGER update_time_webhook_deliveries ON webhook_deliveries;
+DROP TRIGGER update_time_webhooks ON webhooks;
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
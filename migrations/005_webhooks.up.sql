@@ -0,0 +1,39 @@
+CREATE TABLE webhooks (
+  id      UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+  url     TEXT NOT NULL,
+  secret  TEXT NOT NULL,
+
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE webhook_deliveries (
+  id         UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  webhook_id UUID NOT NULL REFERENCES webhooks ON DELETE CASCADE,
+  event      VARCHAR(64) NOT NULL,
+  payload    JSONB NOT NULL,
+
+  status        VARCHAR(64) NOT NULL DEFAULT 'Pending',
+  attempts      INTEGER NOT NULL DEFAULT 0,
+  response_code INTEGER,
+  last_error    TEXT,
+  delivered_at  TIMESTAMPTZ,
+
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, created_at);
+
+ALTER TABLE jobs ADD COLUMN delivery_id UUID REFERENCES webhook_deliveries ON DELETE CASCADE;
+
+CREATE TRIGGER update_time_webhooks
+  BEFORE UPDATE
+  ON webhooks
+  FOR EACH ROW EXECUTE PROCEDURE update_modified_column();
+
+CREATE TRIGGER update_time_webhook_deliveries
+  BEFORE UPDATE
+  ON webhook_deliveries
+  FOR EACH ROW EXECUTE PROCEDURE update_modified_column();
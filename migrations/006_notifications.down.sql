@@ -0,0 +1,7 @@
+DROP TRIGGER update_time_notifications ON notifications;
+DROP TABLE notifications;
+ALTER TABLE playlists DROP COLUMN consecutive_failures;
+ALTER TABLE users DROP COLUMN last_digest_at;
+ALTER TABLE users DROP COLUMN notify_delivery;
+ALTER TABLE users DROP COLUMN notify_on;
+ALTER TABLE users DROP COLUMN email;
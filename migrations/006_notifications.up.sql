@@ -0,0 +1,26 @@
+ALTER TABLE users ADD COLUMN email TEXT;
+ALTER TABLE users ADD COLUMN notify_on VARCHAR(64) NOT NULL DEFAULT 'Never';
+ALTER TABLE users ADD COLUMN notify_delivery VARCHAR(64) NOT NULL DEFAULT 'Immediate';
+ALTER TABLE users ADD COLUMN last_digest_at TIMESTAMPTZ;
+
+ALTER TABLE playlists ADD COLUMN consecutive_failures INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE notifications (
+  id                   UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id              UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+  playlist_id          UUID NOT NULL REFERENCES playlists ON DELETE CASCADE,
+  playlist_name        TEXT NOT NULL,
+  failure_msg          TEXT NOT NULL,
+  consecutive_failures INTEGER NOT NULL,
+  sent_at              TIMESTAMPTZ,
+
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX notifications_pending ON notifications (user_id, created_at) WHERE sent_at IS NULL;
+
+CREATE TRIGGER update_time_notifications
+  BEFORE UPDATE
+  ON notifications
+  FOR EACH ROW EXECUTE PROCEDURE update_modified_column();
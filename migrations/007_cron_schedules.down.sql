@@ -0,0 +1,2 @@
+UPDATE playlists SET schedule='Never' WHERE schedule='Custom';
+ALTER TABLE playlists DROP COLUMN cron;
@@ -0,0 +1,2 @@
+ALTER TABLE playlists DROP COLUMN build_time;
+ALTER TABLE users DROP COLUMN timezone;
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
+ALTER TABLE playlists ADD COLUMN build_time VARCHAR(5) NOT NULL DEFAULT '06:00';
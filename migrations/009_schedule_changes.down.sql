@@ -0,0 +1,3 @@
+DROP TRIGGER notify_schedule_change_users ON users;
+DROP TRIGGER notify_schedule_change_playlists ON playlists;
+DROP FUNCTION notify_schedule_change();
@@ -0,0 +1,24 @@
+CREATE OR REPLACE FUNCTION notify_schedule_change()
+  RETURNS TRIGGER AS
+$func$
+BEGIN
+  IF TG_TABLE_NAME = 'users' THEN
+    PERFORM pg_notify('schedule_changes', json_build_object('userId', NEW.id)::text);
+  ELSIF TG_OP = 'DELETE' THEN
+    PERFORM pg_notify('schedule_changes', json_build_object('playlistId', OLD.id)::text);
+  ELSE
+    PERFORM pg_notify('schedule_changes', json_build_object('playlistId', NEW.id)::text);
+  END IF;
+  RETURN NULL;
+END;
+$func$ LANGUAGE 'plpgsql';
+
+CREATE TRIGGER notify_schedule_change_playlists
+  AFTER INSERT OR DELETE OR UPDATE OF schedule, cron, build_time, last_built_at
+  ON playlists
+  FOR EACH ROW EXECUTE PROCEDURE notify_schedule_change();
+
+CREATE TRIGGER notify_schedule_change_users
+  AFTER UPDATE OF timezone
+  ON users
+  FOR EACH ROW EXECUTE PROCEDURE notify_schedule_change();
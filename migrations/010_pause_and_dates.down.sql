@@ -0,0 +1,9 @@
+DROP TRIGGER notify_schedule_change_playlists ON playlists;
+CREATE TRIGGER notify_schedule_change_playlists
+  AFTER INSERT OR DELETE OR UPDATE OF schedule, cron, build_time, last_built_at
+  ON playlists
+  FOR EACH ROW EXECUTE PROCEDURE notify_schedule_change();
+
+ALTER TABLE playlists DROP COLUMN ends_on;
+ALTER TABLE playlists DROP COLUMN starts_on;
+ALTER TABLE playlists DROP COLUMN paused;
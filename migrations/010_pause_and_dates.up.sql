@@ -0,0 +1,9 @@
+ALTER TABLE playlists ADD COLUMN paused BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE playlists ADD COLUMN starts_on DATE;
+ALTER TABLE playlists ADD COLUMN ends_on DATE;
+
+DROP TRIGGER notify_schedule_change_playlists ON playlists;
+CREATE TRIGGER notify_schedule_change_playlists
+  AFTER INSERT OR DELETE OR UPDATE OF schedule, cron, build_time, last_built_at, paused, starts_on, ends_on
+  ON playlists
+  FOR EACH ROW EXECUTE PROCEDURE notify_schedule_change();
@@ -0,0 +1,3 @@
+DROP TABLE archived_playlists;
+ALTER TABLE playlists DROP COLUMN keep_builds;
+ALTER TABLE playlists DROP COLUMN output_mode;
@@ -0,0 +1,18 @@
+ALTER TABLE playlists ADD COLUMN output_mode VARCHAR(64) NOT NULL DEFAULT 'Replace';
+ALTER TABLE playlists ADD COLUMN keep_builds INTEGER NOT NULL DEFAULT 4;
+
+CREATE TABLE archived_playlists (
+  id          UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  playlist_id UUID NOT NULL REFERENCES playlists ON DELETE CASCADE,
+  spotify_id  TEXT NOT NULL,
+
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX archived_playlists_playlist_id ON archived_playlists (playlist_id, created_at);
+
+-- Every playlist already built owns the Spotify playlist it last built
+INSERT INTO archived_playlists (playlist_id, spotify_id, created_at)
+  SELECT id, spotify_id, COALESCE(last_built_at, NOW())
+  FROM playlists
+  WHERE spotify_id IS NOT NULL;
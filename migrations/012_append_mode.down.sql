@@ -0,0 +1,2 @@
+DROP INDEX archived_playlists_spotify_id;
+ALTER TABLE playlists DROP COLUMN max_size;
@@ -0,0 +1,4 @@
+ALTER TABLE playlists ADD COLUMN max_size INTEGER NOT NULL DEFAULT 200;
+
+-- Appending builds keep adding to the same spotify playlist
+CREATE UNIQUE INDEX archived_playlists_spotify_id ON archived_playlists (playlist_id, spotify_id);
@@ -0,0 +1,3 @@
+DROP TABLE promoted_tracks;
+ALTER TABLE playlists DROP COLUMN collaborator_policy;
+ALTER TABLE playlists DROP COLUMN collaborative;
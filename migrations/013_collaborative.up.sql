@@ -0,0 +1,11 @@
+ALTER TABLE playlists ADD COLUMN collaborative BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE playlists ADD COLUMN collaborator_policy VARCHAR(64) NOT NULL DEFAULT 'Drop';
+
+CREATE TABLE promoted_tracks (
+  playlist_id UUID NOT NULL REFERENCES playlists ON DELETE CASCADE,
+  track_id    TEXT NOT NULL,
+
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (playlist_id, track_id)
+);
@@ -0,0 +1,6 @@
+DROP TABLE excluded_tracks;
+DROP TRIGGER update_time_built_tracks ON built_tracks;
+DROP TABLE built_tracks;
+ALTER TABLE playlists DROP COLUMN edits_removed;
+ALTER TABLE playlists DROP COLUMN edits_added;
+ALTER TABLE playlists DROP COLUMN edit_policy;
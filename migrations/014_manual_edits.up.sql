@@ -0,0 +1,27 @@
+ALTER TABLE playlists ADD COLUMN edit_policy VARCHAR(64) NOT NULL DEFAULT 'Carry';
+ALTER TABLE playlists ADD COLUMN edits_added INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE playlists ADD COLUMN edits_removed INTEGER NOT NULL DEFAULT 0;
+
+-- What the last good build put in its Spotify playlist, to tell what was changed by hand since
+CREATE TABLE built_tracks (
+  playlist_id UUID PRIMARY KEY REFERENCES playlists ON DELETE CASCADE,
+  spotify_id  TEXT NOT NULL,
+  tracks      JSONB NOT NULL,
+
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER update_time_built_tracks
+  BEFORE UPDATE
+  ON built_tracks
+  FOR EACH ROW EXECUTE PROCEDURE update_modified_column();
+
+CREATE TABLE excluded_tracks (
+  playlist_id UUID NOT NULL REFERENCES playlists ON DELETE CASCADE,
+  track_id    TEXT NOT NULL,
+
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (playlist_id, track_id)
+);
@@ -0,0 +1,3 @@
+DROP TABLE output_targets;
+ALTER TABLE playlists DROP COLUMN split_size;
+ALTER TABLE playlists DROP COLUMN split_mode;
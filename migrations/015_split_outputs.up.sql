@@ -0,0 +1,20 @@
+ALTER TABLE playlists ADD COLUMN split_mode VARCHAR(64) NOT NULL DEFAULT 'None';
+ALTER TABLE playlists ADD COLUMN split_size INTEGER NOT NULL DEFAULT 50;
+
+-- The spotify playlists the last good build split its tracks into, in order
+CREATE TABLE output_targets (
+  playlist_id UUID NOT NULL REFERENCES playlists ON DELETE CASCADE,
+  position    INTEGER NOT NULL,
+  name        TEXT NOT NULL,
+  spotify_id  TEXT NOT NULL,
+
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (playlist_id, position)
+);
+
+-- Every playlist built so far went into a single spotify playlist
+INSERT INTO output_targets (playlist_id, position, name, spotify_id)
+  SELECT id, 0, name, spotify_id
+  FROM playlists
+  WHERE spotify_id IS NOT NULL;
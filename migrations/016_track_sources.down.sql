@@ -0,0 +1,26 @@
+-- Put the sources back into the input blob before dropping their tables
+UPDATE playlists p SET input = p.input || jsonb_build_object('trackSources', COALESCE((
+  SELECT jsonb_agg(
+    jsonb_build_object(
+      'name', s.name,
+      'id', s.source_id,
+      'type', s.source_type,
+      'count', s.count,
+      'method', s.method,
+      'filters', COALESCE((
+        SELECT jsonb_agg(
+          jsonb_build_object('op', f.op, 'name', f.name, 'id', f.source_id, 'type', f.source_type)
+          ORDER BY f.ordinal
+        )
+        FROM source_filters f
+        WHERE f.playlist_id = s.playlist_id AND f.source_ordinal = s.ordinal
+      ), '[]'::JSONB)
+    )
+    ORDER BY s.ordinal
+  )
+  FROM track_sources s
+  WHERE s.playlist_id = p.id
+), '[]'::JSONB));
+
+DROP TABLE source_filters;
+DROP TABLE track_sources;
@@ -0,0 +1,51 @@
+-- Sources move out of the input blob so they can be queried and indexed on their own
+CREATE TABLE track_sources (
+  playlist_id UUID NOT NULL REFERENCES playlists ON DELETE CASCADE,
+  ordinal     INTEGER NOT NULL CHECK (ordinal >= 0),
+  source_type VARCHAR(64) NOT NULL,
+  source_id   TEXT NOT NULL,
+  name        TEXT NOT NULL,
+  count       INTEGER NOT NULL CHECK (count >= 0),
+  method      VARCHAR(64) NOT NULL,
+
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (playlist_id, ordinal)
+);
+
+CREATE INDEX track_sources_source_idx ON track_sources (source_type, source_id);
+
+CREATE TRIGGER update_time_track_sources
+  BEFORE UPDATE
+  ON track_sources
+  FOR EACH ROW EXECUTE PROCEDURE update_modified_column();
+
+-- The filters narrowing down each source, applied in order
+CREATE TABLE source_filters (
+  playlist_id    UUID NOT NULL,
+  source_ordinal INTEGER NOT NULL,
+  ordinal        INTEGER NOT NULL CHECK (ordinal >= 0),
+  op             VARCHAR(64) NOT NULL,
+  source_type    VARCHAR(64) NOT NULL,
+  source_id      TEXT NOT NULL,
+  name           TEXT NOT NULL,
+
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (playlist_id, source_ordinal, ordinal),
+  FOREIGN KEY (playlist_id, source_ordinal) REFERENCES track_sources (playlist_id, ordinal) ON DELETE CASCADE
+);
+
+INSERT INTO track_sources (playlist_id, ordinal, source_type, source_id, name, count, method)
+  SELECT p.id, s.ordinality - 1, s.source->>'type', s.source->>'id', s.source->>'name', (s.source->>'count')::INTEGER, s.source->>'method'
+  FROM playlists p
+  CROSS JOIN LATERAL jsonb_array_elements(COALESCE(p.input->'trackSources', '[]'::JSONB)) WITH ORDINALITY AS s(source, ordinality);
+
+INSERT INTO source_filters (playlist_id, source_ordinal, ordinal, op, source_type, source_id, name)
+  SELECT p.id, s.ordinality - 1, f.ordinality - 1, f.filter->>'op', f.filter->>'type', f.filter->>'id', f.filter->>'name'
+  FROM playlists p
+  CROSS JOIN LATERAL jsonb_array_elements(COALESCE(p.input->'trackSources', '[]'::JSONB)) WITH ORDINALITY AS s(source, ordinality)
+  CROSS JOIN LATERAL jsonb_array_elements(COALESCE(s.source->'filters', '[]'::JSONB)) WITH ORDINALITY AS f(filter, ordinality);
+
+UPDATE playlists SET input = input - 'trackSources';
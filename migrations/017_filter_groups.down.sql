@@ -0,0 +1,3 @@
+-- Only filters that aren't groups or inside of one can be kept
+DELETE FROM source_filters WHERE parent_ordinal IS NOT NULL OR op IN ('All', 'Any');
+ALTER TABLE source_filters DROP COLUMN parent_ordinal;
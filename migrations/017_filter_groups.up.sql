@@ -0,0 +1,5 @@
+-- Filters nest into All and Any groups. Every filter of a source is numbered in one sequence,
+-- parents before their children, and the filters a source starts with have no parent.
+ALTER TABLE source_filters ADD COLUMN parent_ordinal INTEGER;
+ALTER TABLE source_filters ADD FOREIGN KEY (playlist_id, source_ordinal, parent_ordinal)
+  REFERENCES source_filters (playlist_id, source_ordinal, ordinal) ON DELETE CASCADE;
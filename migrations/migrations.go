@@ -0,0 +1,31 @@
+// Package migrations holds the SQL migrations for the database schema. They are embedded so
+// the binary can apply them itself with the migrate command.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// FS holds every up and down Postgres migration, named like 001_init.up.sql
+//
+//go:embed *.sql
+var FS embed.FS
+
+// sqliteFS holds the SQLite migrations, which start at the version the Postgres ones had
+// reached when SQLite was added and follow them from then on
+//
+//go:embed sqlite/*.sql
+var sqliteFS embed.FS
+
+// For returns the migrations for the given database/sql driver
+func For(driverName string) fs.FS {
+	if driverName == "sqlite3" {
+		sub, err := fs.Sub(sqliteFS, "sqlite")
+		if err != nil {
+			panic(err)
+		}
+		return sub
+	}
+	return FS
+}
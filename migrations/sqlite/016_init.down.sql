@@ -0,0 +1,14 @@
+DROP TABLE source_filters;
+DROP TABLE track_sources;
+DROP TABLE output_targets;
+DROP TABLE excluded_tracks;
+DROP TABLE built_tracks;
+DROP TABLE promoted_tracks;
+DROP TABLE archived_playlists;
+DROP TABLE notifications;
+DROP TABLE jobs;
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
+DROP TABLE source_tracks;
+DROP TABLE playlists;
+DROP TABLE users;
@@ -0,0 +1,291 @@
+-- The whole schema as of the Postgres migrations up to 016_track_sources, so the versions of
+-- both backends line up from here on. SQLite has no UUID type so IDs are TEXT generated by the
+-- app, JSONB columns are TEXT and timestamps are stored as UTC text with millisecond precision.
+
+CREATE TABLE users (
+  id              TEXT PRIMARY KEY,
+  spotify_id      TEXT NOT NULL,
+  playlists_built INTEGER NOT NULL,
+
+  session_token  VARCHAR(128),
+  session_expiry TIMESTAMP,
+
+  access_token  TEXT NOT NULL,
+  refresh_token TEXT NOT NULL,
+  token_type    TEXT NOT NULL,
+  token_expiry  TIMESTAMP NOT NULL,
+
+  email           TEXT,
+  notify_on       VARCHAR(64) NOT NULL DEFAULT 'Never',
+  notify_delivery VARCHAR(64) NOT NULL DEFAULT 'Immediate',
+  last_digest_at  TIMESTAMP,
+  timezone        TEXT NOT NULL DEFAULT 'UTC',
+
+  created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE TABLE playlists (
+  id      TEXT PRIMARY KEY,
+  user_id TEXT REFERENCES users ON DELETE RESTRICT,
+
+  input       TEXT NOT NULL,
+  name        TEXT NOT NULL,
+  description TEXT NOT NULL,
+  public      BOOLEAN NOT NULL,
+  schedule    VARCHAR(64) NOT NULL,
+  spotify_id  TEXT,
+  failure_msg TEXT,
+  building    BOOLEAN NOT NULL DEFAULT FALSE,
+  current     BOOLEAN NOT NULL DEFAULT FALSE,
+
+  created_at    TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  updated_at    TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  last_built_at TIMESTAMP,
+
+  cancel_requested     BOOLEAN NOT NULL DEFAULT FALSE,
+  consecutive_failures INTEGER NOT NULL DEFAULT 0,
+  cron                 TEXT,
+  build_time           VARCHAR(5) NOT NULL DEFAULT '06:00',
+  paused               BOOLEAN NOT NULL DEFAULT FALSE,
+  starts_on            DATE,
+  ends_on              DATE,
+  output_mode          VARCHAR(64) NOT NULL DEFAULT 'Replace',
+  keep_builds          INTEGER NOT NULL DEFAULT 4,
+  max_size             INTEGER NOT NULL DEFAULT 200,
+  collaborative        BOOLEAN NOT NULL DEFAULT FALSE,
+  collaborator_policy  VARCHAR(64) NOT NULL DEFAULT 'Drop',
+  edit_policy          VARCHAR(64) NOT NULL DEFAULT 'Carry',
+  edits_added          INTEGER NOT NULL DEFAULT 0,
+  edits_removed        INTEGER NOT NULL DEFAULT 0,
+  split_mode           VARCHAR(64) NOT NULL DEFAULT 'None',
+  split_size           INTEGER NOT NULL DEFAULT 50
+);
+
+CREATE TABLE source_tracks (
+  source_id   TEXT PRIMARY KEY,
+  snapshot_id TEXT NOT NULL,
+  tracks      TEXT NOT NULL,
+
+  created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE TABLE webhooks (
+  id      TEXT PRIMARY KEY,
+  user_id TEXT NOT NULL REFERENCES users ON DELETE CASCADE,
+  url     TEXT NOT NULL,
+  secret  TEXT NOT NULL,
+
+  created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE TABLE webhook_deliveries (
+  id         TEXT PRIMARY KEY,
+  webhook_id TEXT NOT NULL REFERENCES webhooks ON DELETE CASCADE,
+  event      VARCHAR(64) NOT NULL,
+  payload    TEXT NOT NULL,
+
+  status        VARCHAR(64) NOT NULL DEFAULT 'Pending',
+  attempts      INTEGER NOT NULL DEFAULT 0,
+  response_code INTEGER,
+  last_error    TEXT,
+  delivered_at  TIMESTAMP,
+
+  created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE INDEX webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, created_at);
+
+CREATE TABLE jobs (
+  id          TEXT PRIMARY KEY,
+  kind        VARCHAR(64) NOT NULL,
+  user_id     TEXT NOT NULL REFERENCES users ON DELETE CASCADE,
+  playlist_id TEXT NOT NULL,
+  delivery_id TEXT REFERENCES webhook_deliveries ON DELETE CASCADE,
+
+  status       VARCHAR(64) NOT NULL DEFAULT 'Queued',
+  attempts     INTEGER NOT NULL DEFAULT 0,
+  max_attempts INTEGER NOT NULL DEFAULT 3,
+  last_error   TEXT,
+  run_at       TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  locked_at    TIMESTAMP,
+
+  created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE INDEX jobs_claimable ON jobs (run_at) WHERE status IN ('Queued', 'Running');
+
+CREATE TABLE notifications (
+  id                   TEXT PRIMARY KEY,
+  user_id              TEXT NOT NULL REFERENCES users ON DELETE CASCADE,
+  playlist_id          TEXT NOT NULL REFERENCES playlists ON DELETE CASCADE,
+  playlist_name        TEXT NOT NULL,
+  failure_msg          TEXT NOT NULL,
+  consecutive_failures INTEGER NOT NULL,
+  sent_at              TIMESTAMP,
+
+  created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE INDEX notifications_pending ON notifications (user_id, created_at) WHERE sent_at IS NULL;
+
+CREATE TABLE archived_playlists (
+  id          TEXT PRIMARY KEY,
+  playlist_id TEXT NOT NULL REFERENCES playlists ON DELETE CASCADE,
+  spotify_id  TEXT NOT NULL,
+
+  created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE INDEX archived_playlists_playlist_id ON archived_playlists (playlist_id, created_at);
+CREATE UNIQUE INDEX archived_playlists_spotify_id ON archived_playlists (playlist_id, spotify_id);
+
+CREATE TABLE promoted_tracks (
+  playlist_id TEXT NOT NULL REFERENCES playlists ON DELETE CASCADE,
+  track_id    TEXT NOT NULL,
+
+  created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+
+  PRIMARY KEY (playlist_id, track_id)
+);
+
+CREATE TABLE built_tracks (
+  playlist_id TEXT PRIMARY KEY REFERENCES playlists ON DELETE CASCADE,
+  spotify_id  TEXT NOT NULL,
+  tracks      TEXT NOT NULL,
+
+  created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE TABLE excluded_tracks (
+  playlist_id TEXT NOT NULL REFERENCES playlists ON DELETE CASCADE,
+  track_id    TEXT NOT NULL,
+
+  created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+
+  PRIMARY KEY (playlist_id, track_id)
+);
+
+CREATE TABLE output_targets (
+  playlist_id TEXT NOT NULL REFERENCES playlists ON DELETE CASCADE,
+  position    INTEGER NOT NULL,
+  name        TEXT NOT NULL,
+  spotify_id  TEXT NOT NULL,
+
+  created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+
+  PRIMARY KEY (playlist_id, position)
+);
+
+CREATE TABLE track_sources (
+  playlist_id TEXT NOT NULL REFERENCES playlists ON DELETE CASCADE,
+  ordinal     INTEGER NOT NULL CHECK (ordinal >= 0),
+  source_type VARCHAR(64) NOT NULL,
+  source_id   TEXT NOT NULL,
+  name        TEXT NOT NULL,
+  count       INTEGER NOT NULL CHECK (count >= 0),
+  method      VARCHAR(64) NOT NULL,
+
+  created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+
+  PRIMARY KEY (playlist_id, ordinal)
+);
+
+CREATE INDEX track_sources_source_idx ON track_sources (source_type, source_id);
+
+CREATE TABLE source_filters (
+  playlist_id    TEXT NOT NULL,
+  source_ordinal INTEGER NOT NULL,
+  ordinal        INTEGER NOT NULL CHECK (ordinal >= 0),
+  op             VARCHAR(64) NOT NULL,
+  source_type    VARCHAR(64) NOT NULL,
+  source_id      TEXT NOT NULL,
+  name           TEXT NOT NULL,
+
+  created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+
+  PRIMARY KEY (playlist_id, source_ordinal, ordinal),
+  FOREIGN KEY (playlist_id, source_ordinal) REFERENCES track_sources (playlist_id, ordinal) ON DELETE CASCADE
+);
+
+-- Keep updated_at current like the update_modified_column trigger does in Postgres. Recursive
+-- triggers are off so the inner update doesn't fire them again.
+
+CREATE TRIGGER update_time_users
+  AFTER UPDATE
+  ON users
+  FOR EACH ROW WHEN NEW.updated_at = OLD.updated_at
+BEGIN
+  UPDATE users SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE rowid = NEW.rowid;
+END;
+
+CREATE TRIGGER update_time_playlists
+  AFTER UPDATE
+  ON playlists
+  FOR EACH ROW WHEN NEW.updated_at = OLD.updated_at
+BEGIN
+  UPDATE playlists SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE rowid = NEW.rowid;
+END;
+
+CREATE TRIGGER update_time_source_tracks
+  AFTER UPDATE
+  ON source_tracks
+  FOR EACH ROW WHEN NEW.updated_at = OLD.updated_at
+BEGIN
+  UPDATE source_tracks SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE rowid = NEW.rowid;
+END;
+
+CREATE TRIGGER update_time_jobs
+  AFTER UPDATE
+  ON jobs
+  FOR EACH ROW WHEN NEW.updated_at = OLD.updated_at
+BEGIN
+  UPDATE jobs SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE rowid = NEW.rowid;
+END;
+
+CREATE TRIGGER update_time_webhooks
+  AFTER UPDATE
+  ON webhooks
+  FOR EACH ROW WHEN NEW.updated_at = OLD.updated_at
+BEGIN
+  UPDATE webhooks SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE rowid = NEW.rowid;
+END;
+
+CREATE TRIGGER update_time_webhook_deliveries
+  AFTER UPDATE
+  ON webhook_deliveries
+  FOR EACH ROW WHEN NEW.updated_at = OLD.updated_at
+BEGIN
+  UPDATE webhook_deliveries SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE rowid = NEW.rowid;
+END;
+
+CREATE TRIGGER update_time_notifications
+  AFTER UPDATE
+  ON notifications
+  FOR EACH ROW WHEN NEW.updated_at = OLD.updated_at
+BEGIN
+  UPDATE notifications SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE rowid = NEW.rowid;
+END;
+
+CREATE TRIGGER update_time_built_tracks
+  AFTER UPDATE
+  ON built_tracks
+  FOR EACH ROW WHEN NEW.updated_at = OLD.updated_at
+BEGIN
+  UPDATE built_tracks SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE rowid = NEW.rowid;
+END;
+
+CREATE TRIGGER update_time_track_sources
+  AFTER UPDATE
+  ON track_sources
+  FOR EACH ROW WHEN NEW.updated_at = OLD.updated_at
+BEGIN
+  UPDATE track_sources SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE rowid = NEW.rowid;
+END;
\ No newline at end of file
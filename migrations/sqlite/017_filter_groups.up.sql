@@ -0,0 +1,4 @@
+-- Filters nest into All and Any groups. Every filter of a source is numbered in one sequence,
+-- parents before their children, and the filters a source starts with have no parent. SQLite
+-- can't add a foreign key to an existing table, so children are removed with their source.
+ALTER TABLE source_filters ADD COLUMN parent_ordinal INTEGER;
@@ -0,0 +1,107 @@
+package build
+
+import (
+	"context"
+
+	"github.com/zmb3/spotify"
+
+	"github.com/calebschoepp/playlist-rotator/pkg/events"
+	"github.com/calebschoepp/playlist-rotator/pkg/motify"
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+)
+
+// appendToPlaylist adds the tracks that aren't already in a previously built playlist
+// to its end, then trims the oldest tracks so it holds no more than maxSize items.
+// Pinned tracks are added like any other since positions shift with every append.
+// Tracks added by anyone other than dropAllBut are removed too, unless it is empty.
+// It returns how many tracks were added and every track the playlist ends up with.
+func (s *Service) appendToPlaylist(ctx context.Context, client *motify.Client, previous *previousBuild, tracks []spotify.ID, output store.Output, maxSize int, dropAllBut string, report func(events.Event)) (int, []spotify.ID, error) {
+	playlistID := previous.spotifyID
+	items := previous.items
+
+	// Work out which of the current items are removed and which are kept
+	var remove []int
+	var kept []int
+	for position, item := range items {
+		if dropAllBut != "" && item.id != "" && item.addedBy != dropAllBut {
+			remove = append(remove, position)
+		} else {
+			kept = append(kept, position)
+		}
+	}
+
+	// Skip tracks that are already in the playlist
+	present := make(map[spotify.ID]bool, len(kept)+len(tracks))
+	for _, position := range kept {
+		present[items[position].id] = true
+	}
+	var fresh []spotify.ID
+	for _, id := range tracks {
+		if !present[id] {
+			present[id] = true
+			fresh = append(fresh, id)
+		}
+	}
+
+	// Trim the oldest of the kept tracks, apart from any this build picked again
+	picked := make(map[spotify.ID]bool, len(tracks))
+	for _, id := range tracks {
+		picked[id] = true
+	}
+	excess := len(kept) + len(fresh) - maxSize
+	var contents []spotify.ID
+	for _, position := range kept {
+		if excess > 0 && items[position].id != "" && !picked[items[position].id] {
+			// Items that aren't tracks can't be removed by URI so they are left where they are
+			remove = append(remove, position)
+			excess--
+			continue
+		}
+		if items[position].id != "" {
+			contents = append(contents, items[position].id)
+		}
+	}
+	contents = append(contents, fresh...)
+
+	// The name and description may be templated so refresh them on every build
+	err := client.ChangePlaylistNameAccessAndDescription(ctx, playlistID, output.Name, output.Description, output.Public)
+	if err != nil {
+		return 0, nil, err
+	}
+	err = client.ChangePlaylistCollaborative(ctx, playlistID, output.Collaborative)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	_, err = addTracksToPlaylist(ctx, client, playlistID, fresh, report)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = removePositions(ctx, client, playlistID, previous.snapshotID, items, remove)
+	if err != nil {
+		return 0, nil, err
+	}
+	return len(fresh), contents, nil
+}
+
+// removePositions removes the tracks at positions from a playlist. Positions are
+// given against snapshotID so Spotify can apply them over the tracks appended since.
+func removePositions(ctx context.Context, client *motify.Client, playlistID spotify.ID, snapshotID string, items []playlistItem, positions []int) error {
+	var remove []spotify.TrackToRemove
+	for _, position := range positions {
+		remove = append(remove, spotify.NewTrackToRemove(string(items[position].id), []int{position}))
+	}
+
+	for start := 0; start < len(remove); start += 100 {
+		stop := start + 100
+		if stop > len(remove) {
+			stop = len(remove)
+		}
+		_, err := client.RemoveTracksFromPlaylistOpt(ctx, playlistID, remove[start:stop], snapshotID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
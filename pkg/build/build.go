@@ -1,10 +1,53 @@
 package build
 
-import "github.com/google/uuid"
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
 
 // Builder provides methods for working with real Spotify playlists
 type Builder interface {
-	BuildPlaylist(userID, playlistID uuid.UUID)
-	DeletePlaylist(userID, playlistID uuid.UUID)
-	BuildScheduledPlaylists()
+	BuildPlaylist(ctx context.Context, userID, playlistID uuid.UUID, trigger Trigger, final bool) error
+	CancelBuild(ctx context.Context, userID, playlistID uuid.UUID) error
+	DeletePlaylist(ctx context.Context, userID, playlistID uuid.UUID) error
+	BuildScheduledPlaylists(ctx context.Context)
+	RunScheduler(ctx context.Context, databaseURL string)
+}
+
+// Trigger is what caused a playlist to be built
+type Trigger string
+
+const (
+	// ManualTrigger builds were requested by the user
+	ManualTrigger Trigger = "manual"
+	// ScheduledTrigger builds were started by the playlist's schedule
+	ScheduledTrigger = "scheduled"
+)
+
+// ConfigError is a build failure caused by how the playlist is configured, like a source
+// without enough tracks or a name that doesn't render. Building again won't fix it.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// configErrorf formats an error like fmt.Errorf and marks it as a ConfigError
+func configErrorf(format string, args ...interface{}) error {
+	return &ConfigError{Err: fmt.Errorf(format, args...)}
+}
+
+// IsPermanent reports whether a build failed in a way that retrying can't fix
+func IsPermanent(err error) bool {
+	var configErr *ConfigError
+	return errors.As(err, &configErr)
 }
@@ -0,0 +1,50 @@
+package build
+
+import (
+	"context"
+
+	"github.com/zmb3/spotify"
+
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+)
+
+// carriedOverTracks applies a collaborative playlist's policy to the tracks collaborators
+// added to its previous build and returns the tracks to carry over into this build
+func (s *Service) carriedOverTracks(ctx context.Context, playlist *store.Playlist, previous *previousBuild, ownerID string) ([]spotify.ID, error) {
+	if !playlist.Collaborative || playlist.CollaboratorPolicy == store.DropAdded {
+		return nil, nil
+	}
+	if playlist.CollaboratorPolicy == store.KeepAdded && playlist.OutputMode == store.Append {
+		// Appending already leaves collaborators' tracks where they are
+		return nil, nil
+	}
+
+	var added []spotify.ID
+	if previous != nil {
+		for _, item := range previous.items {
+			if item.id != "" && item.addedBy != ownerID {
+				added = append(added, item.id)
+			}
+		}
+	}
+	if playlist.CollaboratorPolicy == store.KeepAdded {
+		return added, nil
+	}
+
+	// Promoted tracks stick around for every build from now on
+	if len(added) > 0 {
+		err := s.store.AddPromotedTracks(ctx, playlist.ID, idStrings(added))
+		if err != nil {
+			return nil, err
+		}
+	}
+	promoted, err := s.store.GetPromotedTracks(ctx, playlist.ID)
+	if err != nil {
+		return nil, err
+	}
+	carried := make([]spotify.ID, len(promoted))
+	for i, id := range promoted {
+		carried[i] = spotify.ID(id)
+	}
+	return carried, nil
+}
@@ -0,0 +1,98 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg" // Spotify serves album and playlist covers as JPEGs
+	_ "image/png"
+	"net/http"
+	"time"
+
+	"github.com/zmb3/spotify"
+
+	"github.com/calebschoepp/playlist-rotator/pkg/cover"
+	"github.com/calebschoepp/playlist-rotator/pkg/motify"
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+)
+
+// coverFetchTimeout bounds downloading each source cover
+const coverFetchTimeout = 10 * time.Second
+
+// uploadCover replaces the cover of a freshly built playlist with a collage of its
+// source covers, labelled with its name and the local date it was built
+func (s *Service) uploadCover(ctx context.Context, client *motify.Client, name string, input store.Input, spotifyID spotify.ID, loc *time.Location) error {
+	var sources []image.Image
+	for _, trackSource := range input.TrackSources {
+		if len(sources) == 9 {
+			break
+		}
+		url, err := sourceCoverURL(ctx, client, trackSource)
+		if err != nil {
+			s.log.Warnw("failed to find cover of track source", "err", err.Error(), "spotifyID", trackSource.ID)
+			continue
+		}
+		if url == "" {
+			continue
+		}
+		img, err := fetchImage(ctx, url)
+		if err != nil {
+			s.log.Warnw("failed to download cover of track source", "err", err.Error(), "spotifyID", trackSource.ID)
+			continue
+		}
+		sources = append(sources, img)
+	}
+
+	subtitle := "Built " + time.Now().In(loc).Format("January 2, 2006")
+	b, err := cover.Encode(cover.Compose(sources, name, subtitle))
+	if err != nil {
+		return err
+	}
+	return client.SetPlaylistImage(ctx, spotifyID, bytes.NewReader(b))
+}
+
+// sourceCoverURL returns the URL of a track source's cover, or an empty string if it has none
+func sourceCoverURL(ctx context.Context, client *motify.Client, trackSource store.TrackSource) (string, error) {
+	var images []spotify.Image
+	switch trackSource.Type {
+	case store.AlbumSrc:
+		album, err := client.GetAlbum(ctx, spotify.ID(trackSource.ID))
+		if err != nil {
+			return "", err
+		}
+		images = album.Images
+	case store.PlaylistSrc:
+		playlist, err := client.GetPlaylistOpt(ctx, spotify.ID(trackSource.ID), "images")
+		if err != nil {
+			return "", err
+		}
+		images = playlist.Images
+	}
+	if len(images) == 0 {
+		return "", nil
+	}
+	return images[0].URL, nil
+}
+
+// fetchImage downloads and decodes an image
+func fetchImage(ctx context.Context, url string) (image.Image, error) {
+	ctx, cancel := context.WithTimeout(ctx, coverFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status fetching image: %s", resp.Status)
+	}
+
+	img, _, err := image.Decode(resp.Body)
+	return img, err
+}
@@ -0,0 +1,295 @@
+package build
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+)
+
+// scheduleChannel is the Postgres channel the database announces schedule changes on
+const scheduleChannel = "schedule_changes"
+
+const (
+	// maxSchedulerSleep caps how long the scheduler sleeps so it never oversleeps a clock change
+	maxSchedulerSleep = 15 * time.Minute
+	// resyncInterval is how often the scheduler reloads every playlist in case it missed a change
+	resyncInterval = 6 * time.Hour
+	// pollInterval is how often the scheduler reloads every playlist when the database can't
+	// announce changes, which only Postgres can
+	pollInterval = time.Minute
+	// digestCheckInterval is how often the scheduler checks for failure digests to send
+	digestCheckInterval = time.Hour
+	// listenerPingInterval keeps the change listener's connection alive
+	listenerPingInterval = 90 * time.Second
+	// retryDelay is how long the scheduler waits to retry a build that didn't move its playlist's
+	// deadline, like one the user cancelled or one skipped for being over budget
+	retryDelay = time.Hour
+)
+
+// scheduleChange is the payload of a notification on scheduleChannel. Exactly one field is set.
+type scheduleChange struct {
+	PlaylistID *uuid.UUID `json:"playlistId"`
+	UserID     *uuid.UUID `json:"userId"`
+}
+
+// upcomingBuild is a playlist the scheduler is waiting to build
+type upcomingBuild struct {
+	playlist store.Playlist
+	deadline time.Time
+	runAt    time.Time // Later than deadline when retrying a build that didn't finish
+}
+
+// attempt is a deadline the scheduler already started a build for
+type attempt struct {
+	deadline time.Time
+	retryAt  time.Time
+}
+
+// scheduler holds the state of RunScheduler. It is only touched from the scheduler's own goroutine.
+type scheduler struct {
+	s         *Service
+	deadlines *deadlineFinder
+	upcoming  map[uuid.UUID]upcomingBuild
+	inFlight  map[uuid.UUID]bool
+	attempted map[uuid.UUID]attempt
+}
+
+// RunScheduler builds scheduled playlists as they come due until ctx is done. It loads
+// every playlist once, then sleeps until the next deadline and only reloads the
+// playlists that the database reports as changed. Databases other than Postgres can't
+// report changes so every playlist is reloaded each pollInterval instead.
+func (s *Service) RunScheduler(ctx context.Context, databaseURL string) {
+	s.log.Info("starting scheduler")
+
+	driver, err := store.Driver(databaseURL)
+	if err != nil {
+		s.log.Errorw("failed to pick database driver for scheduler", "err", err.Error())
+		return
+	}
+	var listener *pq.Listener
+	var changes <-chan *pq.Notification
+	interval := pollInterval
+	if driver == store.PostgresDriver {
+		listener = pq.NewListener(databaseURL, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+			if err != nil {
+				s.log.Warnw("schedule change listener problem", "err", err.Error())
+			}
+		})
+		defer listener.Close()
+
+		err = listener.Listen(scheduleChannel)
+		if err != nil {
+			s.log.Errorw("failed to listen for schedule changes", "err", err.Error())
+			return
+		}
+		changes = listener.Notify
+		interval = resyncInterval
+	}
+
+	sc := &scheduler{
+		s:         s,
+		deadlines: s.newDeadlineFinder(),
+		upcoming:  make(map[uuid.UUID]upcomingBuild),
+		inFlight:  make(map[uuid.UUID]bool),
+		attempted: make(map[uuid.UUID]attempt),
+	}
+	sc.resync(ctx)
+
+	// Builds run in the background so changes keep being picked up while they do. Only one
+	// batch runs at a time so the concurrency limits hold, anything that comes due meanwhile
+	// waits for the next batch.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	finished := make(chan []uuid.UUID)
+	running := false
+
+	resync := time.NewTicker(interval)
+	defer resync.Stop()
+	digests := time.NewTicker(digestCheckInterval)
+	defer digests.Stop()
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	for {
+		wait := maxSchedulerSleep
+		if !running {
+			wait = sc.sleep()
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.log.Info("scheduler stopping, waiting for running builds")
+			return
+		case n := <-changes:
+			if n == nil {
+				// The connection was re-established and notifications may have been lost
+				sc.resync(ctx)
+				break
+			}
+			sc.handleChange(ctx, n.Extra)
+		case ids := <-finished:
+			running = false
+			for _, id := range ids {
+				delete(sc.inFlight, id)
+				sc.refresh(ctx, id)
+			}
+		case <-resync.C:
+			sc.resync(ctx)
+		case <-digests.C:
+			s.notifier.SendDigests(ctx)
+		case <-ping.C:
+			if listener != nil {
+				go listener.Ping()
+			}
+		case <-timer.C:
+			if running {
+				break
+			}
+			due, ids := sc.takeDue(time.Now())
+			if len(due) == 0 {
+				break
+			}
+			running = true
+			wg.Add(1)
+			go func(queuedAt time.Time) {
+				defer wg.Done()
+				stats := s.runScheduledBuilds(ctx, due, queuedAt)
+				s.log.Infow("scheduled builds finished", "queued", len(due), "built", stats.built, "skippedOverBudget", stats.skipped, "maxQueueWait", stats.maxWait)
+				select {
+				case finished <- ids:
+				case <-ctx.Done():
+				}
+			}(time.Now())
+		}
+		timer.Stop()
+	}
+}
+
+// sleep returns how long until the next deadline that isn't already being built
+func (sc *scheduler) sleep() time.Duration {
+	wait := maxSchedulerSleep
+	now := time.Now()
+	for id, u := range sc.upcoming {
+		if sc.inFlight[id] {
+			continue
+		}
+		if d := u.runAt.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// takeDue marks every playlist whose deadline has passed as in flight and returns them to be built
+func (sc *scheduler) takeDue(now time.Time) ([]scheduledBuild, []uuid.UUID) {
+	var due []scheduledBuild
+	var ids []uuid.UUID
+	for id, u := range sc.upcoming {
+		if sc.inFlight[id] || now.Before(u.runAt) {
+			continue
+		}
+		sc.s.log.Infow("queueing playlist to build", "playlistID", id, "overdue", now.Sub(u.deadline))
+		due = append(due, scheduledBuild{playlist: u.playlist, overdue: now.Sub(u.deadline)})
+		ids = append(ids, id)
+		sc.inFlight[id] = true
+		sc.attempted[id] = attempt{deadline: u.deadline, retryAt: now.Add(retryDelay)}
+	}
+	return due, ids
+}
+
+// resync reloads every playlist's deadline from scratch
+func (sc *scheduler) resync(ctx context.Context) {
+	playlists, err := sc.s.store.GetAllPlaylists(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			sc.s.log.Errorw("failed to load playlists for scheduler", "err", err.Error())
+		}
+		return
+	}
+
+	sc.deadlines = sc.s.newDeadlineFinder()
+	sc.upcoming = make(map[uuid.UUID]upcomingBuild)
+	for _, p := range playlists {
+		sc.track(ctx, p)
+	}
+	sc.s.log.Infow("scheduler loaded playlists", "total", len(playlists), "scheduled", len(sc.upcoming))
+}
+
+// handleChange reloads whatever a schedule change notification is about
+func (sc *scheduler) handleChange(ctx context.Context, payload string) {
+	var change scheduleChange
+	err := json.Unmarshal([]byte(payload), &change)
+	if err != nil {
+		sc.s.log.Warnw("failed to unmarshal schedule change", "err", err.Error())
+		return
+	}
+
+	if change.PlaylistID != nil {
+		sc.refresh(ctx, *change.PlaylistID)
+		return
+	}
+	if change.UserID != nil {
+		// The user's timezone changed so every one of their deadlines may have moved
+		sc.deadlines.forget(*change.UserID)
+		playlists, err := sc.s.store.GetPlaylists(ctx, *change.UserID)
+		if err != nil {
+			sc.s.log.Errorw("failed to reload user's playlists for scheduler", "err", err.Error(), "userID", *change.UserID)
+			return
+		}
+		for _, p := range playlists {
+			sc.track(ctx, p)
+		}
+	}
+}
+
+// refresh reloads a single playlist's deadline
+func (sc *scheduler) refresh(ctx context.Context, playlistID uuid.UUID) {
+	p, err := sc.s.store.GetPlaylist(ctx, playlistID)
+	if errors.Is(err, sql.ErrNoRows) {
+		delete(sc.upcoming, playlistID)
+		delete(sc.attempted, playlistID)
+		return
+	} else if err != nil {
+		if ctx.Err() == nil {
+			sc.s.log.Errorw("failed to reload playlist for scheduler", "err", err.Error(), "playlistID", playlistID)
+		}
+		return
+	}
+	sc.track(ctx, *p)
+}
+
+// track records when a playlist is next due, or forgets it if it isn't scheduled
+func (sc *scheduler) track(ctx context.Context, p store.Playlist) {
+	deadline, reason, err := sc.deadlines.deadline(ctx, p)
+	if reason != notSkipped {
+		if err != nil {
+			sc.s.log.Warnw("playlist has no valid schedule", "err", err.Error(), "playlistID", p.ID)
+		}
+		delete(sc.upcoming, p.ID)
+		delete(sc.attempted, p.ID)
+		return
+	}
+
+	// A finished build moves the deadline, if it didn't then hold off before trying again
+	runAt := *deadline
+	if a, ok := sc.attempted[p.ID]; ok {
+		if a.deadline.Equal(*deadline) {
+			runAt = a.retryAt
+		} else {
+			delete(sc.attempted, p.ID)
+		}
+	}
+	sc.upcoming[p.ID] = upcomingBuild{playlist: p, deadline: *deadline, runAt: runAt}
+}
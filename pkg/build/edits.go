@@ -0,0 +1,131 @@
+package build
+
+import (
+	"context"
+
+	"github.com/zmb3/spotify"
+
+	"github.com/calebschoepp/playlist-rotator/pkg/motify"
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+)
+
+// previousBuild is the spotify playlist a playlist last built, as it is now
+type previousBuild struct {
+	spotifyID  spotify.ID
+	snapshotID string
+	items      []playlistItem
+}
+
+// readPreviousBuild reads every item in a previously built playlist along with the
+// snapshot the items were read from
+func readPreviousBuild(ctx context.Context, client *motify.Client, spotifyID spotify.ID) (*previousBuild, error) {
+	playlist, err := client.GetPlaylistOpt(ctx, spotifyID, "snapshot_id")
+	if err != nil {
+		return nil, err
+	}
+	items, err := pagePlaylist(ctx, client, spotifyID)
+	if err != nil {
+		return nil, err
+	}
+	return &previousBuild{spotifyID: spotifyID, snapshotID: playlist.SnapshotID, items: items}, nil
+}
+
+// findManualEdits diffs the previous build against the tracks it was built with to find
+// what the owner changed by hand. Removed tracks are to be excluded from later builds and
+// added tracks are either to be pinned or returned so they are carried over into this
+// build. Nothing is saved here, the edits are saved along with the build.
+func (s *Service) findManualEdits(ctx context.Context, client *motify.Client, playlist *store.Playlist, previous *previousBuild, ownerID string) ([]spotify.ID, store.ManualEdits, error) {
+	var edits store.ManualEdits
+	if playlist.EditPolicy == store.IgnoreEdits || previous == nil {
+		return nil, edits, nil
+	}
+	built, err := s.store.GetBuiltTracks(ctx, playlist.ID)
+	if err != nil {
+		return nil, edits, err
+	}
+	if built == nil || built.SpotifyID != string(previous.spotifyID) {
+		// Without a record of what was built there's no telling what was edited
+		return nil, edits, nil
+	}
+
+	wasBuilt := make(map[spotify.ID]bool, len(built.Tracks))
+	for _, id := range built.Tracks {
+		wasBuilt[spotify.ID(id)] = true
+	}
+	live := make(map[spotify.ID]bool, len(previous.items))
+	var added []spotify.ID
+	for _, item := range previous.items {
+		if item.id == "" || live[item.id] {
+			continue
+		}
+		live[item.id] = true
+		// Tracks collaborators add are left to the collaborator policy
+		if !wasBuilt[item.id] && item.addedBy == ownerID {
+			added = append(added, item.id)
+		}
+	}
+	var removed []spotify.ID
+	for _, id := range built.Tracks {
+		if id != "" && !live[spotify.ID(id)] {
+			live[spotify.ID(id)] = true
+			removed = append(removed, spotify.ID(id))
+		}
+	}
+	edits = store.ManualEdits{
+		Added:   len(added),
+		Removed: len(removed),
+		Exclude: idStrings(removed),
+		// Adding back a track that was removed before lets it back in
+		Unexclude: idStrings(added),
+		// Removing a pinned track by hand unpins it
+		Unpin: idStrings(removed),
+	}
+
+	if playlist.EditPolicy != store.PinEdits {
+		return added, edits, nil
+	}
+	edits.Pin, err = pinsFor(ctx, client, added)
+	if err != nil {
+		return nil, edits, err
+	}
+	// Pinned tracks are included in every build already
+	return nil, edits, nil
+}
+
+// pinsFor looks up the names of tracks to pin
+func pinsFor(ctx context.Context, client *motify.Client, ids []spotify.ID) ([]store.PinnedTrack, error) {
+	var pins []store.PinnedTrack
+	for start := 0; start < len(ids); start += 50 {
+		stop := start + 50
+		if stop > len(ids) {
+			stop = len(ids)
+		}
+		tracks, err := client.GetTracks(ctx, ids[start:stop]...)
+		if err != nil {
+			return nil, err
+		}
+		for i, track := range tracks {
+			pins = append(pins, store.PinnedTrack{ID: string(ids[start+i]), Name: trackName(track)})
+		}
+	}
+	return pins, nil
+}
+
+// trackName describes a track by its name and first artist
+func trackName(track *spotify.FullTrack) string {
+	if track == nil {
+		return "Unknown track"
+	}
+	if len(track.Artists) == 0 {
+		return track.Name
+	}
+	return track.Name + " - " + track.Artists[0].Name
+}
+
+func idStrings(ids []spotify.ID) []string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = string(id)
+	}
+	return s
+}
@@ -0,0 +1,180 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/zmb3/spotify"
+
+	"github.com/calebschoepp/playlist-rotator/pkg/motify"
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+)
+
+// getFilteredTracks picks tracks from a source that has filters. The whole source is
+// listed and narrowed down to the tracks every filter keeps, then the extraction method
+// picks from whatever is left.
+func (s *Service) getFilteredTracks(ctx context.Context, client *motify.Client, trackSource store.TrackSource, excluded map[spotify.ID]bool) ([]spotify.ID, error) {
+	listing, err := s.getSourceListing(ctx, client, trackSource.Type, trackSource.ID)
+	if err != nil {
+		return nil, err
+	}
+	others := make(map[filterSource]map[spotify.ID]bool)
+	err = s.listFilterSources(ctx, client, trackSource.Filters, others)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := store.SourceFilter{Op: store.All, Children: trackSource.Filters}
+	var candidates []spotify.ID
+	for _, id := range listing {
+		if keeps(filter, id, others) {
+			candidates = append(candidates, id)
+		}
+	}
+
+	if len(candidates) < trackSource.Count {
+		// Not enough songs
+		return nil, configErrorf("Expected to find %d songs after filtering but only found %d", trackSource.Count, len(candidates))
+	}
+	fetch := func(offset, limit int) ([]spotify.ID, error) {
+		return candidates[offset : offset+limit], nil
+	}
+	if trackSource.Method == store.Latest {
+		return takeLatest(trackSource.Count, len(candidates), fetch, excluded)
+	}
+	return sampleTracks(trackSource.Count, len(candidates), fetch, excluded)
+}
+
+// filterSource is a source that filters compare tracks with
+type filterSource struct {
+	typ store.TrackSourceType
+	id  string
+}
+
+// listFilterSources lists every source compared with in filters and the groups nested in them
+// into others, listing each source only once however many filters name it
+func (s *Service) listFilterSources(ctx context.Context, client *motify.Client, filters []store.SourceFilter, others map[filterSource]map[spotify.ID]bool) error {
+	for _, filter := range filters {
+		switch filter.Op {
+		case store.All, store.Any:
+			if len(filter.Children) == 0 {
+				return configErrorf("empty %s filter group", filter.Op)
+			}
+			err := s.listFilterSources(ctx, client, filter.Children, others)
+			if err != nil {
+				return err
+			}
+		case store.Intersect, store.Subtract:
+			key := filterSource{filter.Type, filter.ID}
+			if _, ok := others[key]; ok {
+				continue
+			}
+			listing, err := s.getSourceListing(ctx, client, filter.Type, filter.ID)
+			if err != nil {
+				return fmt.Errorf("failed to get tracks from %s: %w", filter.Name, err)
+			}
+			others[key] = make(map[spotify.ID]bool, len(listing))
+			for _, id := range listing {
+				others[key][id] = true
+			}
+		default:
+			return configErrorf("unknown filter operation: %s", filter.Op)
+		}
+	}
+	return nil
+}
+
+// keeps returns whether filter keeps a track, given the listings of every source it compares with
+func keeps(filter store.SourceFilter, id spotify.ID, others map[filterSource]map[spotify.ID]bool) bool {
+	switch filter.Op {
+	case store.Intersect:
+		return others[filterSource{filter.Type, filter.ID}][id]
+	case store.Subtract:
+		return !others[filterSource{filter.Type, filter.ID}][id]
+	case store.All:
+		for _, child := range filter.Children {
+			if !keeps(child, id, others) {
+				return false
+			}
+		}
+		return true
+	case store.Any:
+		for _, child := range filter.Children {
+			if keeps(child, id, others) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getSourceListing returns every track in a source, in the source's order and without
+// duplicates or anything that isn't a track
+func (s *Service) getSourceListing(ctx context.Context, client *motify.Client, typ store.TrackSourceType, id string) ([]spotify.ID, error) {
+	var listing []spotify.ID
+	switch typ {
+	case store.PlaylistSrc:
+		var err error
+		listing, err = s.getPlaylistListing(ctx, client, spotify.ID(id))
+		if err != nil {
+			return nil, err
+		}
+	case store.AlbumSrc:
+		offset := 0
+		limit := pageSize
+		for {
+			opts := spotify.Options{
+				Limit:  &limit,
+				Offset: &offset,
+			}
+			trackPage, err := client.GetAlbumTracksOpt(ctx, spotify.ID(id), &opts)
+			if err != nil {
+				return nil, err
+			}
+			for _, track := range trackPage.Tracks {
+				if strings.Contains(track.Endpoint, "tracks") {
+					listing = append(listing, track.ID)
+				}
+			}
+			offset += len(trackPage.Tracks)
+			if len(trackPage.Tracks) == 0 || offset >= trackPage.Total {
+				break
+			}
+		}
+	case store.LikedSrc:
+		offset := 0
+		limit := pageSize
+		for {
+			opts := spotify.Options{
+				Limit:  &limit,
+				Offset: &offset,
+			}
+			trackPage, err := client.CurrentUsersTracksOpt(ctx, &opts)
+			if err != nil {
+				return nil, err
+			}
+			for _, track := range trackPage.Tracks {
+				if strings.Contains(track.Endpoint, "tracks") {
+					listing = append(listing, track.ID)
+				}
+			}
+			offset += len(trackPage.Tracks)
+			if len(trackPage.Tracks) == 0 || offset >= trackPage.Total {
+				break
+			}
+		}
+	default:
+		return nil, configErrorf("unknown source type: %s", typ)
+	}
+
+	seen := make(map[spotify.ID]bool, len(listing))
+	var unique []spotify.ID
+	for _, id := range listing {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique, nil
+}
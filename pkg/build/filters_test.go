@@ -0,0 +1,36 @@
+package build
+
+import (
+	"testing"
+
+	"github.com/zmb3/spotify"
+
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+)
+
+func TestKeeps(t *testing.T) {
+	heard := store.SourceFilter{Op: store.Subtract, Name: "Already Heard", ID: "heard", Type: store.PlaylistSrc}
+	inAlbum := store.SourceFilter{Op: store.Intersect, Name: "Some Album", ID: "album1", Type: store.AlbumSrc}
+	inRoadTrip := store.SourceFilter{Op: store.Intersect, Name: "Road Trip", ID: "roadtrip", Type: store.PlaylistSrc}
+	others := map[filterSource]map[spotify.ID]bool{
+		{store.PlaylistSrc, "heard"}:    {"t1": true, "t2": true},
+		{store.AlbumSrc, "album1"}:      {"t2": true, "t3": true},
+		{store.PlaylistSrc, "roadtrip"}: {"t4": true},
+	}
+
+	// Not heard yet, and either on the album or in the road trip playlist
+	filter := store.SourceFilter{Op: store.All, Children: []store.SourceFilter{
+		heard,
+		{Op: store.Any, Children: []store.SourceFilter{inAlbum, inRoadTrip}},
+	}}
+	want := map[spotify.ID]bool{"t1": false, "t2": false, "t3": true, "t4": true, "t5": false}
+	for id, kept := range want {
+		if got := keeps(filter, id, others); got != kept {
+			t.Errorf("keeps(%s) = %v, want %v", id, got, kept)
+		}
+	}
+
+	if keeps(store.SourceFilter{Op: "Unknown"}, "t1", others) {
+		t.Error("a filter with an unknown operation kept a track")
+	}
+}
@@ -0,0 +1,99 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zmb3/spotify"
+
+	"github.com/calebschoepp/playlist-rotator/pkg/motify"
+	"github.com/calebschoepp/playlist-rotator/pkg/naming"
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+)
+
+const (
+	// topArtistsCount is how many artists {{.TopArtists}} lists
+	topArtistsCount = 3
+	// topArtistsSample caps how many tracks are looked up to find the top artists
+	topArtistsSample = 1000
+)
+
+// renderOutput fills in the templated name and description of output now that the
+// tracks going into the playlist are known
+func (s *Service) renderOutput(ctx context.Context, client *motify.Client, input store.Input, output store.Output, tracks []spotify.ID, loc *time.Location) (store.Output, error) {
+	now := time.Now().In(loc)
+	_, week := now.ISOWeek()
+	var sourceNames []string
+	for _, trackSource := range input.TrackSources {
+		sourceNames = append(sourceNames, trackSource.Name)
+	}
+	vars := naming.Vars{
+		Date:        now.Format("January 2, 2006"),
+		Week:        week,
+		SourceNames: strings.Join(sourceNames, ", "),
+		TrackCount:  len(tracks),
+	}
+
+	if naming.UsesTopArtists(output.Name) || naming.UsesTopArtists(output.Description) {
+		artists, err := topArtists(ctx, client, tracks)
+		if err != nil {
+			return output, fmt.Errorf("failed to find top artists: %w", err)
+		}
+		vars.TopArtists = strings.Join(artists, ", ")
+	}
+
+	name, err := naming.Render(output.Name, vars, naming.NameLimit)
+	if err != nil {
+		return output, configErrorf("failed to render playlist name: %w", err)
+	}
+	description, err := naming.Render(output.Description, vars, naming.DescriptionLimit)
+	if err != nil {
+		return output, configErrorf("failed to render playlist description: %w", err)
+	}
+	output.Name = name
+	output.Description = description
+	return output, nil
+}
+
+// topArtists returns the artists credited first on the most tracks
+func topArtists(ctx context.Context, client *motify.Client, tracks []spotify.ID) ([]string, error) {
+	if len(tracks) > topArtistsSample {
+		tracks = tracks[:topArtistsSample]
+	}
+
+	counts := make(map[string]int)
+	for start := 0; start < len(tracks); start += 50 {
+		stop := start + 50
+		if stop > len(tracks) {
+			stop = len(tracks)
+		}
+		fullTracks, err := client.GetTracks(ctx, tracks[start:stop]...)
+		if err != nil {
+			return nil, err
+		}
+		for _, track := range fullTracks {
+			if track == nil || len(track.Artists) == 0 {
+				continue
+			}
+			counts[track.Artists[0].Name]++
+		}
+	}
+
+	var artists []string
+	for artist := range counts {
+		artists = append(artists, artist)
+	}
+	sort.Slice(artists, func(i, j int) bool {
+		if counts[artists[i]] != counts[artists[j]] {
+			return counts[artists[i]] > counts[artists[j]]
+		}
+		return artists[i] < artists[j]
+	})
+	if len(artists) > topArtistsCount {
+		artists = artists[:topArtistsCount]
+	}
+	return artists, nil
+}
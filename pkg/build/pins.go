@@ -0,0 +1,83 @@
+package build
+
+import (
+	"sort"
+
+	"github.com/zmb3/spotify"
+
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+)
+
+// placePins orders tracks around a playlist's pinned tracks. Unfixed pins go after the
+// picked tracks and fixed pins are put at their positions, counted from either end.
+// Positions past the end of the playlist, or taken by an earlier pin, fall to the
+// nearest free position.
+func placePins(tracks []spotify.ID, pins []store.PinnedTrack) []spotify.ID {
+	pinned := make(map[spotify.ID]bool, len(pins))
+	for _, pin := range pins {
+		pinned[spotify.ID(pin.ID)] = true
+	}
+
+	// Everything not held in place by a pin fills the positions left over
+	var rest []spotify.ID
+	for _, id := range tracks {
+		if !pinned[id] {
+			rest = append(rest, id)
+		}
+	}
+	var fromStart, fromEnd []store.PinnedTrack
+	for _, pin := range pins {
+		switch {
+		case pin.Position > 0:
+			fromStart = append(fromStart, pin)
+		case pin.Position < 0:
+			fromEnd = append(fromEnd, pin)
+		default:
+			rest = append(rest, spotify.ID(pin.ID))
+		}
+	}
+	sort.SliceStable(fromStart, func(i, j int) bool { return fromStart[i].Position < fromStart[j].Position })
+	sort.SliceStable(fromEnd, func(i, j int) bool { return fromEnd[i].Position > fromEnd[j].Position })
+
+	placed := make([]spotify.ID, len(rest)+len(fromStart)+len(fromEnd))
+	taken := make([]bool, len(placed))
+	for _, pin := range fromStart {
+		i := freePosition(taken, pin.Position-1, 1)
+		placed[i], taken[i] = spotify.ID(pin.ID), true
+	}
+	for _, pin := range fromEnd {
+		i := freePosition(taken, len(placed)+pin.Position, -1)
+		placed[i], taken[i] = spotify.ID(pin.ID), true
+	}
+
+	next := 0
+	for i := range placed {
+		if !taken[i] {
+			placed[i] = rest[next]
+			next++
+		}
+	}
+	return placed
+}
+
+// freePosition returns the first free position from want, stepping by step and
+// then back the other way once it runs off either end
+func freePosition(taken []bool, want, step int) int {
+	if want < 0 {
+		want = 0
+	} else if want >= len(taken) {
+		want = len(taken) - 1
+	}
+	for i := want; i >= 0 && i < len(taken); i += step {
+		if !taken[i] {
+			return i
+		}
+	}
+	for i := want - step; i >= 0 && i < len(taken); i -= step {
+		if !taken[i] {
+			return i
+		}
+	}
+	// There are always at least as many positions as pins
+	return -1
+}
@@ -0,0 +1,182 @@
+package build
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zmb3/spotify"
+)
+
+// pageSize is the largest page Spotify returns for album, liked song and playlist tracks
+const pageSize = 50
+
+// maxConcurrentPages caps how many pages of a single source are fetched at once
+const maxConcurrentPages = 4
+
+// pageFetcher fetches limit tracks of a source starting at offset. The position
+// of each ID must match its position in the source, with an empty ID standing in
+// for anything that is not a track.
+type pageFetcher func(offset, limit int) ([]spotify.ID, error)
+
+// pageRequest is a window of a page containing at least one sampled offset
+type pageRequest struct {
+	offset  int
+	limit   int
+	wanted  []int
+	results []spotify.ID
+	err     error
+}
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// sampleTracks picks n random tracks out of a source holding N tracks. Only the
+// pages containing a sampled offset are fetched, so the number of API calls
+// grows with n rather than N. Excluded tracks and anything that isn't a track
+// are sampled again from the offsets not tried yet, so fewer than n tracks are
+// only returned once the whole source has been tried.
+func sampleTracks(n, N int, fetch pageFetcher, excluded map[spotify.ID]bool) ([]spotify.ID, error) {
+	var tracks []spotify.ID
+	var tried []int
+	for len(tracks) < n && len(tried) < N {
+		want := n - len(tracks)
+		if untried := N - len(tried); want > untried {
+			want = untried
+		}
+		offsets := skipTried(generateRandomOffsets(want, N-len(tried)), tried)
+		page, err := fetchOffsets(offsets, fetch)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range page {
+			if id != "" && !excluded[id] {
+				tracks = append(tracks, id)
+			}
+		}
+		tried = mergeOffsets(tried, offsets)
+	}
+	return tracks, nil
+}
+
+// takeLatest returns the first n tracks of a source holding N tracks, skipping excluded
+// tracks and anything that isn't a track. Pages are only fetched until n tracks are found.
+func takeLatest(n, N int, fetch pageFetcher, excluded map[spotify.ID]bool) ([]spotify.ID, error) {
+	var tracks []spotify.ID
+	for offset := 0; offset < N && len(tracks) < n; {
+		limit := n - len(tracks)
+		if limit > pageSize {
+			limit = pageSize
+		}
+		if limit > N-offset {
+			limit = N - offset
+		}
+		page, err := fetch(offset, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range page {
+			if id != "" && !excluded[id] {
+				tracks = append(tracks, id)
+			}
+		}
+		offset += limit
+	}
+	return tracks, nil
+}
+
+// skipTried maps ranks among the offsets not yet tried, in ascending order, to the offsets
+// themselves. tried must be sorted.
+func skipTried(ranks, tried []int) []int {
+	offsets := make([]int, len(ranks))
+	j := 0
+	for i, rank := range ranks {
+		// Every tried offset at or before where this rank lands pushes it along by one
+		for j < len(tried) && tried[j] <= rank+j {
+			j++
+		}
+		offsets[i] = rank + j
+	}
+	return offsets
+}
+
+// mergeOffsets merges two sorted lists of offsets into one
+func mergeOffsets(a, b []int) []int {
+	merged := make([]int, 0, len(a)+len(b))
+	merged = append(merged, a...)
+	merged = append(merged, b...)
+	sort.Ints(merged)
+	return merged
+}
+
+// fetchOffsets fetches the tracks at the given ascending offsets, in order, with an empty
+// ID for anything that isn't a track
+func fetchOffsets(offsets []int, fetch pageFetcher) ([]spotify.ID, error) {
+	// Group the sampled offsets by page, trimming each request down to the
+	// window between the first and last offset wanted from that page
+	var requests []*pageRequest
+	for _, offset := range offsets {
+		last := len(requests) - 1
+		if last >= 0 && requests[last].offset/pageSize == offset/pageSize {
+			requests[last].limit = offset - requests[last].offset + 1
+			requests[last].wanted = append(requests[last].wanted, offset)
+			continue
+		}
+		requests = append(requests, &pageRequest{
+			offset: offset,
+			limit:  1,
+			wanted: []int{offset},
+		})
+	}
+
+	// Fetch the pages concurrently
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentPages)
+	for _, req := range requests {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(req *pageRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			page, err := fetch(req.offset, req.limit)
+			if err != nil {
+				req.err = err
+				return
+			}
+			for _, offset := range req.wanted {
+				req.results = append(req.results, page[offset-req.offset])
+			}
+		}(req)
+	}
+	wg.Wait()
+
+	// Stitch the pages back together in source order
+	var tracks []spotify.ID
+	for _, req := range requests {
+		if req.err != nil {
+			return nil, req.err
+		}
+		tracks = append(tracks, req.results...)
+	}
+	return tracks, nil
+}
+
+// generateRandomOffsets returns n distinct offsets in [0, N) in ascending order.
+// It uses Floyd's algorithm so it never has to permute all N offsets.
+func generateRandomOffsets(n, N int) []int {
+	chosen := make(map[int]struct{}, n)
+	out := make([]int, 0, n)
+	for j := N - n; j < N; j++ {
+		t := rand.Intn(j + 1)
+		if _, ok := chosen[t]; ok {
+			t = j
+		}
+		chosen[t] = struct{}{}
+		out = append(out, t)
+	}
+	sort.Ints(out)
+	return out
+}
@@ -0,0 +1,103 @@
+package build
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/zmb3/spotify"
+)
+
+// listing returns a source of n tracks named t0, t1 and so on along with a pageFetcher over it
+// that counts how many tracks were requested
+func listing(n int) ([]spotify.ID, pageFetcher, *int) {
+	ids := make([]spotify.ID, n)
+	for i := range ids {
+		ids[i] = spotify.ID(fmt.Sprintf("t%d", i))
+	}
+	fetched := 0
+	return ids, func(offset, limit int) ([]spotify.ID, error) {
+		if offset < 0 || limit < 1 || offset+limit > len(ids) {
+			return nil, fmt.Errorf("page [%d, %d) is outside of the source", offset, offset+limit)
+		}
+		fetched += limit
+		return ids[offset : offset+limit], nil
+	}, &fetched
+}
+
+func TestTakeLatestSkipsExcluded(t *testing.T) {
+	ids, fetch, fetched := listing(200)
+	excluded := map[spotify.ID]bool{ids[0]: true, ids[3]: true, ids[60]: true}
+
+	tracks, err := takeLatest(60, len(ids), fetch, excluded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []spotify.ID
+	for _, id := range ids[:63] {
+		if !excluded[id] {
+			want = append(want, id)
+		}
+	}
+	if !reflect.DeepEqual(tracks, want) {
+		t.Errorf("took %v, want %v", tracks, want)
+	}
+	if *fetched > 63 {
+		t.Errorf("fetched %d tracks to find 60 of them", *fetched)
+	}
+
+	// Once the source runs out whatever is left is returned
+	tracks, err = takeLatest(10, 10, fetch, excluded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 8 {
+		t.Errorf("took %d of a 10 track source with 2 excluded, want 8", len(tracks))
+	}
+}
+
+func TestSampleTracksSkipsExcluded(t *testing.T) {
+	ids, fetch, _ := listing(100)
+	excluded := make(map[spotify.ID]bool)
+	for _, id := range ids[:90] {
+		excluded[id] = true
+	}
+
+	for i := 0; i < 20; i++ {
+		tracks, err := sampleTracks(5, len(ids), fetch, excluded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tracks) != 5 {
+			t.Fatalf("sampled %d tracks, want 5", len(tracks))
+		}
+		seen := make(map[spotify.ID]bool)
+		for _, id := range tracks {
+			if excluded[id] || seen[id] {
+				t.Fatalf("sampled %s which is excluded or already sampled", id)
+			}
+			seen[id] = true
+		}
+	}
+
+	// Asking for more than is left returns everything that is left
+	tracks, err := sampleTracks(20, len(ids), fetch, excluded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(tracks, func(i, j int) bool { return tracks[i] < tracks[j] })
+	sortedRest := append([]spotify.ID(nil), ids[90:]...)
+	sort.Slice(sortedRest, func(i, j int) bool { return sortedRest[i] < sortedRest[j] })
+	if !reflect.DeepEqual(tracks, sortedRest) {
+		t.Errorf("sampled %v, want %v", tracks, sortedRest)
+	}
+}
+
+func TestSkipTried(t *testing.T) {
+	// The untried offsets of [0, 8) are 1, 4, 5 and 7
+	got := skipTried([]int{0, 1, 2, 3}, []int{0, 2, 3, 6})
+	if want := []int{1, 4, 5, 7}; !reflect.DeepEqual(got, want) {
+		t.Errorf("skipTried = %v, want %v", got, want)
+	}
+}
@@ -1,20 +1,162 @@
 package build
 
 import (
+	"context"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+
+	"github.com/calebschoepp/playlist-rotator/pkg/schedule"
 	"github.com/calebschoepp/playlist-rotator/pkg/store"
 )
 
+// scheduledBuild is a playlist waiting in the queue of a scheduled build job
+type scheduledBuild struct {
+	playlist store.Playlist
+	overdue  time.Duration
+}
+
+// buildQueue hands out scheduled builds most overdue first, while never letting
+// a single user have more than userLimit builds running at once
+type buildQueue struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	pending   []scheduledBuild
+	running   map[uuid.UUID]int
+	userLimit int
+	closed    bool
+}
+
+func newBuildQueue(builds []scheduledBuild, userLimit int) *buildQueue {
+	sort.SliceStable(builds, func(i, j int) bool {
+		return builds[i].overdue > builds[j].overdue
+	})
+	q := &buildQueue{
+		pending:   builds,
+		running:   make(map[uuid.UUID]int),
+		userLimit: userLimit,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// next blocks until a build can be started and returns false once the queue is drained or closed
+func (q *buildQueue) next() (scheduledBuild, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if q.closed || len(q.pending) == 0 {
+			return scheduledBuild{}, false
+		}
+		for i, b := range q.pending {
+			if q.running[b.playlist.UserID] < q.userLimit {
+				q.pending = append(q.pending[:i], q.pending[i+1:]...)
+				q.running[b.playlist.UserID]++
+				return b, true
+			}
+		}
+		// Every pending build belongs to a user who is already at their limit
+		q.cond.Wait()
+	}
+}
+
+// done marks a build handed out by next as finished
+func (q *buildQueue) done(userID uuid.UUID) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.running[userID]--
+	q.cond.Broadcast()
+}
+
+// close stops the queue from handing out any more builds and returns how many were left waiting
+func (q *buildQueue) close() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+	return len(q.pending)
+}
+
+// skipReason explains why a playlist has no scheduled deadline
+type skipReason string
+
+const (
+	notSkipped         skipReason = ""
+	neverScheduled     skipReason = "neverScheduled"
+	neverManuallyBuilt skipReason = "neverManuallyBuilt"
+	invalidSchedule    skipReason = "invalidSchedule"
+	paused             skipReason = "paused"
+	ended              skipReason = "ended"
+)
+
+// deadlineFinder works out when playlists are next due to be built, caching each owner's timezone
+type deadlineFinder struct {
+	store     store.Store
+	locations map[uuid.UUID]*time.Location
+}
+
+func (s *Service) newDeadlineFinder() *deadlineFinder {
+	return &deadlineFinder{
+		store:     s.store,
+		locations: make(map[uuid.UUID]*time.Location),
+	}
+}
+
+// deadline returns when p is next due to be built, or nil and why it isn't scheduled
+func (d *deadlineFinder) deadline(ctx context.Context, p store.Playlist) (*time.Time, skipReason, error) {
+	// Don't build playlists that are never scheduled
+	if p.Schedule == store.Never {
+		return nil, neverScheduled, nil
+	}
+
+	// Don't build playlists that haven't been built manually at least once
+	if p.LastBuiltAt == nil {
+		return nil, neverManuallyBuilt, nil
+	}
+
+	// Don't build playlists that are paused
+	if p.Paused {
+		return nil, paused, nil
+	}
+
+	// Deadlines are in the owner's timezone
+	loc, ok := d.locations[p.UserID]
+	if !ok {
+		user, err := d.store.GetUserByID(ctx, p.UserID)
+		if err != nil {
+			return nil, invalidSchedule, err
+		}
+		loc = user.Location()
+		d.locations[p.UserID] = loc
+	}
+
+	next, err := schedule.Next(p, loc)
+	if err != nil {
+		return nil, invalidSchedule, err
+	}
+	if next == nil {
+		// Only an end date or a cron expression that never matches again leaves nothing to schedule
+		if p.EndsOn != nil {
+			return nil, ended, nil
+		}
+		return nil, invalidSchedule, nil
+	}
+	return next, notSkipped, nil
+}
+
+// forget drops a user's cached timezone so it is loaded again next time
+func (d *deadlineFinder) forget(userID uuid.UUID) {
+	delete(d.locations, userID)
+}
+
 // BuildScheduledPlaylists builds all scheduled playlists whose deadlines have passed
-func (s *Service) BuildScheduledPlaylists() {
+func (s *Service) BuildScheduledPlaylists(ctx context.Context) {
 	s.log.Info("starting build job")
 
-	var wg sync.WaitGroup
-
 	// Get playlists
-	playlists, err := s.store.GetAllPlaylists()
+	playlists, err := s.store.GetAllPlaylists(ctx)
 	if err != nil {
 		// This probably won't happen but if it does something is seriously wrong
 		// Not much we can do here expcept log it and wait until the next time the job runs
@@ -22,58 +164,34 @@ func (s *Service) BuildScheduledPlaylists() {
 		return
 	}
 
-	built := 0
-	neverScheduled := 0
-	neverManuallyBuilt := 0
+	skipped := make(map[skipReason]int)
 	notDeadline := 0
 
-	// For every playlist if the deadline has passed build it
+	// For every playlist if the deadline has passed queue it to be built
+	now := time.Now()
+	deadlines := s.newDeadlineFinder()
+	var due []scheduledBuild
 	for i, p := range playlists {
-		// Don't build playlists that are never scheduled
-		if p.Schedule == store.Never {
-			s.log.Infow("skip building playist that is never scheduled", "idx", i, "playlistID", p.ID)
-			neverScheduled++
-			continue
-		}
-
-		// Don't build playlists that haven't been built manually at least once
-		if p.LastBuiltAt == nil {
-			s.log.Infow("skip building playist that has never been manually built", "idx", i, "playlistID", p.ID)
-			neverManuallyBuilt++
+		deadline, reason, err := deadlines.deadline(ctx, p)
+		if reason != notSkipped {
+			s.log.Infow("skip building playlist that isn't scheduled", "idx", i, "playlistID", p.ID, "reason", reason, "err", err)
+			skipped[reason]++
 			continue
 		}
 
 		// Don't build playlists whose deadlines haven't passed yet
-		deadline := *p.LastBuiltAt
-		switch p.Schedule {
-		case store.Never:
-			// Shouldn't reach here
-		case store.Daily:
-			deadline = deadline.AddDate(0, 0, 1)
-		case store.Weekly:
-			deadline = deadline.AddDate(0, 0, 7)
-		case store.BiWeekly:
-			deadline = deadline.AddDate(0, 0, 14)
-		case store.Monthly:
-			deadline = deadline.AddDate(0, 1, 0)
-		}
-		if time.Now().Before(deadline) {
+		if now.Before(*deadline) {
 			s.log.Infow("skip building playist whose deadline hasn't passed", "idx", i, "playlistID", p.ID)
 			notDeadline++
 			continue
 		}
 
 		// By this point we know we want to build the playlist
-		s.log.Infow("building playlist", "idx", i, "playlistID", p.ID)
-		built++
-		wg.Add(1)
-		go func(playlist store.Playlist) {
-			defer wg.Done()
-			s.BuildPlaylist(playlist.UserID, playlist.ID)
-		}(p)
+		s.log.Infow("queueing playlist to build", "idx", i, "playlistID", p.ID, "overdue", now.Sub(*deadline))
+		due = append(due, scheduledBuild{playlist: p, overdue: now.Sub(*deadline)})
 	}
 
-	wg.Wait()
+	stats := s.runScheduledBuilds(ctx, due, now)
 
 	// Print out summary
 	s.log.Infow(
@@ -81,12 +199,96 @@ func (s *Service) BuildScheduledPlaylists() {
 		"total",
 		len(playlists),
 		"built",
-		built,
+		stats.built,
 		"neverScheduled",
-		neverScheduled,
+		skipped[neverScheduled],
 		"neverManuallyBuilt",
-		neverManuallyBuilt,
+		skipped[neverManuallyBuilt],
 		"notDeadline",
 		notDeadline,
+		"invalidSchedule",
+		skipped[invalidSchedule],
+		"paused",
+		skipped[paused],
+		"ended",
+		skipped[ended],
+		"queued",
+		len(due),
+		"skippedOverBudget",
+		stats.skipped,
+		"avgQueueWait",
+		stats.avgWait,
+		"maxQueueWait",
+		stats.maxWait,
 	)
 }
+
+// runStats summarizes a run through a queue of scheduled builds
+type runStats struct {
+	built   int
+	skipped int
+	avgWait time.Duration
+	maxWait time.Duration
+}
+
+// runScheduledBuilds works through due builds until they are all done or the
+// run-time budget is spent, stopping any builds still running at that point.
+// Queue waits are measured from queuedAt.
+func (s *Service) runScheduledBuilds(ctx context.Context, due []scheduledBuild, queuedAt time.Time) runStats {
+	queue := newBuildQueue(due, s.schedulerUserConcurrency)
+	runCtx, cancel := context.WithTimeout(ctx, s.schedulerBudget)
+	defer cancel()
+
+	// Stop handing out builds once the budget is spent or the job itself is cancelled
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-runCtx.Done():
+			if ctx.Err() != nil {
+				s.log.Warnw("build job cancelled", "err", ctx.Err().Error(), "skipped", queue.close())
+			} else {
+				s.log.Warnw("build job ran out of time", "budget", s.schedulerBudget, "skipped", queue.close())
+			}
+		case <-finished:
+		}
+	}()
+
+	var mu sync.Mutex
+	var stats runStats
+	var totalWait time.Duration
+	var wg sync.WaitGroup
+	for i := 0; i < s.schedulerConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				b, ok := queue.next()
+				if !ok {
+					return
+				}
+
+				wait := time.Since(queuedAt)
+				mu.Lock()
+				stats.built++
+				totalWait += wait
+				if wait > stats.maxWait {
+					stats.maxWait = wait
+				}
+				mu.Unlock()
+
+				s.log.Infow("building playlist", "playlistID", b.playlist.ID, "queueWait", wait)
+				s.BuildPlaylist(runCtx, b.playlist.UserID, b.playlist.ID, ScheduledTrigger, true)
+				queue.done(b.playlist.UserID)
+			}
+		}()
+	}
+
+	wg.Wait()
+	stats.skipped = queue.close()
+
+	if stats.built > 0 {
+		stats.avgWait = totalWait / time.Duration(stats.built)
+	}
+	return stats
+}
@@ -1,28 +1,66 @@
 package build
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"math/rand"
-	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/zmb3/spotify"
 	"go.uber.org/zap"
 
+	"github.com/calebschoepp/playlist-rotator/pkg/config"
+	"github.com/calebschoepp/playlist-rotator/pkg/events"
 	"github.com/calebschoepp/playlist-rotator/pkg/motify"
+	"github.com/calebschoepp/playlist-rotator/pkg/naming"
+	"github.com/calebschoepp/playlist-rotator/pkg/notify"
 	"github.com/calebschoepp/playlist-rotator/pkg/store"
+	"github.com/calebschoepp/playlist-rotator/pkg/webhook"
 )
 
+// cancelPollInterval is how often a running build checks whether it has been cancelled
+const cancelPollInterval = 2 * time.Second
+
 // Service manages building the actual spotify playlists
 type Service struct {
-	store   store.Store
-	spotify *motify.Spotify
-	log     *zap.SugaredLogger
+	store    store.Store
+	spotify  *motify.Spotify
+	events   events.Publisher
+	notifier *notify.Notifier
+	log      *zap.SugaredLogger
+
+	sourceConcurrency        int
+	schedulerConcurrency     int
+	schedulerUserConcurrency int
+	schedulerBudget          time.Duration
+}
+
+// buildRun identifies a single playlist build for recording its outcome
+type buildRun struct {
+	userID     uuid.UUID
+	playlistID uuid.UUID
+	trigger    Trigger
+	final      bool // Whether a failure is the last, otherwise the caller retries the build
+	name       string
+}
+
+// buildResult is what a successful build produced
+type buildResult struct {
+	spotifyID    spotify.ID
+	appended     bool  // Whether tracks were added to the previous build instead of a new playlist
+	sourceCounts []int // Tracks taken from each source, in source order
+	trackCount   int
+
+	tracks  []spotify.ID         // Every track the first built playlist holds
+	targets []store.OutputTarget // Every spotify playlist built, the first of them being spotifyID
+	edits   store.ManualEdits    // Changes made by hand to the build it replaced
 }
 
-type trackFetcher func(client *motify.Client, tracks []spotify.ID, trackSource store.TrackSource) ([]spotify.ID, error)
+// trackFetcher picks the tracks of a source, skipping excluded tracks as it goes
+type trackFetcher func(s *Service, ctx context.Context, client *motify.Client, trackSource store.TrackSource, excluded map[spotify.ID]bool) ([]spotify.ID, error)
 
 var trackFetchers map[store.ExtractMethod]map[store.TrackSourceType]trackFetcher
 
@@ -30,184 +68,542 @@ func init() {
 	// Prebuild map of functions to fetch tracks
 	trackFetchers = map[store.ExtractMethod]map[store.TrackSourceType]trackFetcher{
 		store.Latest: map[store.TrackSourceType]trackFetcher{
-			store.AlbumSrc:    getTopAlbumTracks,
-			store.LikedSrc:    getTopLikedTracks,
-			store.PlaylistSrc: getTopPlaylistTracks,
+			store.AlbumSrc:    (*Service).getTopAlbumTracks,
+			store.LikedSrc:    (*Service).getTopLikedTracks,
+			store.PlaylistSrc: (*Service).getTopPlaylistTracks,
 		},
 		store.Randomly: map[store.TrackSourceType]trackFetcher{
-			store.AlbumSrc:    getRandomAlbumTracks,
-			store.LikedSrc:    getRandomLikedTracks,
-			store.PlaylistSrc: getRandomPlaylistTracks,
+			store.AlbumSrc:    (*Service).getRandomAlbumTracks,
+			store.LikedSrc:    (*Service).getRandomLikedTracks,
+			store.PlaylistSrc: (*Service).getRandomPlaylistTracks,
 		},
 	}
 }
 
 // New returns a pointer to a new BuildService
-func New(store store.Store, spotify *motify.Spotify, log *zap.SugaredLogger) *Service {
+func New(store store.Store, spotify *motify.Spotify, events events.Publisher, notifier *notify.Notifier, log *zap.SugaredLogger, config *config.Config) *Service {
 	return &Service{
-		store:   store,
-		spotify: spotify,
-		log:     log,
+		store:             store,
+		spotify:           spotify,
+		events:            events,
+		notifier:          notifier,
+		log:               log,
+		sourceConcurrency: config.SourceConcurrency,
+
+		schedulerConcurrency:     config.SchedulerConcurrency,
+		schedulerUserConcurrency: config.SchedulerUserConcurrency,
+		schedulerBudget:          config.SchedulerBudget,
 	}
 }
 
-// BuildPlaylist uses the configuration from playlistID to build a spotify playlist for userID
-func (s *Service) BuildPlaylist(userID, playlistID uuid.UUID) {
+// BuildPlaylist uses the configuration from playlistID to build a spotify playlist for userID.
+// Failures are returned so that callers can retry, and are only reported as failed builds
+// once final is set or retrying can't help. The build stops early if ctx is cancelled or a
+// user cancels it, in which case the previously built playlist is left untouched.
+func (s *Service) BuildPlaylist(ctx context.Context, userID, playlistID uuid.UUID, trigger Trigger, final bool) error {
+	run := &buildRun{userID: userID, playlistID: playlistID, trigger: trigger, final: final}
+
 	// Tell DB that playlist is currently being built
-	err := s.store.UpdatePlaylistStartBuild(playlistID)
+	err := s.store.UpdatePlaylistStartBuild(ctx, playlistID)
 	if err != nil {
 		// This shouldn't go wrong but if it does we want to just return b/c db was not changed
 		s.log.Errorw("failed to update playlist into building state", "err", err.Error())
-		return
+		return err
 	}
+	s.publish(userID, playlistID, events.Event{Type: events.BuildStarted})
+
+	// Let the build be cancelled from the UI, even when it runs in another process
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.watchForCancel(ctx, playlistID, cancel)
 
 	// Get playlist configuration
-	playlist, err := s.store.GetPlaylist(playlistID)
+	playlist, err := s.store.GetPlaylist(ctx, playlistID)
 	if err != nil {
-		s.logBuildError(userID, playlistID, err)
-		return
+		return s.logBuildError(ctx, run, err)
 	}
+	run.name = playlist.Name
 
 	// Build and validate output
 	output := store.Output{
-		Name:        playlist.Name,
-		Description: playlist.Description,
-		Public:      playlist.Public,
+		Name:          playlist.Name,
+		Description:   playlist.Description,
+		Public:        playlist.Public && !playlist.Collaborative,
+		Collaborative: playlist.Collaborative,
+		Split:         playlist.SplitMode,
+		SplitSize:     playlist.SplitSize,
+	}
+	if playlist.OutputMode == store.Archive {
+		output.Name = naming.ArchiveName(output.Name)
 	}
 
 	// Build spotify client
-	user, err := s.store.GetUserByID(userID)
+	user, err := s.store.GetUserByID(ctx, userID)
 	if err != nil {
-		s.logBuildError(userID, playlistID, err)
-		return
+		return s.logBuildError(ctx, run, err)
 	}
 	client := s.spotify.NewClient(&user.Token)
 
-	// Unfollow a possibly pre-existing spotify playlist
-	if playlist.SpotifyID != nil {
-		err = client.UnfollowPlaylist(spotify.ID(user.SpotifyID), spotify.ID(*playlist.SpotifyID))
-		if err != nil {
-			s.logBuildError(userID, playlistID, err)
-			return
-		}
-	}
-
-	// Build the playlist
-	spotifyPlaylistID, err := buildPlaylist(&client, user.SpotifyID, playlist.Input, output)
+	// Build the new playlist before touching the old one so a failed or
+	// cancelled build leaves the previous playlist in place
+	report := func(e events.Event) { s.publish(userID, playlistID, e) }
+	result, err := s.buildPlaylist(ctx, &client, user.SpotifyID, playlist, output, user.Location(), report)
 	if err != nil {
-		s.logBuildError(userID, playlistID, err)
-		return
+		return s.logBuildError(ctx, run, err)
+	}
+	if ctx.Err() != nil {
+		s.discardResult(&client, user.SpotifyID, result)
+		return s.logBuildError(ctx, run, ctx.Err())
 	}
 
 	// Update database for successful case
-	err = s.store.UpdatePlaylistGoodBuild(playlistID, string(*spotifyPlaylistID))
+	err = s.store.UpdatePlaylistGoodBuild(ctx, playlistID, result.targets, idStrings(result.tracks), result.edits)
 	if err != nil {
-		s.logBuildError(userID, playlistID, err)
-		return
+		s.discardResult(&client, user.SpotifyID, result)
+		return s.logBuildError(ctx, run, err)
 	}
 
-	err = s.store.IncrementUserBuildCount(userID)
+	// Unfollow the playlists this build replaces
+	keep := len(result.targets)
+	if playlist.OutputMode == store.Archive {
+		keep = playlist.KeepBuilds
+	}
+	s.pruneArchive(&client, user.SpotifyID, playlistID, keep)
+
+	err = s.store.IncrementUserBuildCount(ctx, userID)
 	if err != nil {
 		// This really shouldn't go wrong but if it does all we can do is log it
 		s.log.Errorw("failed to increment build count", "err", err.Error(), "userID", userID)
 	}
+
+	payload := webhook.Payload{
+		Event:      webhook.BuildSucceeded,
+		SpotifyID:  string(result.spotifyID),
+		TrackCount: result.trackCount,
+	}
+	for i, trackSource := range playlist.Input.TrackSources {
+		payload.Sources = append(payload.Sources, webhook.Source{Name: trackSource.Name, TrackCount: result.sourceCounts[i]})
+	}
+	s.notifyWebhooks(run, payload)
+
+	// Replace Spotify's mosaic with our own cover, the playlist is fine without one though
+	for _, target := range result.targets {
+		err = s.uploadCover(ctx, &client, target.Name, playlist.Input, spotify.ID(target.SpotifyID), user.Location())
+		if err != nil {
+			s.log.Warnw("failed to upload cover image for built playlist", "err", err.Error(), "spotifyID", target.SpotifyID)
+		}
+	}
+
+	// Send the cover along so the dashboard can show it
+	succeeded := events.Event{Type: events.BuildSucceeded}
+	spotifyPlaylist, err := client.GetPlaylistOpt(ctx, result.spotifyID, "images")
+	if err != nil {
+		s.log.Warnw("failed to fetch cover image for built playlist", "err", err.Error(), "spotifyID", result.spotifyID)
+	} else if len(spotifyPlaylist.Images) > 0 {
+		succeeded.ImageURL = spotifyPlaylist.Images[0].URL
+	}
+	s.publish(userID, playlistID, succeeded)
+	return nil
 }
 
-// DeletePlaylist deletes both the actual spotify playlist and the configuration in the db
-func (s *Service) DeletePlaylist(userID, playlistID uuid.UUID) {
-	// Get playlist configuration
-	playlist, err := s.store.GetPlaylist(playlistID)
+// CancelBuild stops any queued or running build of a playlist, doing nothing unless it belongs to userID
+func (s *Service) CancelBuild(ctx context.Context, userID, playlistID uuid.UUID) error {
+	err := s.store.CancelQueuedJobs(ctx, store.BuildJob, userID, playlistID)
 	if err != nil {
-		s.logDeleteError(userID, playlistID, err)
-		return
+		return err
 	}
+	return s.store.RequestCancelBuild(ctx, userID, playlistID)
+}
 
+// DeletePlaylist deletes both the actual spotify playlist and the configuration in the db
+func (s *Service) DeletePlaylist(ctx context.Context, userID, playlistID uuid.UUID) error {
 	// Build spotify client
-	user, err := s.store.GetUserByID(userID)
+	user, err := s.store.GetUserByID(ctx, userID)
 	if err != nil {
 		s.logDeleteError(userID, playlistID, err)
-		return
+		return err
 	}
 	client := s.spotify.NewClient(&user.Token)
 
-	// Unfollow spotify playlist
-	if playlist.SpotifyID != nil {
-		err = client.UnfollowPlaylist(spotify.ID(user.SpotifyID), spotify.ID(*playlist.SpotifyID))
+	// Unfollow every spotify playlist it built that is still kept
+	archived, err := s.store.GetArchivedPlaylists(ctx, playlistID)
+	if err != nil {
+		s.logDeleteError(userID, playlistID, err)
+		return err
+	}
+	for _, a := range archived {
+		err = client.UnfollowPlaylist(ctx, spotify.ID(user.SpotifyID), spotify.ID(a.SpotifyID))
 		if err != nil {
 			s.logDeleteError(userID, playlistID, err)
-			return
+			return err
+		}
+		err = s.store.DeleteArchivedPlaylist(ctx, a.ID)
+		if err != nil {
+			s.logDeleteError(userID, playlistID, err)
+			return err
 		}
 	}
 
 	// Delete playlist configuration
-	err = s.store.DeletePlaylist(playlistID)
+	err = s.store.DeletePlaylist(ctx, playlistID)
 	if err != nil {
 		s.logDeleteError(userID, playlistID, err)
+		return err
+	}
+	return nil
+}
+
+// watchForCancel polls for a cancel request on a building playlist and cancels the build when it sees one
+func (s *Service) watchForCancel(ctx context.Context, playlistID uuid.UUID, cancel context.CancelFunc) {
+	ticker := time.NewTicker(cancelPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			requested, err := s.store.IsCancelRequested(ctx, playlistID)
+			if err != nil {
+				if ctx.Err() == nil {
+					s.log.Warnw("failed to check if build was cancelled", "err", err.Error(), "playlistID", playlistID)
+				}
+				continue
+			}
+			if requested {
+				s.log.Infow("cancelling build", "playlistID", playlistID)
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// unfollowPlaylist removes a spotify playlist on a best effort basis. It runs even
+// after the build's context is done since it is often cleaning up after one.
+func (s *Service) unfollowPlaylist(client *motify.Client, userID string, spotifyPlaylistID spotify.ID) {
+	err := client.UnfollowPlaylist(context.Background(), spotify.ID(userID), spotifyPlaylistID)
+	if err != nil {
+		s.log.Errorw("failed to unfollow playlist", "err", err.Error(), "spotifyID", spotifyPlaylistID)
+	}
+}
+
+// discardResult unfollows the playlists a build created when the build can't be recorded.
+// Appended tracks can't be taken back so an appended playlist is left as it is.
+func (s *Service) discardResult(client *motify.Client, userID string, result *buildResult) {
+	if result.appended {
+		s.log.Warnw("leaving tracks appended by an unfinished build", "spotifyID", result.spotifyID)
 		return
 	}
+	s.unfollowTargets(client, userID, result.targets)
 }
 
-func (s *Service) logBuildError(userID, playlistID uuid.UUID, errIn error) {
+// unfollowTargets unfollows every spotify playlist a build created
+func (s *Service) unfollowTargets(client *motify.Client, userID string, targets []store.OutputTarget) {
+	for _, target := range targets {
+		s.unfollowPlaylist(client, userID, spotify.ID(target.SpotifyID))
+	}
+}
+
+// pruneArchive unfollows all but the newest keep spotify playlists built for a playlist.
+// Playlists that fail to unfollow stay archived so they are tried again after the next build.
+func (s *Service) pruneArchive(client *motify.Client, userID string, playlistID uuid.UUID, keep int) {
+	// The build has already succeeded so don't let its context stop the clean up
+	ctx := context.Background()
+
+	archived, err := s.store.GetArchivedPlaylists(ctx, playlistID)
+	if err != nil {
+		s.log.Errorw("failed to get archived playlists", "err", err.Error(), "playlistID", playlistID)
+		return
+	}
+	if len(archived) <= keep {
+		return
+	}
+	for _, a := range archived[keep:] {
+		err = client.UnfollowPlaylist(ctx, spotify.ID(userID), spotify.ID(a.SpotifyID))
+		if err != nil {
+			s.log.Errorw("failed to unfollow archived playlist", "err", err.Error(), "spotifyID", a.SpotifyID)
+			continue
+		}
+		err = s.store.DeleteArchivedPlaylist(ctx, a.ID)
+		if err != nil {
+			s.log.Errorw("failed to delete archived playlist", "err", err.Error(), "spotifyID", a.SpotifyID)
+		}
+	}
+}
+
+// logBuildError records a failed or cancelled build and returns the error the build should report
+func (s *Service) logBuildError(ctx context.Context, run *buildRun, errIn error) error {
+	// The build's context may be why it failed, so record the outcome on a fresh one
+	recordCtx := context.Background()
+
+	if ctx.Err() != nil {
+		s.log.Infow("build stopped before finishing", "err", ctx.Err().Error(), "playlistID", run.playlistID)
+		err := s.store.UpdatePlaylistCancelledBuild(recordCtx, run.playlistID)
+		if err != nil {
+			s.log.Errorw("failed to update playlist config to cancelled state", "err", err.Error())
+		}
+		s.notifyWebhooks(run, webhook.Payload{Event: webhook.BuildCancelled, Error: ctx.Err().Error()})
+		s.publish(run.userID, run.playlistID, events.Event{Type: events.BuildCancelled})
+		return ctx.Err()
+	}
+
+	if !run.final && !IsPermanent(errIn) {
+		// Another attempt is coming so this one isn't reported as a failed build
+		s.log.Warnw("build attempt failed and will be retried", "err", errIn.Error(), "playlistID", run.playlistID)
+		err := s.store.UpdatePlaylistRetryingBuild(recordCtx, run.playlistID)
+		if err != nil {
+			s.log.Errorw("failed to update playlist config to retrying state", "err", err.Error())
+		}
+		s.publish(run.userID, run.playlistID, events.Event{Type: events.BuildRetrying, Message: errIn.Error()})
+		return errIn
+	}
+
 	s.log.Errorw("failure while building playlist", "err", errIn.Error())
-	err := s.store.UpdatePlaylistBadBuild(playlistID, errIn.Error())
+	err := s.store.UpdatePlaylistBadBuild(recordCtx, run.playlistID, errIn.Error())
 	if err != nil {
 		// This really shouldn't happen, but all we can do is log it
 		s.log.Errorw("failed to update playlist config to failure state", "err", err.Error())
 	}
 
-	err = s.store.IncrementUserBuildCount(userID)
+	err = s.store.IncrementUserBuildCount(recordCtx, run.userID)
 	if err != nil {
 		// This really shouldn't happen, but all we can do is log it
 		s.log.Errorw("failed to increment build count", "err", err.Error())
 	}
+
+	// Nobody is watching scheduled builds so let the user know by email
+	if run.trigger == ScheduledTrigger {
+		err = s.notifier.BuildFailed(recordCtx, run.userID, run.playlistID)
+		if err != nil {
+			s.log.Errorw("failed to notify user of failed build", "err", err.Error(), "playlistID", run.playlistID)
+		}
+	}
+	s.notifyWebhooks(run, webhook.Payload{Event: webhook.BuildFailed, Error: errIn.Error()})
+	s.publish(run.userID, run.playlistID, events.Event{Type: events.BuildFailed, Message: errIn.Error()})
+	return errIn
+}
+
+// notifyWebhooks queues payload for delivery to each of the user's webhooks
+func (s *Service) notifyWebhooks(run *buildRun, payload webhook.Payload) {
+	payload.Trigger = string(run.trigger)
+	payload.Playlist = webhook.Playlist{ID: run.playlistID, Name: run.name}
+	payload.Time = time.Now()
+	b, err := json.Marshal(&payload)
+	if err != nil {
+		s.log.Errorw("failed to marshal webhook payload", "err", err.Error())
+		return
+	}
+
+	err = s.store.QueueWebhookDeliveries(context.Background(), run.userID, run.playlistID, payload.Event, string(b))
+	if err != nil {
+		// Webhooks are a side channel, the build result itself is already recorded
+		s.log.Errorw("failed to queue webhook deliveries", "err", err.Error(), "playlistID", run.playlistID)
+	}
+}
+
+// publish sends a progress event for a playlist build
+func (s *Service) publish(userID, playlistID uuid.UUID, e events.Event) {
+	e.UserID = userID
+	e.PlaylistID = playlistID
+	s.events.Publish(e)
 }
 
 func (s *Service) logDeleteError(userID, playlistID uuid.UUID, errIn error) {
 	s.log.Errorw("failure while deleting playlist", "err", errIn.Error())
-	err := s.store.UpdatePlaylistBadDelete(playlistID, errIn.Error())
+	err := s.store.UpdatePlaylistBadDelete(context.Background(), playlistID, errIn.Error())
 	if err != nil {
 		s.log.Errorw("failed to update playlist config to failure state", "err", err.Error())
 	}
 }
 
-func buildPlaylist(client *motify.Client, userID string, input store.Input, output store.Output) (*spotify.ID, error) {
+func (s *Service) buildPlaylist(ctx context.Context, client *motify.Client, userID string, playlist *store.Playlist, output store.Output, loc *time.Location, report func(events.Event)) (*buildResult, error) {
+	input := playlist.Input
+
+	// Read back the last build to see what changed in it since
+	var previous *previousBuild
+	if playlist.SpotifyID != nil && s.needsPreviousBuild(playlist) {
+		var err error
+		previous, err = readPreviousBuild(ctx, client, spotify.ID(*playlist.SpotifyID))
+		if err != nil && playlist.OutputMode == store.Append {
+			return nil, fmt.Errorf("failed to read previous build: %w", err)
+		} else if err != nil {
+			// The build can go ahead without it, it just can't keep any edits
+			s.log.Warnw("failed to read previous build", "err", err.Error(), "spotifyID", *playlist.SpotifyID)
+		}
+	}
+	editCarried, edits, err := s.findManualEdits(ctx, client, playlist, previous, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find manual edits: %w", err)
+	}
+	excludedIDs, err := s.store.GetExcludedTracks(ctx, playlist.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get excluded tracks: %w", err)
+	}
+	excluded := make(map[spotify.ID]bool, len(excludedIDs))
+	for _, id := range edits.Excluded(excludedIDs) {
+		excluded[spotify.ID(id)] = true
+	}
+
+	// Fetch every source concurrently, each into its own slot so the order of
+	// the sources is preserved. Excluded tracks are skipped as they are picked
+	// so every source still gives its full count.
+	sourceTracks := make([][]spotify.ID, len(input.TrackSources))
+	sourceErrs := make([]error, len(input.TrackSources))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, s.sourceConcurrency)
+	for i, trackSource := range input.TrackSources {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, trackSource store.TrackSource) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fetch := trackFetchers[trackSource.Method][trackSource.Type]
+			if len(trackSource.Filters) > 0 {
+				// Filtered sources have to be narrowed down before anything is picked
+				fetch = (*Service).getFilteredTracks
+			}
+			sourceTracks[i], sourceErrs[i] = fetch(s, ctx, client, trackSource, excluded)
+			if sourceErrs[i] == nil {
+				report(events.Event{Type: events.SourceFetched, Source: trackSource.Name, Count: len(sourceTracks[i])})
+			}
+		}(i, trackSource)
+	}
+	wg.Wait()
+	for i, trackSource := range input.TrackSources {
+		if sourceErrs[i] != nil {
+			return nil, fmt.Errorf("failed to get tracks from %s: %w", trackSource.Name, sourceErrs[i])
+		}
+	}
+
 	var tracks []spotify.ID
-	var err error
+	sourceCounts := make([]int, len(input.TrackSources))
+	sourceOf := make(map[spotify.ID]int)
+	for i := range input.TrackSources {
+		for _, id := range sourceTracks[i] {
+			// Skip invalid uris and tracks the user removed by hand
+			// TODO figure out why some uris are empty
+			if id != "" && !excluded[id] {
+				tracks = append(tracks, id)
+				sourceCounts[i]++
+				if _, ok := sourceOf[id]; !ok {
+					sourceOf[id] = i
+				}
+			}
+		}
+	}
 
-	for _, trackSource := range input.TrackSources {
-		tracks, err = trackFetchers[trackSource.Method][trackSource.Type](client, tracks, trackSource)
+	// Carry over what collaborators added to the last build and then what the owner
+	// added by hand, skipping tracks already picked
+	carried, err := s.carriedOverTracks(ctx, playlist, previous, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tracks added by collaborators: %w", err)
+	}
+	picked := make(map[spotify.ID]bool, len(tracks))
+	for _, id := range tracks {
+		picked[id] = true
+	}
+	for _, id := range carried {
+		if !picked[id] && !excluded[id] {
+			picked[id] = true
+			tracks = append(tracks, id)
+		}
+	}
+	for _, id := range editCarried {
+		if !picked[id] {
+			picked[id] = true
+			tracks = append(tracks, id)
+		}
+	}
+
+	// Pinned tracks go in last so they can be put at their positions
+	tracks = placePins(tracks, edits.Pins(playlist.Input.Pinned))
+
+	// Fill in templated names now that the tracks are known
+	output, err = s.renderOutput(ctx, client, input, output, tracks, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep adding to the previous build when accumulating
+	if playlist.OutputMode == store.Append && previous != nil {
+		dropAllBut := ""
+		if playlist.Collaborative && playlist.CollaboratorPolicy != store.KeepAdded {
+			dropAllBut = userID
+		}
+		trackCount, contents, err := s.appendToPlaylist(ctx, client, previous, tracks, output, playlist.MaxSize, dropAllBut, report)
 		if err != nil {
 			return nil, err
 		}
+		targets := []store.OutputTarget{{Name: output.Name, SpotifyID: string(previous.spotifyID)}}
+		return &buildResult{spotifyID: previous.spotifyID, appended: true, tracks: contents, targets: targets, edits: edits, sourceCounts: sourceCounts, trackCount: trackCount}, nil
 	}
 
-	// Remove any invalid uris from tracks
-	// TODO figure out why some uris are empty
-	deleted := 0
-	for i := range tracks {
-		j := i - deleted
-		if tracks[j] == "" {
-			tracks = tracks[:j+copy(tracks[j:], tracks[j+1:])]
-			deleted++
+	// Build a spotify playlist for each part of the output
+	parts, err := splitTracks(ctx, client, input, output, tracks, sourceOf)
+	if err != nil {
+		return nil, err
+	}
+	var targets []store.OutputTarget
+	added := 0
+	for _, part := range parts {
+		// Report progress across every part rather than each on its own
+		offset := added
+		reportPart := func(e events.Event) {
+			if e.Type == events.TracksAdded {
+				e.Count += offset
+				e.Total = len(tracks)
+			}
+			report(e)
 		}
+		created, err := s.createTarget(ctx, client, userID, output, part, reportPart)
+		if err != nil {
+			s.unfollowTargets(client, userID, targets)
+			return nil, err
+		}
+		targets = append(targets, store.OutputTarget{Position: len(targets), Name: part.name, SpotifyID: string(created)})
+		added += len(part.tracks)
 	}
+	return &buildResult{spotifyID: spotify.ID(targets[0].SpotifyID), tracks: parts[0].tracks, targets: targets, edits: edits, sourceCounts: sourceCounts, trackCount: len(tracks)}, nil
+}
 
-	// Build spotify playlist
-	playlist, err := client.CreatePlaylistForUser(userID, output.Name, output.Description, output.Public)
+// createTarget creates a spotify playlist for one part of the output and adds the part's
+// tracks to it. The playlist is unfollowed again if it can't be filled.
+func (s *Service) createTarget(ctx context.Context, client *motify.Client, userID string, output store.Output, part outputPart, report func(events.Event)) (spotify.ID, error) {
+	created, err := client.CreatePlaylistForUser(ctx, userID, part.name, output.Description, output.Public)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	if output.Collaborative {
+		err = client.ChangePlaylistCollaborative(ctx, created.ID, true)
+		if err != nil {
+			s.unfollowPlaylist(client, userID, created.ID)
+			return "", err
+		}
 	}
 
 	// Add tracks to spotify playlist
-	playlistID, err := addTracksToPlaylist(client, playlist.ID, tracks)
+	_, err = addTracksToPlaylist(ctx, client, created.ID, part.tracks, report)
 	if err != nil {
-		// TODO add clean up logic here to unfollow playlist?
-		return nil, err
+		s.unfollowPlaylist(client, userID, created.ID)
+		return "", err
 	}
-	return playlistID, nil
+	return created.ID, nil
 }
 
-func addTracksToPlaylist(client *motify.Client, playlistID spotify.ID, tracks []spotify.ID) (*spotify.ID, error) {
+// needsPreviousBuild reports whether building playlist depends on what is in its last build
+func (s *Service) needsPreviousBuild(playlist *store.Playlist) bool {
+	if playlist.SplitMode != store.NoSplit {
+		// Split builds are rebuilt from scratch, keeping edits to one part would be a guess
+		return false
+	}
+	return playlist.OutputMode == store.Append ||
+		playlist.EditPolicy != store.IgnoreEdits ||
+		(playlist.Collaborative && playlist.CollaboratorPolicy != store.DropAdded)
+}
+
+// addTracksToPlaylist adds tracks to the end of a playlist and returns the playlist's new snapshot ID
+func addTracksToPlaylist(ctx context.Context, client *motify.Client, playlistID spotify.ID, tracks []spotify.ID, report func(events.Event)) (string, error) {
+	var snapshotID string
 	start := 0
 	stop := 0
 	for {
@@ -220,325 +616,291 @@ func addTracksToPlaylist(client *motify.Client, playlistID spotify.ID, tracks []
 		} else {
 			stop = start + 100
 		}
-		_, err := client.AddTracksToPlaylist(playlistID, tracks[start:stop]...)
+		var err error
+		snapshotID, err = client.AddTracksToPlaylist(ctx, playlistID, tracks[start:stop]...)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
+		report(events.Event{Type: events.TracksAdded, Count: stop, Total: len(tracks)})
 	}
-	return &playlistID, nil
+	return snapshotID, nil
 }
 
-func getTopAlbumTracks(client *motify.Client, tracks []spotify.ID, trackSource store.TrackSource) ([]spotify.ID, error) {
-	offset := 0
-	var limit int
-
-	for {
-		if trackSource.Count-offset <= 0 {
-			break
-		} else if trackSource.Count-offset < 50 {
-			limit = trackSource.Count - offset
-		} else {
-			limit = 50
-		}
-		opts := spotify.Options{
-			Limit:  &limit,
-			Offset: &offset,
-		}
-
-		trackPage, err := client.GetAlbumTracksOpt(spotify.ID(trackSource.ID), &opts)
-		if err != nil {
-			return nil, err
-		} else if len(trackPage.Tracks) != limit {
-			// Not enough songs
-			return nil, fmt.Errorf("Expected to find %d songs in album but only found %d", trackSource.Count, len(trackPage.Tracks))
-		}
-
-		offset += limit
-
-		for _, track := range trackPage.Tracks {
-			if strings.Contains(track.Endpoint, "tracks") {
-				tracks = append(tracks, track.ID)
-			}
-		}
+func (s *Service) getTopAlbumTracks(ctx context.Context, client *motify.Client, trackSource store.TrackSource, excluded map[spotify.ID]bool) ([]spotify.ID, error) {
+	total, err := albumTotal(ctx, client, trackSource)
+	if err != nil {
+		return nil, err
 	}
-	return tracks, nil
+	return takeLatest(trackSource.Count, total, albumPages(ctx, client, trackSource), excluded)
 }
 
-func getTopLikedTracks(client *motify.Client, tracks []spotify.ID, trackSource store.TrackSource) ([]spotify.ID, error) {
-	offset := 0
-	var limit int
+func (s *Service) getTopLikedTracks(ctx context.Context, client *motify.Client, trackSource store.TrackSource, excluded map[spotify.ID]bool) ([]spotify.ID, error) {
+	total, err := likedTotal(ctx, client, trackSource)
+	if err != nil {
+		return nil, err
+	}
+	return takeLatest(trackSource.Count, total, likedPages(ctx, client, trackSource), excluded)
+}
 
-	for {
-		if trackSource.Count-offset <= 0 {
-			break
-		} else if trackSource.Count-offset < 50 {
-			limit = trackSource.Count - offset
-		} else {
-			limit = 50
-		}
-		opts := spotify.Options{
-			Limit:  &limit,
-			Offset: &offset,
-		}
+func (s *Service) getTopPlaylistTracks(ctx context.Context, client *motify.Client, trackSource store.TrackSource, excluded map[spotify.ID]bool) ([]spotify.ID, error) {
+	fetch, total, err := s.playlistFetcher(ctx, client, trackSource)
+	if err != nil {
+		return nil, err
+	}
+	return takeLatest(trackSource.Count, total, fetch, excluded)
+}
 
-		trackPage, err := client.CurrentUsersTracksOpt(&opts)
-		if err != nil {
-			return nil, err
-		} else if len(trackPage.Tracks) != limit {
-			// Not enough songs
-			return nil, fmt.Errorf("Expected to find %d songs in Liked Songs but only found %d", trackSource.Count, len(trackPage.Tracks))
-		}
+func (s *Service) getRandomAlbumTracks(ctx context.Context, client *motify.Client, trackSource store.TrackSource, excluded map[spotify.ID]bool) ([]spotify.ID, error) {
+	total, err := albumTotal(ctx, client, trackSource)
+	if err != nil {
+		return nil, err
+	}
+	// Only pull the pages of the album holding the random tracks
+	return sampleTracks(trackSource.Count, total, albumPages(ctx, client, trackSource), excluded)
+}
 
-		offset += limit
+func (s *Service) getRandomLikedTracks(ctx context.Context, client *motify.Client, trackSource store.TrackSource, excluded map[spotify.ID]bool) ([]spotify.ID, error) {
+	total, err := likedTotal(ctx, client, trackSource)
+	if err != nil {
+		return nil, err
+	}
+	// Only pull the pages of liked songs holding the random tracks
+	return sampleTracks(trackSource.Count, total, likedPages(ctx, client, trackSource), excluded)
+}
 
-		for _, track := range trackPage.Tracks {
-			if strings.Contains(track.Endpoint, "tracks") {
-				tracks = append(tracks, track.ID)
-			}
-		}
+func (s *Service) getRandomPlaylistTracks(ctx context.Context, client *motify.Client, trackSource store.TrackSource, excluded map[spotify.ID]bool) ([]spotify.ID, error) {
+	fetch, total, err := s.playlistFetcher(ctx, client, trackSource)
+	if err != nil {
+		return nil, err
 	}
-	return tracks, nil
+	return sampleTracks(trackSource.Count, total, fetch, excluded)
 }
 
-func getTopPlaylistTracks(client *motify.Client, tracks []spotify.ID, trackSource store.TrackSource) ([]spotify.ID, error) {
+// albumTotal returns how many tracks an album source has, checking it has enough for its count
+func albumTotal(ctx context.Context, client *motify.Client, trackSource store.TrackSource) (int, error) {
 	offset := 0
-	var limit int
+	limit := 1
+	opts := spotify.Options{
+		Limit:  &limit,
+		Offset: &offset,
+	}
+	trackPage, err := client.GetAlbumTracksOpt(ctx, spotify.ID(trackSource.ID), &opts)
+	if err != nil {
+		return 0, err
+	}
+	if trackPage.Total < trackSource.Count {
+		// Not enough songs
+		return 0, configErrorf("Expected to find %d songs in album but only found %d", trackSource.Count, trackPage.Total)
+	}
+	return trackPage.Total, nil
+}
 
-	for {
-		if trackSource.Count-offset <= 0 {
-			break
-		} else if trackSource.Count-offset < 50 {
-			limit = trackSource.Count - offset
-		} else {
-			limit = 50
-		}
+// albumPages returns a pageFetcher for the tracks of an album source
+func albumPages(ctx context.Context, client *motify.Client, trackSource store.TrackSource) pageFetcher {
+	return func(offset, limit int) ([]spotify.ID, error) {
 		opts := spotify.Options{
 			Limit:  &limit,
 			Offset: &offset,
 		}
-
-		trackPage, err := client.GetPlaylistTracksOpt(spotify.ID(trackSource.ID), &opts, "items(track(id, href))")
+		trackPage, err := client.GetAlbumTracksOpt(ctx, spotify.ID(trackSource.ID), &opts)
 		if err != nil {
 			return nil, err
 		} else if len(trackPage.Tracks) != limit {
 			// Not enough songs
-			return nil, fmt.Errorf("Expected to find %d songs in playlist but only found %d", trackSource.Count, len(trackPage.Tracks))
+			return nil, configErrorf("Expected to find %d songs in album but only found %d", offset+limit, offset+len(trackPage.Tracks))
 		}
 
-		offset += limit
-
-		for _, track := range trackPage.Tracks {
-			if strings.Contains(track.Track.Endpoint, "tracks") {
-				tracks = append(tracks, track.Track.ID)
+		page := make([]spotify.ID, len(trackPage.Tracks))
+		for i, track := range trackPage.Tracks {
+			if strings.Contains(track.Endpoint, "tracks") {
+				page[i] = track.ID
 			}
 		}
+		return page, nil
 	}
-	return tracks, nil
 }
 
-func getRandomAlbumTracks(client *motify.Client, tracks []spotify.ID, trackSource store.TrackSource) ([]spotify.ID, error) {
-	// Find the total number of album tracks
+// likedTotal returns how many liked songs the user has, checking there are enough for the source's count
+func likedTotal(ctx context.Context, client *motify.Client, trackSource store.TrackSource) (int, error) {
 	offset := 0
 	limit := 1
 	opts := spotify.Options{
 		Limit:  &limit,
 		Offset: &offset,
 	}
-	trackPage, err := client.GetAlbumTracksOpt(spotify.ID(trackSource.ID), &opts)
+	trackPage, err := client.CurrentUsersTracksOpt(ctx, &opts)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	totalTracks := trackPage.Total
-	if totalTracks < trackSource.Count {
+	if trackPage.Total < trackSource.Count {
 		// Not enough songs
-		return nil, fmt.Errorf("Expected to find %d songs in album but only found %d", trackSource.Count, totalTracks)
+		return 0, configErrorf("Expected to find %d songs in Liked Songs but only found %d", trackSource.Count, trackPage.Total)
 	}
+	return trackPage.Total, nil
+}
 
-	// Generate a set of random tracks to pull
-	idx := 0
-	randomOffsets := generateRandomOffsets(trackSource.Count, totalTracks)
-
-	// Iterate over all tracks in album and pull the random ones
-	for {
-		if totalTracks-offset <= 0 {
-			break
-		} else if totalTracks-offset < 50 {
-			limit = totalTracks - offset
-		} else {
-			limit = 50
-		}
+// likedPages returns a pageFetcher for the user's liked songs
+func likedPages(ctx context.Context, client *motify.Client, trackSource store.TrackSource) pageFetcher {
+	return func(offset, limit int) ([]spotify.ID, error) {
 		opts := spotify.Options{
 			Limit:  &limit,
 			Offset: &offset,
 		}
-
-		trackPage, err := client.GetAlbumTracksOpt(spotify.ID(trackSource.ID), &opts)
+		trackPage, err := client.CurrentUsersTracksOpt(ctx, &opts)
 		if err != nil {
 			return nil, err
 		} else if len(trackPage.Tracks) != limit {
 			// Not enough songs
-			return nil, fmt.Errorf("Expected to find %d songs in album but only found %d", trackSource.Count, len(trackPage.Tracks))
+			return nil, configErrorf("Expected to find %d songs in Liked Songs but only found %d", offset+limit, offset+len(trackPage.Tracks))
 		}
 
-		finishEarly := false
+		page := make([]spotify.ID, len(trackPage.Tracks))
 		for i, track := range trackPage.Tracks {
-			if idx >= len(randomOffsets) {
-				finishEarly = true
-				break
-			} else if randomOffsets[idx] == offset+i {
-				idx++
-				if strings.Contains(track.Endpoint, "tracks") {
-					tracks = append(tracks, track.ID)
-				}
+			if strings.Contains(track.Endpoint, "tracks") {
+				page[i] = track.ID
 			}
 		}
-
-		offset += limit
-
-		if finishEarly {
-			break
-		}
+		return page, nil
 	}
-	return tracks, nil
 }
 
-func getRandomLikedTracks(client *motify.Client, tracks []spotify.ID, trackSource store.TrackSource) ([]spotify.ID, error) {
-	// Find the total number of liked song tracks
-	offset := 0
-	limit := 1
-	opts := spotify.Options{
-		Limit:  &limit,
-		Offset: &offset,
-	}
-	trackPage, err := client.CurrentUsersTracksOpt(&opts)
+// playlistFetcher returns a pageFetcher for a playlist source along with how many items the
+// playlist has. Pages come from the cached listing when there is one for the current snapshot
+// and otherwise only the pages needed are fetched, the whole playlist is never listed.
+func (s *Service) playlistFetcher(ctx context.Context, client *motify.Client, trackSource store.TrackSource) (pageFetcher, int, error) {
+	listing, total, err := s.getCachedPlaylistListing(ctx, client, spotify.ID(trackSource.ID))
 	if err != nil {
-		return nil, err
-	}
-	totalTracks := trackPage.Total
-	if totalTracks < trackSource.Count {
+		return nil, 0, err
+	} else if total < trackSource.Count {
 		// Not enough songs
-		return nil, fmt.Errorf("Expected to find %d songs in Liked Songs but only found %d", trackSource.Count, totalTracks)
+		return nil, 0, configErrorf("Expected to find %d songs in playlist but only found %d", trackSource.Count, total)
 	}
+	if listing != nil {
+		return func(offset, limit int) ([]spotify.ID, error) {
+			return listing[offset : offset+limit], nil
+		}, len(listing), nil
+	}
+	return playlistPages(ctx, client, trackSource), total, nil
+}
 
-	// Generate a set of random tracks to pull
-	idx := 0
-	randomOffsets := generateRandomOffsets(trackSource.Count, totalTracks)
-
-	// Iterate over all tracks in liked songs and pull the random ones
-	for {
-		if totalTracks-offset <= 0 {
-			break
-		} else if totalTracks-offset < 50 {
-			limit = totalTracks - offset
-		} else {
-			limit = 50
-		}
+// playlistPages returns a pageFetcher for the tracks of a playlist source
+func playlistPages(ctx context.Context, client *motify.Client, trackSource store.TrackSource) pageFetcher {
+	return func(offset, limit int) ([]spotify.ID, error) {
 		opts := spotify.Options{
 			Limit:  &limit,
 			Offset: &offset,
 		}
-
-		trackPage, err := client.CurrentUsersTracksOpt(&opts)
+		trackPage, err := client.GetPlaylistTracksOpt(ctx, spotify.ID(trackSource.ID), &opts, "items(track(id, href))")
 		if err != nil {
-			fmt.Println(err)
 			return nil, err
 		} else if len(trackPage.Tracks) != limit {
 			// Not enough songs
-			return nil, fmt.Errorf("Expected to find %d songs in Liked Songs but only found %d", trackSource.Count, len(trackPage.Tracks))
+			return nil, configErrorf("Expected to find %d songs in playlist but only found %d", offset+limit, offset+len(trackPage.Tracks))
 		}
 
-		finishEarly := false
+		page := make([]spotify.ID, len(trackPage.Tracks))
 		for i, track := range trackPage.Tracks {
-			if idx >= len(randomOffsets) {
-				finishEarly = true
-				break
-			} else if randomOffsets[idx] == offset+i {
-				idx++
-				if strings.Contains(track.Endpoint, "tracks") {
-					tracks = append(tracks, track.ID)
-				}
+			if strings.Contains(track.Track.Endpoint, "tracks") {
+				page[i] = track.Track.ID
 			}
 		}
+		return page, nil
+	}
+}
 
-		offset += limit
-
-		if finishEarly {
-			break
-		}
+// getCachedPlaylistListing returns how many items a playlist has along with its cached
+// listing, or a nil listing when none is cached for the playlist's current snapshot.
+// Unlike getPlaylistListing it never pages through the playlist itself.
+func (s *Service) getCachedPlaylistListing(ctx context.Context, client *motify.Client, playlistID spotify.ID) ([]spotify.ID, int, error) {
+	playlist, err := client.GetPlaylistOpt(ctx, playlistID, "snapshot_id,tracks.total")
+	if err != nil {
+		return nil, 0, err
 	}
-	return tracks, nil
+	return s.cachedListing(ctx, playlistID, playlist.SnapshotID), playlist.Tracks.Total, nil
 }
 
-func getRandomPlaylistTracks(client *motify.Client, tracks []spotify.ID, trackSource store.TrackSource) ([]spotify.ID, error) {
-	// Find the total number of playlist tracks
-	offset := 0
-	limit := 1
-	opts := spotify.Options{
-		Limit:  &limit,
-		Offset: &offset,
+// getPlaylistListing returns every track in a playlist, for the paths that need all of them
+// like filters and manual edits. The listing is cached by snapshot ID so it is only paged
+// through again once the playlist changes.
+func (s *Service) getPlaylistListing(ctx context.Context, client *motify.Client, playlistID spotify.ID) ([]spotify.ID, error) {
+	playlist, err := client.GetPlaylistOpt(ctx, playlistID, "snapshot_id")
+	if err != nil {
+		return nil, err
 	}
-	trackPage, err := client.GetPlaylistTracksOpt(spotify.ID(trackSource.ID), &opts, "total")
+
+	if listing := s.cachedListing(ctx, playlistID, playlist.SnapshotID); listing != nil {
+		return listing, nil
+	}
+
+	items, err := pagePlaylist(ctx, client, playlistID)
 	if err != nil {
 		return nil, err
 	}
-	totalTracks := trackPage.Total
-	if totalTracks < trackSource.Count {
-		// Not enough songs
-		return nil, fmt.Errorf("Expected to find %d songs in playlist but only found %d", trackSource.Count, totalTracks)
+	listing := make([]spotify.ID, len(items))
+	ids := make([]string, len(items))
+	for i, item := range items {
+		listing[i] = item.id
+		ids[i] = string(item.id)
 	}
 
-	// Generate a set of random tracks to pull
-	idx := 0
-	randomOffsets := generateRandomOffsets(trackSource.Count, totalTracks)
+	err = s.store.PutSourceTracks(ctx, string(playlistID), playlist.SnapshotID, ids)
+	if err != nil {
+		s.log.Warnw("failed to cache playlist tracks", "err", err.Error(), "spotifyID", playlistID)
+	}
+	return listing, nil
+}
 
-	// Iterate over all tracks in playlist and pull the random ones
+// cachedListing returns the cached listing of a playlist at snapshotID or nil if there isn't one
+func (s *Service) cachedListing(ctx context.Context, playlistID spotify.ID, snapshotID string) []spotify.ID {
+	cached, err := s.store.GetSourceTracks(ctx, string(playlistID))
+	if err != nil {
+		// A broken cache shouldn't break the build, the playlist is fetched instead
+		s.log.Warnw("failed to get cached playlist tracks", "err", err.Error(), "spotifyID", playlistID)
+		return nil
+	} else if cached == nil || cached.SnapshotID != snapshotID {
+		return nil
+	}
+	listing := make([]spotify.ID, len(cached.Tracks))
+	for i, track := range cached.Tracks {
+		listing[i] = spotify.ID(track)
+	}
+	return listing
+}
+
+// playlistItem is an entry in a playlist
+type playlistItem struct {
+	id      spotify.ID // Empty for items that aren't tracks
+	addedBy string     // Spotify ID of the user who added the item
+}
+
+// pagePlaylist pages through every item in a playlist. Items that aren't tracks,
+// such as episodes and local files, are returned with empty IDs to hold their place.
+func pagePlaylist(ctx context.Context, client *motify.Client, playlistID spotify.ID) ([]playlistItem, error) {
+	var items []playlistItem
+	offset := 0
+	limit := 100
 	for {
-		if totalTracks-offset <= 0 {
-			break
-		} else if totalTracks-offset < 50 {
-			limit = totalTracks - offset
-		} else {
-			limit = 50
-		}
 		opts := spotify.Options{
 			Limit:  &limit,
 			Offset: &offset,
 		}
-
-		trackPage, err := client.GetPlaylistTracksOpt(spotify.ID(trackSource.ID), &opts, "items(track(id, href))")
+		trackPage, err := client.GetPlaylistTracksOpt(ctx, playlistID, &opts, "items(added_by(id), track(id, href)),total")
 		if err != nil {
 			return nil, err
-		} else if len(trackPage.Tracks) != limit {
-			// Not enough songs
-			return nil, fmt.Errorf("Expected to find %d songs in playlist but only found %d", trackSource.Count, len(trackPage.Tracks))
 		}
 
-		finishEarly := false
-		for i, track := range trackPage.Tracks {
-			if idx >= len(randomOffsets) {
-				finishEarly = true
-				break
-			} else if randomOffsets[idx] == offset+i {
-				idx++
-				if strings.Contains(track.Track.Endpoint, "tracks") {
-					tracks = append(tracks, track.Track.ID)
-				}
+		for _, track := range trackPage.Tracks {
+			item := playlistItem{addedBy: track.AddedBy.ID}
+			if strings.Contains(track.Track.Endpoint, "tracks") {
+				item.id = track.Track.ID
 			}
+			items = append(items, item)
 		}
 
-		offset += limit
-
-		if finishEarly {
+		offset += len(trackPage.Tracks)
+		if len(trackPage.Tracks) == 0 || offset >= trackPage.Total {
 			break
 		}
 	}
-	return tracks, nil
-}
-
-func generateRandomOffsets(n, N int) []int {
-	rand.Seed(time.Now().UnixNano())
-	p := rand.Perm(N)
-	out := p[:n]
-	sort.Ints(out)
-	return out
+	return items, nil
 }
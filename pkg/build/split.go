@@ -0,0 +1,238 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zmb3/spotify"
+
+	"github.com/calebschoepp/playlist-rotator/pkg/motify"
+	"github.com/calebschoepp/playlist-rotator/pkg/naming"
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+)
+
+// MaxSplitTargets caps how many spotify playlists a single build is split into
+const MaxSplitTargets = 10
+
+// otherBucket holds the tracks that fit no decade or genre, or too small a one
+const otherBucket = "Other"
+
+// outputPart is the share of a build's tracks that goes into one spotify playlist
+type outputPart struct {
+	name   string
+	tracks []spotify.ID
+}
+
+// splitTracks divides tracks between the spotify playlists output is split into. There is
+// always at least one part and never more than MaxSplitTargets, any tracks past that go
+// in the last part. sourceOf maps each track to the index of the source it came from.
+func splitTracks(ctx context.Context, client *motify.Client, input store.Input, output store.Output, tracks []spotify.ID, sourceOf map[spotify.ID]int) ([]outputPart, error) {
+	switch output.Split {
+	case store.SplitBySize:
+		var parts []outputPart
+		for start := 0; start < len(tracks); {
+			stop := start + output.SplitSize
+			if stop > len(tracks) || len(parts) == MaxSplitTargets-1 {
+				stop = len(tracks)
+			}
+			label := fmt.Sprintf("Part %d", len(parts)+1)
+			parts = append(parts, outputPart{name: partName(output.Name, label), tracks: tracks[start:stop]})
+			start = stop
+		}
+		if len(parts) == 0 {
+			parts = append(parts, outputPart{name: partName(output.Name, "Part 1")})
+		}
+		return parts, nil
+	case store.SplitBySource:
+		parts := make([]outputPart, len(input.TrackSources))
+		for i, trackSource := range input.TrackSources {
+			parts[i].name = partName(output.Name, trackSource.Name)
+		}
+		for _, id := range tracks {
+			// Carried over and pinned tracks go with the first source
+			i := sourceOf[id]
+			if i >= MaxSplitTargets {
+				i = MaxSplitTargets - 1
+			}
+			parts[i].tracks = append(parts[i].tracks, id)
+		}
+		if len(parts) > MaxSplitTargets {
+			parts = parts[:MaxSplitTargets]
+		}
+		return dropEmptyParts(parts, output.Name), nil
+	case store.SplitByDecade:
+		labels, err := trackDecades(ctx, client, tracks)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find release dates: %w", err)
+		}
+		return bucketParts(output.Name, tracks, labels, func(a, b string) bool { return a < b }), nil
+	case store.SplitByGenre:
+		labels, err := trackGenres(ctx, client, tracks)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find genres: %w", err)
+		}
+		return bucketParts(output.Name, tracks, labels, nil), nil
+	default:
+		return []outputPart{{name: output.Name, tracks: tracks}}, nil
+	}
+}
+
+// bucketParts puts tracks in one part per label, labels holding the label of each track.
+// When there are too many labels the smallest ones are merged into a part for the rest.
+// Parts are ordered by less, or from biggest to smallest when it is nil.
+func bucketParts(name string, tracks []spotify.ID, labels []string, less func(a, b string) bool) []outputPart {
+	counts := make(map[string]int)
+	for _, label := range labels {
+		counts[label]++
+	}
+	var kept []string
+	for label := range counts {
+		if label != "" {
+			kept = append(kept, label)
+		}
+	}
+	bySize := func(i, j int) bool {
+		if counts[kept[i]] != counts[kept[j]] {
+			return counts[kept[i]] > counts[kept[j]]
+		}
+		return kept[i] < kept[j]
+	}
+	sort.Slice(kept, bySize)
+	room := MaxSplitTargets
+	if counts[""] > 0 || len(kept) > MaxSplitTargets {
+		room--
+	}
+	if len(kept) > room {
+		kept = kept[:room]
+	}
+	if less != nil {
+		sort.Slice(kept, func(i, j int) bool { return less(kept[i], kept[j]) })
+	}
+
+	index := make(map[string]int, len(kept))
+	parts := make([]outputPart, len(kept)+1)
+	for i, label := range kept {
+		index[label] = i
+		parts[i].name = partName(name, label)
+	}
+	other := len(kept)
+	parts[other].name = partName(name, otherBucket)
+	for i, id := range tracks {
+		part, ok := index[labels[i]]
+		if !ok {
+			part = other
+		}
+		parts[part].tracks = append(parts[part].tracks, id)
+	}
+	return dropEmptyParts(parts, name)
+}
+
+// dropEmptyParts leaves out parts without any tracks, keeping one if they are all empty
+func dropEmptyParts(parts []outputPart, name string) []outputPart {
+	var kept []outputPart
+	for _, part := range parts {
+		if len(part.tracks) > 0 {
+			kept = append(kept, part)
+		}
+	}
+	if len(kept) == 0 {
+		return []outputPart{{name: name}}
+	}
+	return kept
+}
+
+// partName names one part of a split playlist, shortening the playlist's name so the
+// label still fits within Spotify's limit
+func partName(name, label string) string {
+	suffix := []rune(" - " + label)
+	if len(suffix) >= naming.NameLimit {
+		suffix = suffix[:naming.NameLimit/2]
+	}
+	runes := []rune(name)
+	if len(runes)+len(suffix) > naming.NameLimit {
+		runes = []rune(strings.TrimSpace(string(runes[:naming.NameLimit-len(suffix)])))
+	}
+	return string(runes) + string(suffix)
+}
+
+// trackDecades returns the decade each track's album was released in, like "1990s",
+// or an empty string when it isn't known
+func trackDecades(ctx context.Context, client *motify.Client, tracks []spotify.ID) ([]string, error) {
+	labels := make([]string, len(tracks))
+	err := forEachFullTrack(ctx, client, tracks, func(i int, track *spotify.FullTrack) {
+		if track == nil || len(track.Album.ReleaseDate) < 4 {
+			return
+		}
+		year := track.Album.ReleaseDate[:4]
+		labels[i] = year[:3] + "0s"
+	})
+	if err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// trackGenres returns the main genre of the artist credited first on each track, or an
+// empty string when the artist has no genres
+func trackGenres(ctx context.Context, client *motify.Client, tracks []spotify.ID) ([]string, error) {
+	artistOf := make([]spotify.ID, len(tracks))
+	var artists []spotify.ID
+	seen := make(map[spotify.ID]bool)
+	err := forEachFullTrack(ctx, client, tracks, func(i int, track *spotify.FullTrack) {
+		if track == nil || len(track.Artists) == 0 {
+			return
+		}
+		artistOf[i] = track.Artists[0].ID
+		if !seen[artistOf[i]] {
+			seen[artistOf[i]] = true
+			artists = append(artists, artistOf[i])
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	genreOf := make(map[spotify.ID]string, len(artists))
+	for start := 0; start < len(artists); start += 50 {
+		stop := start + 50
+		if stop > len(artists) {
+			stop = len(artists)
+		}
+		fullArtists, err := client.GetArtists(ctx, artists[start:stop]...)
+		if err != nil {
+			return nil, err
+		}
+		for _, artist := range fullArtists {
+			if artist != nil && len(artist.Genres) > 0 {
+				genreOf[artist.ID] = artist.Genres[0]
+			}
+		}
+	}
+
+	labels := make([]string, len(tracks))
+	for i, artist := range artistOf {
+		labels[i] = genreOf[artist]
+	}
+	return labels, nil
+}
+
+// forEachFullTrack looks up tracks in batches and calls fn with each track's index and
+// details, which are nil for tracks Spotify doesn't know
+func forEachFullTrack(ctx context.Context, client *motify.Client, tracks []spotify.ID, fn func(i int, track *spotify.FullTrack)) error {
+	for start := 0; start < len(tracks); start += 50 {
+		stop := start + 50
+		if stop > len(tracks) {
+			stop = len(tracks)
+		}
+		fullTracks, err := client.GetTracks(ctx, tracks[start:stop]...)
+		if err != nil {
+			return err
+		}
+		for i, track := range fullTracks {
+			fn(start+i, track)
+		}
+	}
+	return nil
+}
@@ -1,12 +1,13 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"strconv"
 	"time"
 )
 
-// Config holds the settings used by the serve and build commands
+// Config holds the settings used by the serve, build and worker commands
 type Config struct {
 	ClientID            string
 	ClientSecret        string
@@ -18,6 +19,21 @@ type Config struct {
 	SessionCookieExpiry time.Duration
 	OauthRedirectURL    string
 	Environment         string
+	SourceConcurrency   int
+
+	SchedulerConcurrency     int
+	SchedulerUserConcurrency int
+	SchedulerBudget          time.Duration
+
+	WorkerConcurrency  int
+	WorkerPollInterval time.Duration
+	ShutdownGrace      time.Duration
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
 }
 
 // New returns a Config struct with sane defaults and env variable overrides
@@ -33,6 +49,21 @@ func New() (*Config, error) {
 		SessionCookieExpiry: 60 * time.Minute,
 		OauthRedirectURL:    "",
 		Environment:         "local",
+		SourceConcurrency:   4,
+
+		SchedulerConcurrency:     4,
+		SchedulerUserConcurrency: 1,
+		SchedulerBudget:          30 * time.Minute,
+
+		WorkerConcurrency:  2,
+		WorkerPollInterval: 5 * time.Second,
+		ShutdownGrace:      25 * time.Second,
+
+		SMTPHost:     "",
+		SMTPPort:     587,
+		SMTPUsername: "",
+		SMTPPassword: "",
+		SMTPFrom:     "",
 	}
 
 	if clientID, present := os.LookupEnv("CLIENT_ID"); present {
@@ -77,6 +108,89 @@ func New() (*Config, error) {
 	if environment, present := os.LookupEnv("ENVIRONMENT"); present {
 		config.Environment = environment
 	}
+	if sourceConcurrency, present := os.LookupEnv("SOURCE_CONCURRENCY"); present {
+		var err error
+		config.SourceConcurrency, err = strconv.Atoi(sourceConcurrency)
+		if err != nil {
+			return nil, err
+		}
+		if config.SourceConcurrency < 1 {
+			return nil, errors.New("SOURCE_CONCURRENCY must be at least 1")
+		}
+	}
+	if schedulerConcurrency, present := os.LookupEnv("SCHEDULER_CONCURRENCY"); present {
+		var err error
+		config.SchedulerConcurrency, err = strconv.Atoi(schedulerConcurrency)
+		if err != nil {
+			return nil, err
+		}
+		if config.SchedulerConcurrency < 1 {
+			return nil, errors.New("SCHEDULER_CONCURRENCY must be at least 1")
+		}
+	}
+	if schedulerUserConcurrency, present := os.LookupEnv("SCHEDULER_USER_CONCURRENCY"); present {
+		var err error
+		config.SchedulerUserConcurrency, err = strconv.Atoi(schedulerUserConcurrency)
+		if err != nil {
+			return nil, err
+		}
+		if config.SchedulerUserConcurrency < 1 {
+			return nil, errors.New("SCHEDULER_USER_CONCURRENCY must be at least 1")
+		}
+	}
+	if schedulerBudgetString, present := os.LookupEnv("SCHEDULER_BUDGET"); present {
+		schedulerBudget, err := time.ParseDuration(schedulerBudgetString)
+		if err != nil {
+			return nil, err
+		}
+		config.SchedulerBudget = schedulerBudget
+	}
+	if workerConcurrency, present := os.LookupEnv("WORKER_CONCURRENCY"); present {
+		var err error
+		config.WorkerConcurrency, err = strconv.Atoi(workerConcurrency)
+		if err != nil {
+			return nil, err
+		}
+		if config.WorkerConcurrency < 1 {
+			return nil, errors.New("WORKER_CONCURRENCY must be at least 1")
+		}
+	}
+	if workerPollIntervalString, present := os.LookupEnv("WORKER_POLL_INTERVAL"); present {
+		workerPollInterval, err := time.ParseDuration(workerPollIntervalString)
+		if err != nil {
+			return nil, err
+		}
+		config.WorkerPollInterval = workerPollInterval
+	}
+	if shutdownGraceString, present := os.LookupEnv("SHUTDOWN_GRACE"); present {
+		shutdownGrace, err := time.ParseDuration(shutdownGraceString)
+		if err != nil {
+			return nil, err
+		}
+		config.ShutdownGrace = shutdownGrace
+	}
+	if smtpHost, present := os.LookupEnv("SMTP_HOST"); present {
+		config.SMTPHost = smtpHost
+	}
+	if smtpPort, present := os.LookupEnv("SMTP_PORT"); present {
+		var err error
+		config.SMTPPort, err = strconv.Atoi(smtpPort)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if smtpUsername, present := os.LookupEnv("SMTP_USERNAME"); present {
+		config.SMTPUsername = smtpUsername
+	}
+	if smtpPassword, present := os.LookupEnv("SMTP_PASSWORD"); present {
+		config.SMTPPassword = smtpPassword
+	}
+	if smtpFrom, present := os.LookupEnv("SMTP_FROM"); present {
+		config.SMTPFrom = smtpFrom
+	}
+	if config.SMTPHost != "" && config.SMTPFrom == "" {
+		return nil, errors.New("SMTP_FROM must be set when SMTP_HOST is")
+	}
 
 	return &config, nil
 }
@@ -0,0 +1,169 @@
+// Package cover draws the cover art uploaded for built playlists. It only uses the
+// standard library so covers can be composed without talking to Spotify.
+package cover
+
+import (
+	"bytes"
+	"errors"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"strings"
+)
+
+// Size is the width and height of a cover in pixels
+const Size = 640
+
+// MaxBytes is the largest cover Spotify accepts, once base64 encoded
+const MaxBytes = 256 * 1024
+
+const (
+	margin       = 32
+	bandPadding  = 24
+	lineSpacing  = 16
+	maxTitleSize = 8
+	minTitleSize = 3
+	subtitleSize = 3
+)
+
+// Compose lays out up to nine source covers in a grid and overlays the title and
+// subtitle along the bottom. Without any source covers the background is a solid
+// color picked from the title so the same playlist always looks the same.
+func Compose(sources []image.Image, title, subtitle string) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, Size, Size))
+
+	if len(sources) == 0 {
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(titleColor(title)), image.Point{}, draw.Src)
+	} else {
+		side := 1
+		if len(sources) >= 9 {
+			side = 3
+		} else if len(sources) >= 2 {
+			side = 2
+		}
+		cell := Size / side
+		for i := 0; i < side*side; i++ {
+			// Repeat sources to fill the grid when there aren't enough of them
+			src := sources[i%len(sources)]
+			x, y := (i%side)*cell, (i/side)*cell
+			scaleInto(dst, image.Rect(x, y, x+cell, y+cell), src)
+		}
+	}
+
+	title, scale := fitTitle(title)
+
+	// Darken a band behind the text so it reads over any artwork
+	bandHeight := bandPadding*2 + glyphHeight*scale
+	if subtitle != "" {
+		bandHeight += lineSpacing + glyphHeight*subtitleSize
+	}
+	band := image.Rect(0, Size-bandHeight, Size, Size)
+	draw.Draw(dst, band, image.NewUniform(color.RGBA{0, 0, 0, 160}), image.Point{}, draw.Over)
+
+	white := color.RGBA{255, 255, 255, 255}
+	y := band.Min.Y + bandPadding
+	drawText(dst, image.Pt(margin, y), title, scale, white)
+	if subtitle != "" {
+		y += glyphHeight*scale + lineSpacing
+		drawText(dst, image.Pt(margin, y), subtitle, subtitleSize, color.RGBA{200, 200, 200, 255})
+	}
+	return dst
+}
+
+// fitTitle picks the largest scale title fits on one line at, trimming it if even the smallest doesn't
+func fitTitle(title string) (string, int) {
+	scale := maxTitleSize
+	for scale > minTitleSize && textWidth(title, scale) > Size-2*margin {
+		scale--
+	}
+	if textWidth(title, scale) > Size-2*margin {
+		runes := []rune(title)
+		for len(runes) > 0 && textWidth(string(runes)+"...", scale) > Size-2*margin {
+			runes = runes[:len(runes)-1]
+		}
+		title = strings.TrimRight(string(runes), " ") + "..."
+	}
+	return title, scale
+}
+
+// Encode returns img as a JPEG small enough for Spotify to accept
+func Encode(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	for quality := 90; quality >= 30; quality -= 15 {
+		buf.Reset()
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+		if err != nil {
+			return nil, err
+		}
+		// Spotify's limit applies to the base64 encoded upload
+		if (buf.Len()+2)/3*4 <= MaxBytes {
+			return buf.Bytes(), nil
+		}
+	}
+	return nil, errors.New("cover is too large to upload")
+}
+
+// scaleInto fills rect of dst with src, cropping src to a square around its centre
+// and averaging the source pixels that land on each destination pixel
+func scaleInto(dst *image.RGBA, rect image.Rectangle, src image.Image) {
+	b := src.Bounds()
+	crop := b
+	if b.Dx() > b.Dy() {
+		crop.Min.X += (b.Dx() - b.Dy()) / 2
+		crop.Max.X = crop.Min.X + b.Dy()
+	} else {
+		crop.Min.Y += (b.Dy() - b.Dx()) / 2
+		crop.Max.Y = crop.Min.Y + b.Dx()
+	}
+	if crop.Empty() {
+		return
+	}
+
+	w, h := rect.Dx(), rect.Dy()
+	for y := 0; y < h; y++ {
+		sy0 := crop.Min.Y + y*crop.Dy()/h
+		sy1 := crop.Min.Y + (y+1)*crop.Dy()/h
+		if sy1 == sy0 {
+			sy1++
+		}
+		for x := 0; x < w; x++ {
+			sx0 := crop.Min.X + x*crop.Dx()/w
+			sx1 := crop.Min.X + (x+1)*crop.Dx()/w
+			if sx1 == sx0 {
+				sx1++
+			}
+
+			var r, g, bl, n uint32
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, _ := src.At(sx, sy).RGBA()
+					r += cr
+					g += cg
+					bl += cb
+					n++
+				}
+			}
+			dst.SetRGBA(rect.Min.X+x, rect.Min.Y+y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8),
+				A: 255,
+			})
+		}
+	}
+}
+
+// titleColor picks a muted background color from a hash of the title
+func titleColor(title string) color.RGBA {
+	h := fnv.New32a()
+	h.Write([]byte(title))
+	sum := h.Sum32()
+	return color.RGBA{
+		R: uint8(40 + sum%120),
+		G: uint8(40 + (sum>>8)%120),
+		B: uint8(40 + (sum>>16)%120),
+		A: 255,
+	}
+}
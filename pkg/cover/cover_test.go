@@ -0,0 +1,139 @@
+package cover
+
+import (
+	"encoding/base64"
+	"image"
+	"image/color"
+	"math/rand"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// solid returns a square source cover filled with c
+func solid(c color.RGBA) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 300))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+// palette returns n source covers with distinct colors
+func palette(n int) ([]image.Image, []color.RGBA) {
+	sources := make([]image.Image, n)
+	colors := make([]color.RGBA, n)
+	for i := range sources {
+		colors[i] = color.RGBA{uint8(20 * i), uint8(255 - 20*i), uint8(10 * i), 255}
+		sources[i] = solid(colors[i])
+	}
+	return sources, colors
+}
+
+// checkGrid checks each cell of a side by side grid shows the expected color, sampling
+// near the top left of each cell so the title band is never in the way
+func checkGrid(t *testing.T, img *image.RGBA, side int, want func(cell int) color.RGBA) {
+	t.Helper()
+	cell := Size / side
+	for i := 0; i < side*side; i++ {
+		x, y := (i%side)*cell+10, (i/side)*cell+10
+		if got := img.RGBAAt(x, y); got != want(i) {
+			t.Errorf("cell %d at (%d, %d) is %v, want %v", i, x, y, got, want(i))
+		}
+	}
+}
+
+func TestComposeWithoutSources(t *testing.T) {
+	img := Compose(nil, "Morning Mix", "")
+	if img.Bounds() != image.Rect(0, 0, Size, Size) {
+		t.Fatalf("cover is %v", img.Bounds())
+	}
+	checkGrid(t, img, 3, func(int) color.RGBA { return titleColor("Morning Mix") })
+	if titleColor("Morning Mix") == titleColor("Evening Mix") {
+		t.Error("different titles got the same background")
+	}
+}
+
+func TestComposeSingleSource(t *testing.T) {
+	sources, colors := palette(1)
+	img := Compose(sources, "Morning Mix", "")
+	checkGrid(t, img, 3, func(int) color.RGBA { return colors[0] })
+}
+
+func TestComposeTwoByTwo(t *testing.T) {
+	for n := 2; n <= 8; n++ {
+		sources, colors := palette(n)
+		img := Compose(sources, "Morning Mix", "")
+		// Only the first four fit and fewer are repeated to fill the grid
+		checkGrid(t, img, 2, func(cell int) color.RGBA { return colors[cell%n] })
+	}
+}
+
+func TestComposeThreeByThree(t *testing.T) {
+	for _, n := range []int{9, 12} {
+		sources, colors := palette(n)
+		img := Compose(sources, "Morning Mix", "")
+		checkGrid(t, img, 3, func(cell int) color.RGBA { return colors[cell] })
+	}
+}
+
+func TestComposeDarkensTitleBand(t *testing.T) {
+	sources, colors := palette(1)
+	img := Compose(sources, "Morning Mix", "Built daily")
+	got := img.RGBAAt(Size-1, Size-1)
+	if got.R >= colors[0].R && got.G >= colors[0].G && got.B >= colors[0].B {
+		t.Errorf("bottom corner %v isn't darker than the source %v", got, colors[0])
+	}
+}
+
+func TestFitTitle(t *testing.T) {
+	title, scale := fitTitle("Mix")
+	if title != "Mix" || scale != maxTitleSize {
+		t.Errorf("short title fit as %q at %d", title, scale)
+	}
+
+	long := strings.Repeat("Long Title ", 20)
+	title, scale = fitTitle(long)
+	if scale != minTitleSize {
+		t.Errorf("long title drawn at %d, want %d", scale, minTitleSize)
+	}
+	if !strings.HasSuffix(title, "...") || strings.HasSuffix(title, " ...") {
+		t.Errorf("long title trimmed to %q", title)
+	}
+	if w := textWidth(title, scale); w > Size-2*margin {
+		t.Errorf("trimmed title is %dpx wide, want at most %d", w, Size-2*margin)
+	}
+	if !strings.HasPrefix(long, strings.TrimSuffix(title, "...")) {
+		t.Errorf("trimmed title %q isn't a prefix of the original", title)
+	}
+
+	// Trimming works on characters so multibyte ones aren't cut in half
+	title, _ = fitTitle(strings.Repeat("é", 200))
+	if !utf8.ValidString(title) {
+		t.Errorf("trimmed title %q isn't valid UTF-8", title)
+	}
+}
+
+func TestEncodeFitsSpotifyLimit(t *testing.T) {
+	// Noise compresses badly so it's about the largest JPEG a cover can make
+	rng := rand.New(rand.NewSource(1))
+	noise := image.NewRGBA(image.Rect(0, 0, Size, Size))
+	rng.Read(noise.Pix)
+	for i := 3; i < len(noise.Pix); i += 4 {
+		noise.Pix[i] = 255
+	}
+
+	sources, _ := palette(9)
+	for name, img := range map[string]image.Image{
+		"grid":  Compose(sources, "Morning Mix", "Built daily"),
+		"noise": noise,
+	} {
+		data, err := Encode(img)
+		if err != nil {
+			t.Fatalf("%s: Encode: %v", name, err)
+		}
+		if n := base64.StdEncoding.EncodedLen(len(data)); n > MaxBytes {
+			t.Errorf("%s: encoded cover is %d bytes, want at most %d", name, n, MaxBytes)
+		}
+	}
+}
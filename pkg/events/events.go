@@ -0,0 +1,188 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// channel is the Postgres NOTIFY channel build events are relayed over
+const channel = "build_events"
+
+// subscriberBuffer is how many events a slow subscriber can fall behind before events are dropped
+const subscriberBuffer = 32
+
+// Type is the kind of progress a build event reports
+type Type string
+
+const (
+	// BuildStarted is sent when a build begins
+	BuildStarted Type = "started"
+	// SourceFetched is sent once the tracks of a single source have been fetched
+	SourceFetched = "source"
+	// TracksAdded is sent as tracks are added to the Spotify playlist
+	TracksAdded = "tracks"
+	// BuildSucceeded is sent when a build finishes successfully
+	BuildSucceeded = "succeeded"
+	// BuildFailed is sent when a build fails
+	BuildFailed = "failed"
+	// BuildCancelled is sent when a build is stopped before finishing
+	BuildCancelled = "cancelled"
+	// BuildRetrying is sent when a build attempt fails and will be tried again
+	BuildRetrying = "retrying"
+)
+
+// Event reports the progress of a single playlist build
+type Event struct {
+	Type       Type      `json:"type"`
+	UserID     uuid.UUID `json:"userID"`
+	PlaylistID uuid.UUID `json:"playlistID"`
+	Source     string    `json:"source,omitempty"`
+	Count      int       `json:"count,omitempty"`
+	Total      int       `json:"total,omitempty"`
+	ImageURL   string    `json:"imageURL,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// envelope is an event as it travels through Postgres
+type envelope struct {
+	Origin uuid.UUID `json:"origin"`
+	Event  Event     `json:"event"`
+}
+
+// Publisher sends build events to whoever is listening
+type Publisher interface {
+	Publish(e Event)
+}
+
+// Broker fans build events out to subscribers in this process. When backed by
+// a DB, events are also relayed through Postgres NOTIFY so builds running in a
+// worker process reach subscribers in the server process.
+type Broker struct {
+	db  *sqlx.DB
+	log *zap.SugaredLogger
+	id  uuid.UUID
+
+	mu   sync.Mutex
+	subs map[uuid.UUID]map[chan Event]struct{}
+}
+
+// New returns a pointer to a new Broker. A nil db keeps events in process, as does a
+// SQLite db since only Postgres can relay them.
+func New(db *sqlx.DB, log *zap.SugaredLogger) *Broker {
+	if db != nil && db.DriverName() != "postgres" {
+		db = nil
+	}
+	return &Broker{
+		db:   db,
+		log:  log,
+		id:   uuid.New(),
+		subs: make(map[uuid.UUID]map[chan Event]struct{}),
+	}
+}
+
+// Publish sends an event to local subscribers and relays it to other processes
+func (b *Broker) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.deliver(e)
+
+	if b.db == nil {
+		return
+	}
+	payload, err := json.Marshal(envelope{Origin: b.id, Event: e})
+	if err != nil {
+		b.log.Errorw("failed to marshal build event", "err", err.Error())
+		return
+	}
+	_, err = b.db.Exec("SELECT pg_notify($1, $2);", channel, string(payload))
+	if err != nil {
+		b.log.Warnw("failed to relay build event", "err", err.Error(), "playlistID", e.PlaylistID)
+	}
+}
+
+// Subscribe returns a channel receiving every event for userID's playlists and a func to stop the subscription
+func (b *Broker) Subscribe(userID uuid.UUID) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subs[userID] == nil {
+		b.subs[userID] = make(map[chan Event]struct{})
+	}
+	b.subs[userID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs[userID], ch)
+		if len(b.subs[userID]) == 0 {
+			delete(b.subs, userID)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// Listen relays events published by other processes to local subscribers until ctx is done
+func (b *Broker) Listen(ctx context.Context, databaseURL string) {
+	if b.db == nil {
+		return
+	}
+	listener := pq.NewListener(databaseURL, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			b.log.Warnw("build event listener problem", "err", err.Error())
+		}
+	})
+	defer listener.Close()
+
+	err := listener.Listen(channel)
+	if err != nil {
+		b.log.Errorw("failed to listen for build events", "err", err.Error())
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-listener.Notify:
+			if n == nil {
+				// The connection was re-established and notifications may have been lost
+				continue
+			}
+			var env envelope
+			err := json.Unmarshal([]byte(n.Extra), &env)
+			if err != nil {
+				b.log.Warnw("failed to unmarshal build event", "err", err.Error())
+				continue
+			}
+			if env.Origin == b.id {
+				// Already delivered locally when it was published
+				continue
+			}
+			b.deliver(env.Event)
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		}
+	}
+}
+
+func (b *Broker) deliver(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs[e.UserID] {
+		select {
+		case ch <- e:
+		default:
+			// Drop the event rather than block a build on a slow subscriber
+		}
+	}
+}
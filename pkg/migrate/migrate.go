@@ -0,0 +1,313 @@
+// Package migrate applies the SQL migrations embedded in the binary to the database,
+// one transaction per migration and, on Postgres, never from two processes at once
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// lockID is the advisory lock held while migrating so two processes never migrate at once
+const lockID = 7246331
+
+// sqliteDriver is the database/sql driver name of SQLite, which works without the advisory lock
+const sqliteDriver = "sqlite3"
+
+// migrationName matches migration files like 001_init.up.sql
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a single numbered change to the database schema
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is how far the database schema has been migrated
+type Status struct {
+	Current int  // Version of the last applied migration, 0 before any are applied
+	Dirty   bool // Whether a migration failed partway and the schema needs fixing by hand
+	Latest  int  // Version of the newest known migration
+	Pending []Migration
+}
+
+// Behind reports whether there are migrations left to apply
+func (s Status) Behind() bool {
+	return s.Current < s.Latest
+}
+
+// Migrator applies migrations to a database, recording the schema's version in the same
+// schema_migrations table the golang-migrate CLI uses so either can be used on a database
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+	log        *zap.SugaredLogger
+}
+
+// New returns a Migrator for the migrations in fsys, which must all have an up and a down
+func New(db *sqlx.DB, fsys fs.FS, log *zap.SugaredLogger) (*Migrator, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, name := range names {
+		match := migrationName.FindStringSubmatch(path.Base(name))
+		if match == nil {
+			return nil, fmt.Errorf("badly named migration: %s", name)
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("badly numbered migration: %s", name)
+		}
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migrations %s and %s share a version", m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %03d_%s needs both an up and a down", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return &Migrator{db: db, migrations: migrations, log: log}, nil
+}
+
+// Latest returns the version of the newest migration
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status reports how far the database has been migrated
+func (m *Migrator) Status(ctx context.Context) (*Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	current, dirty, err := m.readVersion(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	status := Status{Current: current, Dirty: dirty, Latest: m.Latest()}
+	for _, migration := range m.migrations {
+		if migration.Version > current {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+	return &status, nil
+}
+
+// Up applies every pending migration
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down rolls back the last steps applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sql.Conn, current int) error {
+		target := 0
+		applied := m.applied(current)
+		if steps < len(applied) {
+			target = applied[len(applied)-steps-1].Version
+		}
+		return m.migrate(ctx, conn, current, target)
+	})
+}
+
+// To migrates up or down to the given version, 0 rolling back every migration
+func (m *Migrator) To(ctx context.Context, version int) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("no migration has version %d", version)
+	}
+	return m.withLock(ctx, func(conn *sql.Conn, current int) error {
+		return m.migrate(ctx, conn, current, version)
+	})
+}
+
+// withLock runs fn on a connection holding the migration lock, passing it the current version.
+// SQLite has no advisory locks but it is only used for local development by a single process.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn, current int) error) error {
+	// Advisory locks belong to a session so everything has to happen on one connection
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.db.DriverName() != sqliteDriver {
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1);", lockID)
+		if err != nil {
+			return fmt.Errorf("failed to take migration lock: %w", err)
+		}
+		defer func() {
+			// Closing the connection would release the lock too, but it goes back to the pool
+			_, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1);", lockID)
+			if err != nil {
+				m.log.Errorw("failed to release migration lock", "err", err.Error())
+			}
+		}()
+	}
+
+	query := `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version BIGINT NOT NULL PRIMARY KEY,
+	dirty   BOOLEAN NOT NULL
+);
+`
+	_, err = conn.ExecContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	current, dirty, err := m.readVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("schema is dirty at version %d, fix it by hand before migrating", current)
+	}
+	if current != 0 && m.find(current) == nil {
+		return fmt.Errorf("schema is at version %d which this binary has no migration for", current)
+	}
+	return fn(conn, current)
+}
+
+// migrate applies migrations one at a time from current to target, each in its own
+// transaction along with the version it leaves the schema at
+func (m *Migrator) migrate(ctx context.Context, conn *sql.Conn, current, target int) error {
+	if target == current {
+		m.log.Infow("schema is up to date", "version", current)
+		return nil
+	}
+
+	if target > current {
+		for _, migration := range m.migrations {
+			if migration.Version <= current || migration.Version > target {
+				continue
+			}
+			m.log.Infow("applying migration", "version", migration.Version, "name", migration.Name)
+			err := apply(ctx, conn, migration.Up, migration.Version)
+			if err != nil {
+				return fmt.Errorf("failed to apply migration %03d_%s: %w", migration.Version, migration.Name, err)
+			}
+		}
+		return nil
+	}
+
+	applied := m.applied(current)
+	for i := len(applied) - 1; i >= 0 && applied[i].Version > target; i-- {
+		previous := 0
+		if i > 0 {
+			previous = applied[i-1].Version
+		}
+		m.log.Infow("rolling back migration", "version", applied[i].Version, "name", applied[i].Name)
+		err := apply(ctx, conn, applied[i].Down, previous)
+		if err != nil {
+			return fmt.Errorf("failed to roll back migration %03d_%s: %w", applied[i].Version, applied[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// applied returns the migrations up to and including current, oldest first
+func (m *Migrator) applied(current int) []Migration {
+	var applied []Migration
+	for _, migration := range m.migrations {
+		if migration.Version <= current {
+			applied = append(applied, migration)
+		}
+	}
+	return applied
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+// apply runs a migration's SQL and records the version it leaves the schema at, all or nothing
+func apply(ctx context.Context, conn *sql.Conn, script string, version int) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations;")
+	if err != nil {
+		return err
+	}
+	if version > 0 {
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, dirty) VALUES ($1, FALSE);", version)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// readVersion returns the version the schema is at, which is 0 before anything has been migrated
+func (m *Migrator) readVersion(ctx context.Context, conn *sql.Conn) (int, bool, error) {
+	query := "SELECT to_regclass('schema_migrations') IS NOT NULL;"
+	if m.db.DriverName() == sqliteDriver {
+		query = "SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type='table' AND name='schema_migrations');"
+	}
+	var exists bool
+	err := conn.QueryRowContext(ctx, query).Scan(&exists)
+	if err != nil {
+		return 0, false, err
+	}
+	if !exists {
+		return 0, false, nil
+	}
+
+	var version int
+	var dirty bool
+	err = conn.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1;").Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	return version, dirty, nil
+}
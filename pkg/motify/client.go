@@ -1,63 +1,165 @@
 package motify
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
 	"github.com/zmb3/spotify"
 	zs "github.com/zmb3/spotify"
 )
 
+// apiURL is the base of Spotify's Web API
+const apiURL = "https://api.spotify.com/v1/"
+
 // Client handles accessing the Spotify APIs
 type Client struct {
-	zsc zs.Client
+	http *http.Client
 }
 
-func newClient(client zs.Client) Client {
+func newClient(client *http.Client) Client {
 	return Client{
-		zsc: client,
+		http: client,
+	}
+}
+
+// zsc returns a Spotify client whose requests are bound to ctx
+func (c *Client) zsc(ctx context.Context) zs.Client {
+	return zs.NewClient(&http.Client{
+		Transport: contextTransport{ctx: ctx, base: c.http.Transport},
+	})
+}
+
+// contextTransport attaches a context to every request so they can be cancelled
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
+
+// ChangePlaylistCollaborative makes a playlist collaborative or not. zmb3/spotify has
+// no call for this so the request is made directly.
+func (c *Client) ChangePlaylistCollaborative(ctx context.Context, playlistID zs.ID, collaborative bool) error {
+	body := map[string]bool{"collaborative": collaborative}
+	if collaborative {
+		// Spotify only lets private playlists be collaborative
+		body["public"] = false
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, apiURL+"playlists/"+string(playlistID), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("spotify: failed to change playlist collaboration: %s", resp.Status)
+	}
+	return nil
 }
 
 // TODO comment on these wrappers b/c they are public
 
-func (c *Client) AddTracksToPlaylist(playlistID zs.ID, trackIDs ...zs.ID) (snapshotID string, err error) {
-	return c.zsc.AddTracksToPlaylist(playlistID, trackIDs...)
+func (c *Client) AddTracksToPlaylist(ctx context.Context, playlistID zs.ID, trackIDs ...zs.ID) (snapshotID string, err error) {
+	zsc := c.zsc(ctx)
+	return zsc.AddTracksToPlaylist(playlistID, trackIDs...)
+}
+
+func (c *Client) ChangePlaylistNameAccessAndDescription(ctx context.Context, playlistID zs.ID, newName, newDescription string, public bool) error {
+	zsc := c.zsc(ctx)
+	return zsc.ChangePlaylistNameAccessAndDescription(playlistID, newName, newDescription, public)
+}
+
+func (c *Client) CreatePlaylistForUser(ctx context.Context, userID, playlistName, description string, public bool) (*zs.FullPlaylist, error) {
+	zsc := c.zsc(ctx)
+	return zsc.CreatePlaylistForUser(userID, playlistName, description, public)
+}
+
+func (c *Client) CurrentUser(ctx context.Context) (*zs.PrivateUser, error) {
+	zsc := c.zsc(ctx)
+	return zsc.CurrentUser()
+}
+
+func (c *Client) CurrentUsersAlbumsOpt(ctx context.Context, opt *zs.Options) (*zs.SavedAlbumPage, error) {
+	zsc := c.zsc(ctx)
+	return zsc.CurrentUsersAlbumsOpt(opt)
+}
+
+func (c *Client) CurrentUsersPlaylistsOpt(ctx context.Context, opt *zs.Options) (*zs.SimplePlaylistPage, error) {
+	zsc := c.zsc(ctx)
+	return zsc.CurrentUsersPlaylistsOpt(opt)
+}
+
+func (c *Client) CurrentUsersTracksOpt(ctx context.Context, opt *zs.Options) (*zs.SavedTrackPage, error) {
+	zsc := c.zsc(ctx)
+	return zsc.CurrentUsersTracksOpt(opt)
+}
+
+func (c *Client) GetArtists(ctx context.Context, ids ...zs.ID) ([]*zs.FullArtist, error) {
+	zsc := c.zsc(ctx)
+	return zsc.GetArtists(ids...)
 }
 
-func (c *Client) CreatePlaylistForUser(userID, playlistName, description string, public bool) (*zs.FullPlaylist, error) {
-	return c.zsc.CreatePlaylistForUser(userID, playlistName, description, public)
+func (c *Client) GetAlbum(ctx context.Context, id zs.ID) (*zs.FullAlbum, error) {
+	zsc := c.zsc(ctx)
+	return zsc.GetAlbum(id)
 }
 
-func (c *Client) CurrentUser() (*zs.PrivateUser, error) {
-	return c.zsc.CurrentUser()
+func (c *Client) GetAlbumTracksOpt(ctx context.Context, id zs.ID, opt *zs.Options) (*spotify.SimpleTrackPage, error) {
+	zsc := c.zsc(ctx)
+	return zsc.GetAlbumTracksOpt(id, *opt.Limit, *opt.Offset)
 }
 
-func (c *Client) CurrentUsersAlbumsOpt(opt *zs.Options) (*zs.SavedAlbumPage, error) {
-	return c.zsc.CurrentUsersAlbumsOpt(opt)
+func (c *Client) GetPlaylistOpt(ctx context.Context, playlistID zs.ID, fields string) (*zs.FullPlaylist, error) {
+	zsc := c.zsc(ctx)
+	return zsc.GetPlaylistOpt(playlistID, fields)
 }
 
-func (c *Client) CurrentUsersPlaylistsOpt(opt *zs.Options) (*zs.SimplePlaylistPage, error) {
-	return c.zsc.CurrentUsersPlaylistsOpt(opt)
+func (c *Client) GetPlaylistTracksOpt(ctx context.Context, playlistID zs.ID, opt *zs.Options, fields string) (*zs.PlaylistTrackPage, error) {
+	zsc := c.zsc(ctx)
+	return zsc.GetPlaylistTracksOpt(playlistID, opt, fields)
 }
 
-func (c *Client) CurrentUsersTracksOpt(opt *zs.Options) (*zs.SavedTrackPage, error) {
-	return c.zsc.CurrentUsersTracksOpt(opt)
+func (c *Client) RemoveTracksFromPlaylistOpt(ctx context.Context, playlistID zs.ID, tracks []zs.TrackToRemove, snapshotID string) (newSnapshotID string, err error) {
+	zsc := c.zsc(ctx)
+	return zsc.RemoveTracksFromPlaylistOpt(playlistID, tracks, snapshotID)
 }
 
-func (c *Client) GetAlbum(id zs.ID) (*zs.FullAlbum, error) {
-	return c.zsc.GetAlbum(id)
+func (c *Client) SearchOpt(ctx context.Context, query string, t zs.SearchType, opt *zs.Options) (*zs.SearchResult, error) {
+	zsc := c.zsc(ctx)
+	return zsc.SearchOpt(query, t, opt)
 }
 
-func (c *Client) GetAlbumTracksOpt(id zs.ID, opt *zs.Options) (*spotify.SimpleTrackPage, error) {
-	return c.zsc.GetAlbumTracksOpt(id, *opt.Limit, *opt.Offset)
+func (c *Client) SetPlaylistImage(ctx context.Context, playlistID zs.ID, img io.Reader) error {
+	zsc := c.zsc(ctx)
+	return zsc.SetPlaylistImage(playlistID, img)
 }
 
-func (c *Client) GetPlaylistOpt(playlistID zs.ID, fields string) (*zs.FullPlaylist, error) {
-	return c.zsc.GetPlaylistOpt(playlistID, fields)
+func (c *Client) GetTrack(ctx context.Context, id zs.ID) (*zs.FullTrack, error) {
+	zsc := c.zsc(ctx)
+	return zsc.GetTrack(id)
 }
 
-func (c *Client) GetPlaylistTracksOpt(playlistID zs.ID, opt *zs.Options, fields string) (*zs.PlaylistTrackPage, error) {
-	return c.zsc.GetPlaylistTracksOpt(playlistID, opt, fields)
+func (c *Client) GetTracks(ctx context.Context, ids ...zs.ID) ([]*zs.FullTrack, error) {
+	zsc := c.zsc(ctx)
+	return zsc.GetTracks(ids...)
 }
 
-func (c *Client) UnfollowPlaylist(owner, playlist zs.ID) error {
-	return c.zsc.UnfollowPlaylist(owner, playlist)
+func (c *Client) UnfollowPlaylist(ctx context.Context, owner, playlist zs.ID) error {
+	zsc := c.zsc(ctx)
+	return zsc.UnfollowPlaylist(owner, playlist)
 }
@@ -1,6 +1,8 @@
 package motify
 
 import (
+	"context"
+	"crypto/tls"
 	"net/http"
 
 	zs "github.com/zmb3/spotify"
@@ -12,7 +14,8 @@ import (
 
 // Spotify authenticates and builds clients
 type Spotify struct {
-	auth zs.Authenticator
+	auth   zs.Authenticator
+	config *oauth2.Config
 }
 
 // New returns a new Spotify struct which can be used to authenticate and build clients
@@ -25,19 +28,39 @@ func New(redirectURL, clientID, clientSecret string) *Spotify {
 		zs.ScopePlaylistModifyPrivate,
 		zs.ScopePlaylistModifyPublic,
 		zs.ScopeUserLibraryRead,
+		zs.ScopeImageUpload,
 	}
 
 	auth := zs.NewAuthenticator(redirectURL, scopes...)
 	auth.SetAuthInfo(clientID, clientSecret)
 
+	// Clients are built from our own copy of the oauth2 config so that their
+	// underlying http.Client can be bound to a context on each call
+	config := &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  zs.AuthURL,
+			TokenURL: zs.TokenURL,
+		},
+	}
+
 	return &Spotify{
-		auth: auth,
+		auth:   auth,
+		config: config,
 	}
 }
 
 // NewClient returns a Client that can be used to access Spotify APIs
 func (s *Spotify) NewClient(token *oauth2.Token) Client {
-	client := s.auth.NewClient(token)
+	// Disable HTTP/2 like the zmb3/spotify authenticator does, see: https://github.com/zmb3/spotify/issues/20
+	tr := &http.Transport{
+		TLSNextProto: map[string]func(authority string, c *tls.Conn) http.RoundTripper{},
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: tr})
+	client := s.config.Client(ctx, token)
 	return newClient(client)
 }
 
@@ -0,0 +1,117 @@
+// Package naming renders the templated names and descriptions of built playlists
+package naming
+
+import (
+	"errors"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+const (
+	// NameLimit is the longest playlist name Spotify accepts
+	NameLimit = 100
+	// DescriptionLimit is the longest playlist description Spotify accepts
+	DescriptionLimit = 300
+)
+
+// Vars are the values a name or description template can use
+type Vars struct {
+	Date        string // Local date of the build, like January 2, 2006
+	Week        int    // ISO week of the year of the build
+	SourceNames string // Names of the playlist's sources, comma separated
+	TrackCount  int    // Number of tracks in the built playlist
+	TopArtists  string // The three artists with the most tracks, comma separated
+}
+
+// worstCaseVars hold the longest values the variables take that don't depend on the playlist
+var worstCaseVars = Vars{
+	Date:       "September 30, 2006",
+	Week:       53,
+	TrackCount: 99999,
+	TopArtists: "An Artist With A Very Long Name, An Artist With A Very Long Name, An Artist With A Long Name",
+}
+
+// ErrTooLong is returned by Validate when a template can render past the limit
+var ErrTooLong = errors.New("template renders too much text")
+
+// errRunaway stops a template that renders far more text than could ever be used
+var errRunaway = errors.New("template renders far too much text")
+
+// WorstCase returns the variables a playlist with the given sources renders its longest text with
+func WorstCase(sourceNames []string) Vars {
+	vars := worstCaseVars
+	vars.SourceNames = strings.Join(sourceNames, ", ")
+	return vars
+}
+
+// Validate checks that text parses, only uses known variables and fits in limit
+// characters when rendered with vars
+func Validate(text string, vars Vars, limit int) error {
+	s, err := render(text, vars)
+	if err != nil {
+		return err
+	}
+	if utf8.RuneCountInString(normalize(s)) > limit {
+		return ErrTooLong
+	}
+	return nil
+}
+
+// Render fills in text with vars. Validate has already checked the text fits, but top
+// artists can be longer than the worst case so the result is still trimmed to limit.
+func Render(text string, vars Vars, limit int) (string, error) {
+	s, err := render(text, vars)
+	if err != nil {
+		return "", err
+	}
+	s = normalize(s)
+	if utf8.RuneCountInString(s) > limit {
+		s = string([]rune(s)[:limit])
+	}
+	return s, nil
+}
+
+// normalize collapses runs of whitespace, like the line breaks of a multiline description
+func normalize(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// ArchiveName returns the name template of a playlist in archive mode. Archived builds sit
+// side by side in the user's library so they are told apart by date.
+func ArchiveName(text string) string {
+	if strings.Contains(text, ".Date") {
+		return text
+	}
+	return text + " ({{.Date}})"
+}
+
+// UsesTopArtists reports whether text needs the top artists, which cost extra requests to find
+func UsesTopArtists(text string) bool {
+	return strings.Contains(text, ".TopArtists")
+}
+
+func render(text string, vars Vars) (string, error) {
+	t, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b limitedBuilder
+	err = t.Execute(&b, vars)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// limitedBuilder stops a template that renders far more text than could ever be used
+type limitedBuilder struct {
+	strings.Builder
+}
+
+func (b *limitedBuilder) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > 4*DescriptionLimit {
+		return 0, errRunaway
+	}
+	return b.Builder.Write(p)
+}
@@ -0,0 +1,75 @@
+package naming
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	vars := WorstCase([]string{"Liked Songs", "Discover Weekly"})
+	tests := []struct {
+		text  string
+		limit int
+		err   error
+	}{
+		{"Mix for {{.Date}}", NameLimit, nil},
+		{"Café mix ☕ week {{.Week}}", NameLimit, nil},
+		{"{{.SourceNames}} with {{.TrackCount}} tracks", NameLimit, nil},
+		{"Fits exactly", len("Fits exactly"), nil},
+		{"{{.TopArtists}} {{.TopArtists}}", NameLimit, ErrTooLong},
+		{"{{.TopArtists}} {{.TopArtists}}", DescriptionLimit, nil},
+		{strings.Repeat("é", NameLimit+1), NameLimit, ErrTooLong},
+	}
+	for _, test := range tests {
+		if err := Validate(test.text, vars, test.limit); !errors.Is(err, test.err) {
+			t.Errorf("Validate(%q, %d) = %v, want %v", test.text, test.limit, err, test.err)
+		}
+	}
+
+	for _, text := range []string{"{{.Missing}}", "{{.Date", "{{range .}}"} {
+		if err := Validate(text, vars, DescriptionLimit); err == nil || errors.Is(err, ErrTooLong) {
+			t.Errorf("Validate(%q) = %v, want a template error", text, err)
+		}
+	}
+}
+
+func TestValidateUsesSourceNames(t *testing.T) {
+	long := strings.Repeat("A Long Playlist Name ", 3)
+	text := "{{.SourceNames}}"
+	if err := Validate(text, WorstCase([]string{long}), NameLimit); err != nil {
+		t.Errorf("one source: %v", err)
+	}
+	if err := Validate(text, WorstCase([]string{long, long}), NameLimit); !errors.Is(err, ErrTooLong) {
+		t.Errorf("two sources: %v, want ErrTooLong", err)
+	}
+}
+
+func TestArchiveName(t *testing.T) {
+	if got := ArchiveName("Morning Mix"); got != "Morning Mix ({{.Date}})" {
+		t.Errorf("ArchiveName added %q", got)
+	}
+	if got := ArchiveName("Mix for {{.Date}}"); got != "Mix for {{.Date}}" {
+		t.Errorf("ArchiveName changed a name already holding the date to %q", got)
+	}
+
+	// A name that only just fits on its own doesn't once the date is added
+	name := strings.Repeat("a", NameLimit-5)
+	vars := WorstCase(nil)
+	if err := Validate(name, vars, NameLimit); err != nil {
+		t.Errorf("plain name: %v", err)
+	}
+	if err := Validate(ArchiveName(name), vars, NameLimit); !errors.Is(err, ErrTooLong) {
+		t.Errorf("archive name: %v, want ErrTooLong", err)
+	}
+}
+
+func TestRenderCollapsesWhitespace(t *testing.T) {
+	s, err := Render("Week {{.Week}}\r\n\tmix", Vars{Week: 7}, DescriptionLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "Week 7 mix" {
+		t.Errorf("rendered %q", s)
+	}
+}
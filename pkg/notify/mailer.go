@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+	"sync"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPMailer sends email through an SMTP server
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer returns a pointer to a new SMTPMailer. Auth is skipped when username is empty.
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPMailer{
+		addr: fmt.Sprintf("%s:%d", host, port),
+		auth: auth,
+		from: from,
+	}
+}
+
+// Send delivers msg. net/smtp has no way to cancel a send so ctx is only checked up front.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", encodeSubject(msg.Subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, []byte(b.String()))
+}
+
+// encodeSubject encodes a subject as an RFC 2047 word when it needs it. Subjects hold user
+// input like playlist names and this keeps a line break in one from starting a new header.
+func encodeSubject(subject string) string {
+	return mime.QEncoding.Encode("utf-8", subject)
+}
+
+// MemoryMailer keeps sent email in memory instead of sending it, for tests and local development
+type MemoryMailer struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+// Send records msg
+func (m *MemoryMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// Sent returns every message sent so far
+func (m *MemoryMailer) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sent := make([]Message, len(m.sent))
+	copy(sent, m.sent)
+	return sent
+}
@@ -0,0 +1,151 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/calebschoepp/playlist-rotator/pkg/config"
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+)
+
+// repeatedFailures is how many scheduled builds in a row must fail before a repeated failure is reported
+const repeatedFailures = 3
+
+// digestInterval is how often digest emails are sent
+const digestInterval = 24 * time.Hour
+
+// Notifier emails users about their failed scheduled builds
+type Notifier struct {
+	store  store.Store
+	mailer Mailer
+	log    *zap.SugaredLogger
+}
+
+// New returns a pointer to a new Notifier. A nil mailer turns notifications off.
+func New(store store.Store, mailer Mailer, log *zap.SugaredLogger) *Notifier {
+	return &Notifier{
+		store:  store,
+		mailer: mailer,
+		log:    log,
+	}
+}
+
+// NewMailer returns an SMTP mailer for the configured server, or nil if SMTP isn't configured
+func NewMailer(config *config.Config) Mailer {
+	if config.SMTPHost == "" {
+		return nil
+	}
+	return NewSMTPMailer(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.SMTPFrom)
+}
+
+// BuildFailed tells a user their scheduled build of a playlist failed, either right
+// away or in their next digest depending on their settings
+func (n *Notifier) BuildFailed(ctx context.Context, userID, playlistID uuid.UUID) error {
+	if n.mailer == nil {
+		return nil
+	}
+
+	user, err := n.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.Email == nil || user.NotifyOn == store.NotifyNever {
+		return nil
+	}
+
+	playlist, err := n.store.GetPlaylist(ctx, playlistID)
+	if err != nil {
+		return err
+	}
+	if user.NotifyOn == store.NotifyRepeated && playlist.ConsecutiveFailures < repeatedFailures {
+		return nil
+	}
+	failureMsg := ""
+	if playlist.FailureMsg != nil {
+		failureMsg = *playlist.FailureMsg
+	}
+
+	if user.NotifyDelivery == store.Digest {
+		return n.store.CreateNotification(ctx, userID, playlistID, playlist.Name, failureMsg, playlist.ConsecutiveFailures)
+	}
+
+	return n.mailer.Send(ctx, Message{
+		To:      *user.Email,
+		Subject: fmt.Sprintf("Your playlist %s failed to build", playlist.Name),
+		Body:    "Playlist Rotator couldn't build one of your scheduled playlists.\n\n" + describeFailure(playlist.Name, failureMsg, playlist.ConsecutiveFailures),
+	})
+}
+
+// SendDigests emails every user who is due a digest a summary of their failed builds
+func (n *Notifier) SendDigests(ctx context.Context) {
+	if n.mailer == nil {
+		return
+	}
+
+	users, err := n.store.GetDigestUsers(ctx, digestInterval)
+	if err != nil {
+		n.log.Errorw("failed to get users due a digest", "err", err.Error())
+		return
+	}
+
+	sent := 0
+	for _, user := range users {
+		if ctx.Err() != nil {
+			break
+		}
+		err = n.sendDigest(ctx, user)
+		if err != nil {
+			n.log.Errorw("failed to send digest", "err", err.Error(), "userID", user.ID)
+			continue
+		}
+		sent++
+	}
+	n.log.Infow("sent failure digests", "due", len(users), "sent", sent)
+}
+
+func (n *Notifier) sendDigest(ctx context.Context, user store.User) error {
+	now := time.Now()
+	notifications, err := n.store.GetPendingNotifications(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if len(notifications) == 0 || user.Email == nil {
+		// Nothing to say or nowhere to say it, so just clear the backlog
+		return n.store.MarkDigestSent(ctx, user.ID, now)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Playlist Rotator couldn't build %d of your scheduled playlists since the last digest.\n", len(notifications))
+	for _, notification := range notifications {
+		b.WriteString("\n")
+		b.WriteString(describeFailure(notification.PlaylistName, notification.FailureMsg, notification.ConsecutiveFailures))
+	}
+
+	err = n.mailer.Send(ctx, Message{
+		To:      *user.Email,
+		Subject: "Your daily Playlist Rotator digest",
+		Body:    b.String(),
+	})
+	if err != nil {
+		return err
+	}
+	return n.store.MarkDigestSent(ctx, user.ID, now)
+}
+
+// describeFailure is the paragraph about a single failed build used in every email
+func describeFailure(name, failureMsg string, consecutiveFailures int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", name)
+	if failureMsg != "" {
+		fmt.Fprintf(&b, "  Error: %s\n", failureMsg)
+	}
+	if consecutiveFailures > 1 {
+		fmt.Fprintf(&b, "  This playlist has failed its last %d scheduled builds.\n", consecutiveFailures)
+	}
+	return b.String()
+}
@@ -0,0 +1,230 @@
+package notify
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+)
+
+// fakeStore holds just enough state for the notifier, any other store call panics
+type fakeStore struct {
+	store.Store
+
+	users         map[uuid.UUID]*store.User
+	playlists     map[uuid.UUID]*store.Playlist
+	notifications []store.Notification
+	digestsSent   map[uuid.UUID]time.Time
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		users:       map[uuid.UUID]*store.User{},
+		playlists:   map[uuid.UUID]*store.Playlist{},
+		digestsSent: map[uuid.UUID]time.Time{},
+	}
+}
+
+func (f *fakeStore) GetUserByID(ctx context.Context, id uuid.UUID) (*store.User, error) {
+	return f.users[id], nil
+}
+
+func (f *fakeStore) GetPlaylist(ctx context.Context, id uuid.UUID) (*store.Playlist, error) {
+	return f.playlists[id], nil
+}
+
+func (f *fakeStore) CreateNotification(ctx context.Context, userID, playlistID uuid.UUID, playlistName, failureMsg string, consecutiveFailures int) error {
+	f.notifications = append(f.notifications, store.Notification{
+		ID:                  uuid.New(),
+		UserID:              userID,
+		PlaylistID:          playlistID,
+		PlaylistName:        playlistName,
+		FailureMsg:          failureMsg,
+		ConsecutiveFailures: consecutiveFailures,
+	})
+	return nil
+}
+
+func (f *fakeStore) GetDigestUsers(ctx context.Context, interval time.Duration) ([]store.User, error) {
+	var users []store.User
+	for _, user := range f.users {
+		if user.NotifyDelivery == store.Digest {
+			users = append(users, *user)
+		}
+	}
+	return users, nil
+}
+
+func (f *fakeStore) GetPendingNotifications(ctx context.Context, userID uuid.UUID) ([]store.Notification, error) {
+	var pending []store.Notification
+	for _, notification := range f.notifications {
+		if notification.UserID == userID && notification.SentAt == nil {
+			pending = append(pending, notification)
+		}
+	}
+	return pending, nil
+}
+
+func (f *fakeStore) MarkDigestSent(ctx context.Context, userID uuid.UUID, upTo time.Time) error {
+	for i := range f.notifications {
+		if f.notifications[i].UserID == userID && f.notifications[i].SentAt == nil {
+			f.notifications[i].SentAt = &upTo
+		}
+	}
+	f.digestsSent[userID] = upTo
+	return nil
+}
+
+// addUser adds a user with an email address and the given notification settings
+func (f *fakeStore) addUser(notifyOn store.NotifyOn, delivery store.NotifyDelivery) uuid.UUID {
+	email := "listener@example.com"
+	user := &store.User{
+		ID:             uuid.New(),
+		Email:          &email,
+		NotifyOn:       notifyOn,
+		NotifyDelivery: delivery,
+	}
+	f.users[user.ID] = user
+	return user.ID
+}
+
+// addFailedPlaylist adds a playlist whose last consecutiveFailures scheduled builds failed
+func (f *fakeStore) addFailedPlaylist(userID uuid.UUID, name string, consecutiveFailures int) uuid.UUID {
+	failureMsg := "Expected to find 10 songs in playlist but only found 3"
+	playlist := &store.Playlist{
+		ID:                  uuid.New(),
+		UserID:              userID,
+		Name:                name,
+		FailureMsg:          &failureMsg,
+		ConsecutiveFailures: consecutiveFailures,
+	}
+	f.playlists[playlist.ID] = playlist
+	return playlist.ID
+}
+
+func newTestNotifier() (*Notifier, *fakeStore, *MemoryMailer) {
+	fake := newFakeStore()
+	mailer := &MemoryMailer{}
+	return New(fake, mailer, zap.NewNop().Sugar()), fake, mailer
+}
+
+func TestBuildFailedEmailsFirstFailure(t *testing.T) {
+	n, fake, mailer := newTestNotifier()
+	userID := fake.addUser(store.NotifyEvery, store.Immediate)
+	playlistID := fake.addFailedPlaylist(userID, "Morning Mix", 1)
+
+	if err := n.BuildFailed(context.Background(), userID, playlistID); err != nil {
+		t.Fatalf("BuildFailed: %v", err)
+	}
+
+	sent := mailer.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(sent))
+	}
+	if sent[0].To != "listener@example.com" {
+		t.Errorf("email sent to %q", sent[0].To)
+	}
+	if !strings.Contains(sent[0].Subject, "Morning Mix") {
+		t.Errorf("subject %q doesn't name the playlist", sent[0].Subject)
+	}
+	if !strings.Contains(sent[0].Body, "only found 3") {
+		t.Errorf("body doesn't include the failure:\n%s", sent[0].Body)
+	}
+	if strings.Contains(sent[0].Body, "failed its last") {
+		t.Errorf("first failure described as repeated:\n%s", sent[0].Body)
+	}
+	if len(fake.notifications) != 0 {
+		t.Errorf("immediate email also queued %d notifications", len(fake.notifications))
+	}
+}
+
+func TestBuildFailedRespectsOptOut(t *testing.T) {
+	n, fake, mailer := newTestNotifier()
+
+	never := fake.addUser(store.NotifyNever, store.Immediate)
+	noEmail := fake.addUser(store.NotifyEvery, store.Immediate)
+	fake.users[noEmail].Email = nil
+	repeated := fake.addUser(store.NotifyRepeated, store.Immediate)
+
+	for _, userID := range []uuid.UUID{never, noEmail, repeated} {
+		playlistID := fake.addFailedPlaylist(userID, "Morning Mix", repeatedFailures-1)
+		if err := n.BuildFailed(context.Background(), userID, playlistID); err != nil {
+			t.Fatalf("BuildFailed: %v", err)
+		}
+	}
+	if sent := mailer.Sent(); len(sent) != 0 {
+		t.Fatalf("sent %d emails to users who opted out", len(sent))
+	}
+	if len(fake.notifications) != 0 {
+		t.Fatalf("queued %d notifications for users who opted out", len(fake.notifications))
+	}
+
+	// Once the failures repeat enough the repeated user hears about it
+	playlistID := fake.addFailedPlaylist(repeated, "Evening Mix", repeatedFailures)
+	if err := n.BuildFailed(context.Background(), repeated, playlistID); err != nil {
+		t.Fatalf("BuildFailed: %v", err)
+	}
+	sent := mailer.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(sent))
+	}
+	if !strings.Contains(sent[0].Body, "failed its last 3 scheduled builds") {
+		t.Errorf("body doesn't mention the repeated failures:\n%s", sent[0].Body)
+	}
+}
+
+func TestDigestBatchesFailures(t *testing.T) {
+	n, fake, mailer := newTestNotifier()
+	userID := fake.addUser(store.NotifyEvery, store.Digest)
+	morning := fake.addFailedPlaylist(userID, "Morning Mix", 1)
+	evening := fake.addFailedPlaylist(userID, "Evening Mix", 2)
+
+	for _, playlistID := range []uuid.UUID{morning, evening} {
+		if err := n.BuildFailed(context.Background(), userID, playlistID); err != nil {
+			t.Fatalf("BuildFailed: %v", err)
+		}
+	}
+	if sent := mailer.Sent(); len(sent) != 0 {
+		t.Fatalf("digest user was emailed %d times before the digest", len(sent))
+	}
+	if len(fake.notifications) != 2 {
+		t.Fatalf("queued %d notifications, want 2", len(fake.notifications))
+	}
+
+	n.SendDigests(context.Background())
+
+	sent := mailer.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d digests, want 1", len(sent))
+	}
+	for _, want := range []string{"2 of your scheduled playlists", "Morning Mix", "Evening Mix"} {
+		if !strings.Contains(sent[0].Body, want) {
+			t.Errorf("digest doesn't contain %q:\n%s", want, sent[0].Body)
+		}
+	}
+	if _, ok := fake.digestsSent[userID]; !ok {
+		t.Error("digest wasn't marked sent")
+	}
+
+	// Nothing new has failed so the next digest is skipped
+	n.SendDigests(context.Background())
+	if sent := mailer.Sent(); len(sent) != 1 {
+		t.Fatalf("sent %d digests after an empty day, want 1", len(sent))
+	}
+}
+
+func TestSMTPSubjectCannotAddHeaders(t *testing.T) {
+	subject := "Your playlist Mix\r\nBcc: someone@example.com failed to build"
+	encoded := encodeSubject(subject)
+	if strings.ContainsAny(encoded, "\r\n") {
+		t.Fatalf("encoded subject %q still contains a line break", encoded)
+	}
+	if plain := encodeSubject("Your playlist Mix failed to build"); plain != "Your playlist Mix failed to build" {
+		t.Errorf("plain subject was encoded as %q", plain)
+	}
+}
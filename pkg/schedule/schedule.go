@@ -0,0 +1,103 @@
+package schedule
+
+import (
+	"errors"
+	"time"
+
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+)
+
+// DefaultBuildTime is the time of day scheduled builds happen unless the user picks another
+const DefaultBuildTime = "06:00"
+
+// Next returns when a playlist is next due to be built in loc, or nil if it is never
+// built automatically. Playlists that have never been built or are paused aren't
+// scheduled, and neither are builds that would fall after the playlist's end date.
+//
+// Fixed schedules are anchored to the playlist's build time on the local day of the
+// last build, so a build that runs late doesn't push every later build back too.
+func Next(p store.Playlist, loc *time.Location) (*time.Time, error) {
+	if p.Schedule == store.Never || p.LastBuiltAt == nil || p.Paused {
+		return nil, nil
+	}
+
+	var next *time.Time
+	var err error
+	last := p.LastBuiltAt.In(loc)
+	if p.StartsOn != nil && last.Before(StartOfDate(*p.StartsOn, loc)) {
+		next, err = first(p, StartOfDate(*p.StartsOn, loc), loc)
+	} else {
+		next, err = after(p, last, loc)
+	}
+	if err != nil || next == nil {
+		return nil, err
+	}
+	if p.EndsOn != nil && !next.Before(StartOfDate(*p.EndsOn, loc).AddDate(0, 0, 1)) {
+		return nil, nil
+	}
+	return next, nil
+}
+
+// StartOfDate returns the first moment of a calendar date in loc. Only the
+// year, month and day of date are used, since dates are stored without a timezone.
+func StartOfDate(date time.Time, loc *time.Location) time.Time {
+	year, month, day := date.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// first returns the first build of p's schedule on or after start
+func first(p store.Playlist, start time.Time, loc *time.Location) (*time.Time, error) {
+	if p.Schedule == store.Custom {
+		return after(p, start.Add(-time.Nanosecond), loc)
+	}
+	clock, err := ParseBuildTime(p.BuildTime)
+	if err != nil {
+		return nil, err
+	}
+	year, month, day := start.Date()
+	next := time.Date(year, month, day, clock.Hour(), clock.Minute(), 0, 0, loc)
+	return &next, nil
+}
+
+// after returns the first build of p's schedule after last
+func after(p store.Playlist, last time.Time, loc *time.Location) (*time.Time, error) {
+	if p.Schedule == store.Custom {
+		if p.Cron == nil {
+			return nil, errors.New("custom schedule is missing its cron expression")
+		}
+		cron, err := Parse(*p.Cron)
+		if err != nil {
+			return nil, err
+		}
+		next := cron.Next(last)
+		if next.IsZero() {
+			return nil, nil
+		}
+		return &next, nil
+	}
+
+	clock, err := ParseBuildTime(p.BuildTime)
+	if err != nil {
+		return nil, err
+	}
+	year, month, day := last.Date()
+	switch p.Schedule {
+	case store.Daily:
+		day++
+	case store.Weekly:
+		day += 7
+	case store.BiWeekly:
+		day += 14
+	case store.Monthly:
+		month++
+	default:
+		return nil, errors.New("unknown schedule: " + string(p.Schedule))
+	}
+	next := time.Date(year, month, day, clock.Hour(), clock.Minute(), 0, 0, loc)
+	return &next, nil
+}
+
+// ParseBuildTime parses a time of day written as 15:04
+func ParseBuildTime(s string) (time.Time, error) {
+	return time.Parse("15:04", s)
+}
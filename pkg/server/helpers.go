@@ -6,14 +6,22 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net/mail"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
+	"unicode/utf8"
 
+	"github.com/calebschoepp/playlist-rotator/pkg/build"
 	"github.com/calebschoepp/playlist-rotator/pkg/motify"
+	"github.com/calebschoepp/playlist-rotator/pkg/naming"
+	"github.com/calebschoepp/playlist-rotator/pkg/schedule"
 	"github.com/calebschoepp/playlist-rotator/pkg/store"
 	"github.com/calebschoepp/playlist-rotator/pkg/tmpl"
+	"github.com/calebschoepp/playlist-rotator/pkg/webhook"
 	"github.com/google/uuid"
 	zs "github.com/zmb3/spotify"
 )
@@ -23,8 +31,21 @@ type ctxKey int
 type playlistForm struct {
 	name         string
 	schedule     store.Schedule
+	cron         string
+	buildTime    string
+	startsOn     string
+	endsOn       string
+	outputMode   store.OutputMode
+	keepBuilds   string
+	maxSize      string
+	split        store.SplitMode
+	splitSize    string
 	description  string
 	public       bool
+	collab       bool
+	collabPolicy store.CollaboratorPolicy
+	editPolicy   store.EditPolicy
+	pinned       map[string]*store.PinnedTrack
 	trackSources map[string]*tmpl.TrackSource
 }
 
@@ -32,6 +53,28 @@ const (
 	userIDCtxKey ctxKey = iota
 )
 
+// formDateLayout is how date inputs submit their values
+const formDateLayout = "2006-01-02"
+
+// maxNameTemplate and maxDescriptionTemplate cap the raw templates, which can be far
+// longer than the text they render to
+const (
+	maxNameTemplate        = 500
+	maxDescriptionTemplate = 1000
+)
+
+const (
+	defaultKeepBuilds = 4
+	maxKeepBuilds     = 20
+	defaultMaxSize    = 200
+	defaultSplitSize  = 50
+	maxPlaylistSize   = 10000 // Spotify won't add tracks past this
+	maxPinned         = 20
+	maxPinPosition    = 5 // Pins can be fixed this far from either end
+	maxSourceFilters  = 5 // Counts the sources compared with, not the groups holding them
+	maxFilterDepth    = 2 // Filters sit inside at most this many nested groups
+)
+
 // GenerateRandomBytes returns securely generated random bytes.
 // It will return an error if the system's secure random
 // number generator fails to function correctly, in which
@@ -62,9 +105,9 @@ func getUserID(ctx context.Context) *uuid.UUID {
 	return userID
 }
 
-func getPotentialSources(s store.Store, spotify *motify.Spotify, userID *uuid.UUID) ([]tmpl.PotentialSource, error) {
+func getPotentialSources(ctx context.Context, s store.Store, spotify *motify.Spotify, userID *uuid.UUID) ([]tmpl.PotentialSource, error) {
 	// Build spotify client
-	user, err := s.GetUserByID(*userID)
+	user, err := s.GetUserByID(ctx, *userID)
 	if err != nil {
 		return nil, err
 	}
@@ -76,7 +119,7 @@ func getPotentialSources(s store.Store, spotify *motify.Spotify, userID *uuid.UU
 
 	// Find and add playlists
 	limit := 50
-	playlists, err := client.CurrentUsersPlaylistsOpt(&zs.Options{
+	playlists, err := client.CurrentUsersPlaylistsOpt(ctx, &zs.Options{
 		Limit: &limit,
 	})
 	if err != nil {
@@ -93,7 +136,7 @@ func getPotentialSources(s store.Store, spotify *motify.Spotify, userID *uuid.UU
 	}
 
 	// Find and add albums
-	albums, err := client.CurrentUsersAlbumsOpt(&zs.Options{
+	albums, err := client.CurrentUsersAlbumsOpt(ctx, &zs.Options{
 		Limit: &limit,
 	})
 	if err != nil {
@@ -115,7 +158,9 @@ func getPotentialSources(s store.Store, spotify *motify.Spotify, userID *uuid.UU
 func parsePlaylistForm(values url.Values) (*store.Playlist, *tmpl.Playlist, error) {
 	var data playlistForm
 	duplicate := false
+	duplicatePin := false
 	data.trackSources = make(map[string]*tmpl.TrackSource)
+	data.pinned = make(map[string]*store.PinnedTrack)
 	for k, v := range values {
 		if k == "name" {
 			data.name = strings.Join(v, "")
@@ -130,6 +175,59 @@ func parsePlaylistForm(values url.Values) (*store.Playlist, *tmpl.Playlist, erro
 			default:
 				return nil, nil, fmt.Errorf("invalid access type: %v", strings.Join(v, ""))
 			}
+		} else if k == "collaborative" {
+			data.collab = strings.Join(v, "") == "on"
+		} else if k == "collaboratorPolicy" {
+			switch strings.Join(v, "") {
+			case string(store.DropAdded):
+				data.collabPolicy = store.DropAdded
+			case string(store.KeepAdded):
+				data.collabPolicy = store.KeepAdded
+			case string(store.PromoteAdded):
+				data.collabPolicy = store.PromoteAdded
+			default:
+				return nil, nil, fmt.Errorf("invalid collaborator policy: %v", strings.Join(v, ""))
+			}
+		} else if k == "editPolicy" {
+			switch strings.Join(v, "") {
+			case string(store.IgnoreEdits):
+				data.editPolicy = store.IgnoreEdits
+			case string(store.CarryEdits):
+				data.editPolicy = store.CarryEdits
+			case string(store.PinEdits):
+				data.editPolicy = store.PinEdits
+			default:
+				return nil, nil, fmt.Errorf("invalid edit policy: %v", strings.Join(v, ""))
+			}
+		} else if strings.HasPrefix(k, "pinned::") {
+			// Pins are keyed by track ID like sources, checked first since IDs can end in anything
+			parts := strings.Split(k, "::")
+			if len(parts) != 3 || parts[1] == "" {
+				return nil, nil, fmt.Errorf("invalid pinned track input: %v", k)
+			}
+			id := parts[1]
+			if len(v) > 1 {
+				duplicatePin = true
+			}
+			pin, ok := data.pinned[id]
+			if !ok {
+				pin = &store.PinnedTrack{ID: id}
+				data.pinned[id] = pin
+			}
+			switch parts[2] {
+			case "name":
+				pin.Name = v[0]
+			case "position":
+				position, err := strconv.Atoi(v[0])
+				if err != nil || position < -maxPinPosition || position > maxPinPosition {
+					return nil, nil, fmt.Errorf("invalid pinned track position: %v", v[0])
+				}
+				pin.Position = position
+			default:
+				return nil, nil, fmt.Errorf("invalid pinned track input: %v", k)
+			}
+		} else if k == "clearExcluded" {
+			// Read by playlistForm since it isn't part of the playlist configuration
 		} else if k == "schedule" {
 			switch strings.Join(v, "") {
 			case string(store.Never):
@@ -142,9 +240,63 @@ func parsePlaylistForm(values url.Values) (*store.Playlist, *tmpl.Playlist, erro
 				data.schedule = store.BiWeekly
 			case string(store.Monthly):
 				data.schedule = store.Monthly
+			case string(store.Custom):
+				data.schedule = store.Custom
 			default:
 				return nil, nil, fmt.Errorf("invalid schedule type: %v", strings.Join(v, ""))
 			}
+		} else if k == "cron" {
+			data.cron = strings.TrimSpace(strings.Join(v, ""))
+		} else if k == "buildTime" {
+			data.buildTime = strings.TrimSpace(strings.Join(v, ""))
+		} else if k == "outputMode" {
+			switch strings.Join(v, "") {
+			case string(store.Replace):
+				data.outputMode = store.Replace
+			case string(store.Archive):
+				data.outputMode = store.Archive
+			case string(store.Append):
+				data.outputMode = store.Append
+			default:
+				return nil, nil, fmt.Errorf("invalid output mode: %v", strings.Join(v, ""))
+			}
+		} else if k == "keepBuilds" {
+			data.keepBuilds = strings.TrimSpace(strings.Join(v, ""))
+		} else if k == "maxSize" {
+			data.maxSize = strings.TrimSpace(strings.Join(v, ""))
+		} else if k == "split" {
+			switch strings.Join(v, "") {
+			case string(store.NoSplit):
+				data.split = store.NoSplit
+			case string(store.SplitBySize):
+				data.split = store.SplitBySize
+			case string(store.SplitBySource):
+				data.split = store.SplitBySource
+			case string(store.SplitByDecade):
+				data.split = store.SplitByDecade
+			case string(store.SplitByGenre):
+				data.split = store.SplitByGenre
+			default:
+				return nil, nil, fmt.Errorf("invalid split mode: %v", strings.Join(v, ""))
+			}
+		} else if k == "splitSize" {
+			data.splitSize = strings.TrimSpace(strings.Join(v, ""))
+		} else if k == "startsOn" {
+			data.startsOn = strings.TrimSpace(strings.Join(v, ""))
+		} else if k == "endsOn" {
+			data.endsOn = strings.TrimSpace(strings.Join(v, ""))
+		} else if strings.HasSuffix(k, "::filter") {
+			parts := strings.Split(k, "::")
+			id := parts[0]
+			filters, err := parseSourceFilters(v)
+			if err != nil {
+				return nil, nil, err
+			}
+			if ts, ok := data.trackSources[id]; ok {
+				ts.Filters = filters
+			} else {
+				data.trackSources[id] = &tmpl.TrackSource{TrackSource: store.TrackSource{Filters: filters}}
+			}
 		} else if strings.HasSuffix(k, "type") {
 			parts := strings.Split(k, "::")
 			id := parts[0]
@@ -254,25 +406,110 @@ func parsePlaylistForm(values url.Values) (*store.Playlist, *tmpl.Playlist, erro
 		tmplData.SourcesErr = "Cannot have two of the same source."
 	}
 
+	var sourceNames []string
+	for _, fts := range data.trackSources {
+		sourceNames = append(sourceNames, fts.Name)
+	}
+	worstCase := naming.WorstCase(sourceNames)
+	// Archive mode adds the date to the name when it builds, so that has to fit too
+	nameTemplate := data.name
+	if data.outputMode == store.Archive {
+		nameTemplate = naming.ArchiveName(data.name)
+	}
+
 	if len(data.name) == 0 {
 		invalid = true
 		tmplData.NameErr = "Name can't be empty."
-	}
-	if len(data.name) > 50 {
+	} else if utf8.RuneCountInString(data.name) > maxNameTemplate {
 		invalid = true
 		tmplData.NameErr = "Name is too long."
-	}
-	if !isASCII(data.name) {
+	} else if !isPrintable(data.name) {
 		invalid = true
 		tmplData.NameErr = "Name contains invalid characters."
+	} else if err := naming.Validate(nameTemplate, worstCase, naming.NameLimit); errors.Is(err, naming.ErrTooLong) {
+		invalid = true
+		tmplData.NameErr = fmt.Sprintf("Name can be longer than %d characters once filled in.", naming.NameLimit)
+		if nameTemplate != data.name {
+			tmplData.NameErr = fmt.Sprintf("Name can be longer than %d characters once the date archived builds add is filled in.", naming.NameLimit)
+		}
+	} else if err != nil {
+		invalid = true
+		tmplData.NameErr = "Name has an invalid template, check the braces and variable names."
 	}
-	if len(data.description) > 250 {
+	if utf8.RuneCountInString(data.description) > maxDescriptionTemplate {
 		invalid = true
 		tmplData.DescriptionErr = "Description is too long."
-	}
-	if !isASCII(data.description) {
+	} else if !isPrintable(data.description) {
 		invalid = true
 		tmplData.DescriptionErr = "Description contains invalid characters."
+	} else if err := naming.Validate(data.description, worstCase, naming.DescriptionLimit); errors.Is(err, naming.ErrTooLong) {
+		invalid = true
+		tmplData.DescriptionErr = fmt.Sprintf("Description can be longer than %d characters once filled in.", naming.DescriptionLimit)
+	} else if err != nil {
+		invalid = true
+		tmplData.DescriptionErr = "Description has an invalid template, check the braces and variable names."
+	}
+	if data.collab && data.public {
+		invalid = true
+		tmplData.AccessErr = "Collaborative playlists have to be private."
+	}
+	if data.collabPolicy == "" {
+		data.collabPolicy = store.DropAdded
+	}
+	if data.editPolicy == "" {
+		data.editPolicy = store.CarryEdits
+	}
+	if data.schedule == store.Custom {
+		if data.cron == "" {
+			invalid = true
+			tmplData.ScheduleErr = "Custom schedules need a cron expression."
+		} else if len(data.cron) > 100 {
+			invalid = true
+			tmplData.ScheduleErr = "Cron expression is too long."
+		} else if cron, err := schedule.Parse(data.cron); err != nil {
+			invalid = true
+			tmplData.ScheduleErr = fmt.Sprintf("Cron expression is invalid: %s.", err.Error())
+		} else if cron.Next(time.Now().UTC()).IsZero() {
+			invalid = true
+			tmplData.ScheduleErr = "Cron expression never matches a real date."
+		}
+	}
+	if data.buildTime == "" {
+		data.buildTime = schedule.DefaultBuildTime
+	}
+	if _, err := schedule.ParseBuildTime(data.buildTime); err != nil {
+		invalid = true
+		tmplData.ScheduleErr = "Build time must be a time of day like 06:00."
+	}
+	startsOn, err := parseFormDate(data.startsOn)
+	if err != nil {
+		invalid = true
+		tmplData.DatesErr = "Start date is invalid."
+	}
+	endsOn, err := parseFormDate(data.endsOn)
+	if err != nil {
+		invalid = true
+		tmplData.DatesErr = "End date is invalid."
+	}
+	if startsOn != nil && endsOn != nil && endsOn.Before(*startsOn) {
+		invalid = true
+		tmplData.DatesErr = "End date can't be before the start date."
+	}
+	if data.outputMode == "" {
+		data.outputMode = store.Replace
+	}
+	// The number of builds to keep is hidden, and so ignored, unless archiving
+	keepBuilds, err := strconv.Atoi(data.keepBuilds)
+	if data.outputMode == store.Archive {
+		if err != nil {
+			invalid = true
+			tmplData.OutputErr = "Number of builds to keep is not a number."
+		} else if keepBuilds < 1 || keepBuilds > maxKeepBuilds {
+			invalid = true
+			tmplData.OutputErr = fmt.Sprintf("Keep between 1 and %d builds.", maxKeepBuilds)
+		}
+	} else if err != nil || keepBuilds < 1 || keepBuilds > maxKeepBuilds {
+		keepBuilds = defaultKeepBuilds
 	}
 	if len(data.trackSources) == 0 {
 		invalid = true
@@ -313,6 +550,90 @@ func parsePlaylistForm(values url.Values) (*store.Playlist, *tmpl.Playlist, erro
 			invalid = true
 			return nil, nil, errors.New("empty imageURL on source")
 		}
+		filtersErr, err := checkSourceFilters(fts.TrackSource)
+		if err != nil {
+			return nil, nil, err
+		}
+		if filtersErr != "" {
+			invalid = true
+			fts.FiltersErr = filtersErr
+		}
+	}
+
+	if duplicatePin {
+		invalid = true
+		tmplData.PinnedErr = "Cannot pin the same track twice."
+	}
+	if len(data.pinned) > maxPinned {
+		invalid = true
+		tmplData.PinnedErr = fmt.Sprintf("Pin at most %d tracks.", maxPinned)
+	}
+	var pinned []store.PinnedTrack
+	positions := make(map[int]bool)
+	for _, pin := range data.pinned {
+		if len(pin.Name) == 0 || len(pin.Name) > 300 {
+			return nil, nil, errors.New("invalid name on pinned track")
+		}
+		if pin.Position != 0 && positions[pin.Position] {
+			invalid = true
+			tmplData.PinnedErr = "Two pinned tracks can't share a position."
+		}
+		positions[pin.Position] = true
+		pinned = append(pinned, *pin)
+	}
+	sortPins(pinned)
+
+	// Like the number of builds to keep, the max size only matters when appending
+	maxSize, err := strconv.Atoi(data.maxSize)
+	if data.outputMode == store.Append {
+		totalCount := 0
+		for _, fts := range data.trackSources {
+			totalCount += fts.Count
+		}
+		totalCount += len(pinned)
+		if err != nil {
+			invalid = true
+			tmplData.OutputErr = "Max size is not a number."
+		} else if maxSize < 1 || maxSize > maxPlaylistSize {
+			invalid = true
+			tmplData.OutputErr = fmt.Sprintf("Max size must be between 1 and %d tracks.", maxPlaylistSize)
+		} else if maxSize < totalCount {
+			invalid = true
+			tmplData.OutputErr = fmt.Sprintf("Max size must fit the %d tracks added by each build.", totalCount)
+		}
+	} else if err != nil || maxSize < 1 || maxSize > maxPlaylistSize {
+		maxSize = defaultMaxSize
+	}
+
+	// Splitting starts every part over so it only works with playlists that are replaced
+	if data.split == "" {
+		data.split = store.NoSplit
+	}
+	if data.split != store.NoSplit && data.outputMode != store.Replace {
+		invalid = true
+		tmplData.SplitErr = "Only playlists replaced with each build can be split."
+	} else if data.split != store.NoSplit && data.collab {
+		invalid = true
+		tmplData.SplitErr = "Collaborative playlists can't be split."
+	}
+	splitSize, err := strconv.Atoi(data.splitSize)
+	if data.split == store.SplitBySize {
+		totalCount := len(pinned)
+		for _, fts := range data.trackSources {
+			totalCount += fts.Count
+		}
+		if err != nil {
+			invalid = true
+			tmplData.SplitErr = "Tracks per part is not a number."
+		} else if splitSize < 1 || splitSize > maxPlaylistSize {
+			invalid = true
+			tmplData.SplitErr = fmt.Sprintf("Tracks per part must be between 1 and %d.", maxPlaylistSize)
+		} else if splitSize*build.MaxSplitTargets < totalCount {
+			invalid = true
+			tmplData.SplitErr = fmt.Sprintf("Parts must be big enough to fit the %d tracks in each build into %d playlists.", totalCount, build.MaxSplitTargets)
+		}
+	} else if err != nil || splitSize < 1 || splitSize > maxPlaylistSize {
+		splitSize = defaultSplitSize
 	}
 
 	if invalid {
@@ -320,7 +641,20 @@ func parsePlaylistForm(values url.Values) (*store.Playlist, *tmpl.Playlist, erro
 		tmplData.Description = data.description
 		tmplData.IsNew = false
 		tmplData.Public = data.public
+		tmplData.Collaborative = data.collab
+		tmplData.CollaboratorPolicy = data.collabPolicy
+		tmplData.EditPolicy = data.editPolicy
+		tmplData.Pinned = pinned
 		tmplData.Schedule = data.schedule
+		tmplData.Cron = data.cron
+		tmplData.BuildTime = data.buildTime
+		tmplData.StartsOn = data.startsOn
+		tmplData.EndsOn = data.endsOn
+		tmplData.OutputMode = data.outputMode
+		tmplData.KeepBuilds = data.keepBuilds
+		tmplData.MaxSize = data.maxSize
+		tmplData.Split = data.split
+		tmplData.SplitSize = data.splitSize
 
 		var srcs []tmpl.TrackSource
 		for _, v := range data.trackSources {
@@ -338,7 +672,21 @@ func parsePlaylistForm(values url.Values) (*store.Playlist, *tmpl.Playlist, erro
 	playlist.Name = data.name
 	playlist.Description = data.description
 	playlist.Public = data.public
+	playlist.Collaborative = data.collab
+	playlist.CollaboratorPolicy = data.collabPolicy
+	playlist.EditPolicy = data.editPolicy
 	playlist.Schedule = data.schedule
+	playlist.BuildTime = data.buildTime
+	playlist.StartsOn = startsOn
+	playlist.EndsOn = endsOn
+	playlist.OutputMode = data.outputMode
+	playlist.KeepBuilds = keepBuilds
+	playlist.MaxSize = maxSize
+	playlist.SplitMode = data.split
+	playlist.SplitSize = splitSize
+	if data.schedule == store.Custom {
+		playlist.Cron = &data.cron
+	}
 
 	// Add input to playlist
 	input := store.Input{}
@@ -350,16 +698,265 @@ func parsePlaylistForm(values url.Values) (*store.Playlist, *tmpl.Playlist, erro
 			Count:    ets.Count,
 			Method:   ets.Method,
 			ImageURL: ets.ImageURL, // TODO where is this coming from... Need to embed in form?
+			Filters:  ets.Filters,
 		}
 		input.TrackSources = append(input.TrackSources, ts)
 	}
+	input.Pinned = pinned
 	playlist.Input = input
 	return &playlist, nil, nil
 }
 
-func isASCII(s string) bool {
-	for i := 0; i < len(s); i++ {
-		if s[i] > unicode.MaxASCII {
+// sortPins orders pins the way they end up in a build: those fixed to the start,
+// then those without a position and finally those fixed to the end
+func sortPins(pins []store.PinnedTrack) {
+	part := func(pin store.PinnedTrack) int {
+		switch {
+		case pin.Position > 0:
+			return 0
+		case pin.Position == 0:
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(pins, func(i, j int) bool {
+		if part(pins[i]) != part(pins[j]) {
+			return part(pins[i]) < part(pins[j])
+		}
+		if pins[i].Position != pins[j].Position {
+			return pins[i].Position < pins[j].Position
+		}
+		return pins[i].Name < pins[j].Name
+	})
+}
+
+// parseSourceFilters rebuilds a source's filters from its form values. Each filter is submitted
+// as its depth, operation, type, ID and name joined by ::, with every group followed by the
+// filters inside it and leaving its type, ID and name empty.
+func parseSourceFilters(values []string) ([]store.SourceFilter, error) {
+	filters, rest, err := parseFilterLevel(values, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("invalid source filter: %v", rest[0])
+	}
+	return filters, nil
+}
+
+// parseFilterLevel parses the filters at depth from the start of values, returning the values
+// left after them
+func parseFilterLevel(values []string, depth int) ([]store.SourceFilter, []string, error) {
+	var filters []store.SourceFilter
+	for len(values) > 0 {
+		fields := strings.SplitN(values[0], "::", 5)
+		if len(fields) != 5 {
+			return nil, nil, fmt.Errorf("invalid source filter: %v", values[0])
+		}
+		filterDepth, err := strconv.Atoi(fields[0])
+		if err != nil || filterDepth > depth {
+			return nil, nil, fmt.Errorf("invalid source filter depth: %v", fields[0])
+		}
+		if filterDepth < depth {
+			break
+		}
+		values = values[1:]
+
+		var filter store.SourceFilter
+		switch fields[1] {
+		case string(store.Intersect):
+			filter.Op = store.Intersect
+		case string(store.Subtract):
+			filter.Op = store.Subtract
+		case string(store.All):
+			filter.Op = store.All
+		case string(store.Any):
+			filter.Op = store.Any
+		default:
+			return nil, nil, fmt.Errorf("invalid filter operation: %v", fields[1])
+		}
+		if filter.IsGroup() {
+			if depth+1 > maxFilterDepth {
+				return nil, nil, fmt.Errorf("source filter groups nested too deep: %v", depth+1)
+			}
+			filter.Children, values, err = parseFilterLevel(values, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+		} else {
+			switch fields[2] {
+			case string(store.AlbumSrc):
+				filter.Type = store.AlbumSrc
+			case string(store.LikedSrc):
+				filter.Type = store.LikedSrc
+			case string(store.PlaylistSrc):
+				filter.Type = store.PlaylistSrc
+			default:
+				return nil, nil, fmt.Errorf("invalid filter source type: %v", fields[2])
+			}
+			filter.ID = fields[3]
+			filter.Name = fields[4]
+		}
+		filters = append(filters, filter)
+	}
+	return filters, values, nil
+}
+
+// checkSourceFilters returns a message describing what is wrong with a source's filters or ""
+// if they are fine. Filters that couldn't have come from the form are an error instead.
+func checkSourceFilters(source store.TrackSource) (string, error) {
+	compared := 0
+	msg := ""
+	var check func(filters []store.SourceFilter) error
+	check = func(filters []store.SourceFilter) error {
+		for _, filter := range filters {
+			if filter.IsGroup() {
+				if len(filter.Children) == 0 {
+					msg = "Pick at least one source in every group."
+				}
+				err := check(filter.Children)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if len(filter.ID) == 0 || len(filter.Name) == 0 {
+				return errors.New("empty ID or name on source filter")
+			}
+			if filter.ID == source.ID && filter.Type == source.Type {
+				msg = "A source can't be narrowed down by itself."
+			}
+			compared++
+		}
+		return nil
+	}
+	err := check(source.Filters)
+	if err != nil {
+		return "", err
+	}
+	if compared > maxSourceFilters {
+		msg = fmt.Sprintf("Narrow down a source with at most %d other sources.", maxSourceFilters)
+	}
+	return msg, nil
+}
+
+// parseFormDate parses an optional date input, returning nil if it was left empty
+func parseFormDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse(formDateLayout, value)
+	if err != nil {
+		return nil, err
+	}
+	return &date, nil
+}
+
+// formatFormDate formats an optional date for a date input
+func formatFormDate(date *time.Time) string {
+	if date == nil {
+		return ""
+	}
+	return date.Format(formDateLayout)
+}
+
+// parseSettingsForm validates the user settings form. If the form is invalid
+// the returned template data is non-nil and describes what is wrong.
+func parseSettingsForm(values url.Values) (*store.UserSettings, *tmpl.Settings) {
+	rawEmail := strings.TrimSpace(values.Get("email"))
+	settings := store.UserSettings{
+		NotifyOn:       store.NotifyOn(values.Get("notifyOn")),
+		NotifyDelivery: store.NotifyDelivery(values.Get("notifyDelivery")),
+		Timezone:       strings.TrimSpace(values.Get("timezone")),
+	}
+
+	// Fall back to the defaults for anything unrecognized
+	switch settings.NotifyOn {
+	case store.NotifyNever, store.NotifyEvery, store.NotifyRepeated:
+	default:
+		settings.NotifyOn = store.NotifyNever
+	}
+	switch settings.NotifyDelivery {
+	case store.Immediate, store.Digest:
+	default:
+		settings.NotifyDelivery = store.Immediate
+	}
+
+	invalid := false
+	tmplData := tmpl.Settings{
+		Email:          rawEmail,
+		NotifyOn:       settings.NotifyOn,
+		NotifyDelivery: settings.NotifyDelivery,
+		Timezone:       settings.Timezone,
+	}
+
+	if rawEmail == "" && settings.NotifyOn != store.NotifyNever {
+		invalid = true
+		tmplData.EmailErr = "Email is required to get notifications"
+	} else if rawEmail != "" {
+		addr, err := mail.ParseAddress(rawEmail)
+		if err != nil || addr.Address != rawEmail || len(rawEmail) > 254 {
+			invalid = true
+			tmplData.EmailErr = "Email is not valid"
+		}
+	}
+	if settings.Timezone == "" {
+		settings.Timezone = "UTC"
+	}
+	// LoadLocation also accepts "Local" which would mean the server's timezone
+	if _, err := time.LoadLocation(settings.Timezone); err != nil || settings.Timezone == "Local" || len(settings.Timezone) > 64 {
+		invalid = true
+		tmplData.TimezoneErr = "Timezone is not a known IANA timezone like America/Edmonton"
+	}
+
+	if invalid {
+		return nil, &tmplData
+	}
+	if rawEmail != "" {
+		settings.Email = &rawEmail
+	}
+	return &settings, nil
+}
+
+// validateWebhookURL returns a message describing what is wrong with a webhook URL or "" if it is fine
+func validateWebhookURL(ctx context.Context, rawURL string) string {
+	if rawURL == "" {
+		return "URL is required"
+	}
+	if len(rawURL) > 2000 {
+		return "URL must be under 2000 characters"
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "URL is not valid"
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return "URL must start with http:// or https://"
+	}
+	if err := webhook.CheckHost(ctx, u.Hostname()); errors.Is(err, webhook.ErrDisallowedAddress) {
+		return "URL must point at a public address"
+	} else if err != nil {
+		return "URL host could not be found"
+	}
+	return ""
+}
+
+// pluralTracks counts tracks in words, like "1 track" or "3 tracks"
+func pluralTracks(n int) string {
+	if n == 1 {
+		return "1 track"
+	}
+	return fmt.Sprintf("%d tracks", n)
+}
+
+// isPrintable reports whether s is valid UTF-8 without control characters. Line breaks
+// and tabs are allowed since they are collapsed into spaces when the text is rendered.
+func isPrintable(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
 			return false
 		}
 	}
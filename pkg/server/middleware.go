@@ -61,7 +61,7 @@ func newSessionAuthMiddleware(store store.Store, log *zap.SugaredLogger, blackli
 			}
 
 			// Get session expiry
-			sessionExpiry, err := store.GetSessionExpiry(sessionCookie.Value)
+			sessionExpiry, err := store.GetSessionExpiry(r.Context(), sessionCookie.Value)
 			if err != nil {
 				log.Warnw("user not authenticated: no matching user", "err", err.Error())
 				log.Info("redirecting to /login")
@@ -78,7 +78,7 @@ func newSessionAuthMiddleware(store store.Store, log *zap.SugaredLogger, blackli
 			}
 
 			// Store userID in context
-			userID, err := store.GetUserID(sessionCookie.Value)
+			userID, err := store.GetUserID(r.Context(), sessionCookie.Value)
 			if err != nil {
 				log.Errorw("something failed fetching userID", "err", err.Error())
 				log.Info("redirecting to /login")
@@ -1,12 +1,16 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/calebschoepp/playlist-rotator/pkg/schedule"
 	"github.com/calebschoepp/playlist-rotator/pkg/store"
 	"github.com/calebschoepp/playlist-rotator/pkg/tmpl"
 	"github.com/google/uuid"
@@ -14,6 +18,18 @@ import (
 	"github.com/zmb3/spotify"
 )
 
+// heartbeatInterval keeps idle event streams from being closed by proxies
+const heartbeatInterval = 30 * time.Second
+
+// maxWebhooks is how many webhook endpoints a single user can register
+const maxWebhooks = 5
+
+// trackSearchSize is how many tracks a search for a track to pin shows
+const trackSearchSize = 8
+
+// deliveryLogSize is how many recent webhook deliveries are shown to a user
+const deliveryLogSize = 50
+
 func (s *Server) homePage(w http.ResponseWriter, r *http.Request) {
 	// State should be randomly generated and passed along with Oauth request
 	// in cookie for security purposes
@@ -80,7 +96,7 @@ func (s *Server) callbackPage(w http.ResponseWriter, r *http.Request) {
 
 	// Get spotify ID
 	client := s.Spotify.NewClient(token)
-	privateUser, err := client.CurrentUser()
+	privateUser, err := client.CurrentUser(r.Context())
 	if err != nil {
 		s.Log.Errorw("failed to get current spotify userID", "err", err.Error())
 		http.Error(w, "server error", http.StatusInternalServerError)
@@ -89,7 +105,7 @@ func (s *Server) callbackPage(w http.ResponseWriter, r *http.Request) {
 	spotifyID := privateUser.User.ID
 
 	// Check if user already exists for the spotify ID
-	userExists, err := s.Store.UserExists(spotifyID)
+	userExists, err := s.Store.UserExists(r.Context(), spotifyID)
 	if err != nil {
 		s.Log.Errorw("failed to check if user already exists in db", "err", err.Error(), "spotifyID", spotifyID)
 		http.Error(w, "server error", http.StatusInternalServerError)
@@ -98,6 +114,7 @@ func (s *Server) callbackPage(w http.ResponseWriter, r *http.Request) {
 	if userExists {
 		// Update user with new token and session data
 		err = s.Store.UpdateUser(
+			r.Context(),
 			spotifyID,
 			sessionToken,
 			sessionExpiry,
@@ -111,6 +128,7 @@ func (s *Server) callbackPage(w http.ResponseWriter, r *http.Request) {
 	} else {
 		// Create a new user
 		err = s.Store.CreateUser(
+			r.Context(),
 			spotifyID,
 			sessionToken,
 			sessionExpiry,
@@ -138,18 +156,19 @@ func (s *Server) dashboardPage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Build spotify client
-	user, err := s.Store.GetUserByID(*userID)
+	user, err := s.Store.GetUserByID(r.Context(), *userID)
 	if err != nil {
 		s.Log.Errorw("failed to load user from db", "err", err.Error())
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
 	client := s.Spotify.NewClient(&user.Token)
+	loc := user.Location()
 
 	tmplData := tmpl.Dashboard{}
 
 	// Get playlists
-	playlists, err := s.Store.GetPlaylists(*userID)
+	playlists, err := s.Store.GetPlaylists(r.Context(), *userID)
 	if err != nil {
 		s.Log.Errorw("failed to load playlists from db", "err", err.Error())
 		http.Error(w, "server error", http.StatusInternalServerError)
@@ -166,40 +185,43 @@ func (s *Server) dashboardPage(w http.ResponseWriter, r *http.Request) {
 		// Scheduling messages
 		var scheduleBlurb string
 		var scheduleSentence string
-		format := "Scheduled to build at %s"
-		layout := "3 PM on Monday, January 2"
-		lastBuilt := p.LastBuiltAt
-		overrideSentence := false
-		if lastBuilt == nil && p.Schedule != store.Never {
-			t := time.Now()
-			lastBuilt = &t
-			overrideSentence = true
-		}
-		schedule := p.Schedule
-		switch schedule {
+		switch p.Schedule {
 		case store.Never:
 			scheduleBlurb = ""
-			scheduleSentence = "Click the build button to generate the playlist."
 		case store.Daily:
 			scheduleBlurb = "built daily"
-			t := lastBuilt.AddDate(0, 0, 1)
-			scheduleSentence = fmt.Sprintf(format, t.Format(layout))
 		case store.Weekly:
 			scheduleBlurb = "built weekly"
-			t := lastBuilt.AddDate(0, 0, 7)
-			scheduleSentence = fmt.Sprintf(format, t.Format(layout))
 		case store.BiWeekly:
 			scheduleBlurb = "built bi-weekly"
-			t := lastBuilt.AddDate(0, 0, 14)
-			scheduleSentence = fmt.Sprintf(format, t.Format(layout))
 		case store.Monthly:
 			scheduleBlurb = "built monthly"
-			t := lastBuilt.AddDate(0, 1, 0)
-			scheduleSentence = fmt.Sprintf(format, t.Format(layout))
+		case store.Custom:
+			scheduleBlurb = "built on a custom schedule"
 		}
-
-		if overrideSentence {
+		next, err := schedule.Next(p, loc)
+		if err != nil {
+			s.Log.Warnw("failed to compute next build time", "err", err.Error(), "playlistID", p.ID)
+		}
+		if p.Paused && p.Schedule != store.Never {
+			scheduleBlurb = "paused"
+		}
+		if p.Schedule == store.Never {
+			scheduleSentence = "Click the build button to generate the playlist."
+		} else if p.Paused {
+			scheduleSentence = "Paused. Resume it to start building on schedule again."
+		} else if p.LastBuiltAt == nil {
 			scheduleSentence = "You need to click the build button once before it will build automatically."
+		} else if next != nil && p.StartsOn != nil && next.Before(schedule.StartOfDate(*p.StartsOn, loc).AddDate(0, 0, 1)) {
+			scheduleSentence = fmt.Sprintf("Starts building on %s at %s", p.StartsOn.Format("Monday, January 2"), next.Format("3:04 PM MST"))
+		} else if next != nil {
+			scheduleSentence = fmt.Sprintf("Scheduled to build at %s", next.Format("3:04 PM MST on Monday, January 2"))
+		} else if p.EndsOn != nil && time.Now().After(schedule.StartOfDate(*p.EndsOn, loc).AddDate(0, 0, 1)) {
+			scheduleSentence = fmt.Sprintf("Stopped building after %s. Edit its end date to keep it going.", p.EndsOn.Format("Monday, January 2"))
+		} else if p.EndsOn != nil {
+			scheduleSentence = fmt.Sprintf("No more builds fit before its end date of %s.", p.EndsOn.Format("Monday, January 2"))
+		} else {
+			scheduleSentence = "This schedule never comes around, edit it to pick a time that exists."
 		}
 
 		// Build status
@@ -218,7 +240,7 @@ func (s *Server) dashboardPage(w http.ResponseWriter, r *http.Request) {
 		// Playlist cover image
 		imageURL := "/static/missing_cover_image.svg"
 		if p.SpotifyID != nil {
-			spotifyPlaylist, err := client.GetPlaylistOpt(spotify.ID(*p.SpotifyID), "images")
+			spotifyPlaylist, err := client.GetPlaylistOpt(r.Context(), spotify.ID(*p.SpotifyID), "images")
 			if err != nil {
 				s.Log.Warnw("failed to fetch cover image for playlist", "err", err.Error(), "spotifyID", *p.SpotifyID)
 			}
@@ -237,13 +259,13 @@ func (s *Server) dashboardPage(w http.ResponseWriter, r *http.Request) {
 			case store.LikedSrc:
 				srcImageURL = "/static/liked_songs_cover.svg"
 			case store.AlbumSrc:
-				spotifyAlbum, err := client.GetAlbum(spotify.ID(p.Input.TrackSources[i].ID))
+				spotifyAlbum, err := client.GetAlbum(r.Context(), spotify.ID(p.Input.TrackSources[i].ID))
 				if err != nil || len(spotifyAlbum.Images) == 0 {
 					s.Log.Warnw("failed to fetch cover image for album track source", "err", err.Error(), "spotifyID", p.Input.TrackSources[i].ID)
 				}
 				srcImageURL = spotifyAlbum.Images[0].URL
 			case store.PlaylistSrc:
-				spotifyPlaylist, err := client.GetPlaylistOpt(spotify.ID(p.Input.TrackSources[i].ID), "images")
+				spotifyPlaylist, err := client.GetPlaylistOpt(r.Context(), spotify.ID(p.Input.TrackSources[i].ID), "images")
 				if err != nil || len(spotifyPlaylist.Images) == 0 {
 					s.Log.Warnw("failed to fetch cover image for playlist track source", "err", err.Error(), "spotifyID", p.Input.TrackSources[i].ID)
 
@@ -260,6 +282,30 @@ func (s *Server) dashboardPage(w http.ResponseWriter, r *http.Request) {
 			failureBlurb = ""
 		}
 
+		// What the last build found was changed by hand in Spotify
+		var edits []string
+		if p.EditsAdded > 0 && p.EditPolicy == store.PinEdits {
+			edits = append(edits, fmt.Sprintf("pinned %s you added", pluralTracks(p.EditsAdded)))
+		} else if p.EditsAdded > 0 {
+			edits = append(edits, fmt.Sprintf("kept %s you added", pluralTracks(p.EditsAdded)))
+		}
+		if p.EditsRemoved > 0 {
+			edits = append(edits, fmt.Sprintf("left out %s you removed", pluralTracks(p.EditsRemoved)))
+		}
+		var editsSentence string
+		if len(edits) > 0 {
+			editsSentence = fmt.Sprintf("The last build %s.", strings.Join(edits, " and "))
+		}
+
+		// Split playlists were built into more than one spotify playlist
+		var targets []store.OutputTarget
+		if p.SplitMode != store.NoSplit && p.Current {
+			targets, err = s.Store.GetOutputTargets(r.Context(), p.ID)
+			if err != nil {
+				s.Log.Warnw("failed to get output targets for playlist", "err", err.Error(), "playlistID", p.ID)
+			}
+		}
+
 		pInfo := tmpl.PlaylistInfo{
 			Playlist:         p,
 			TotalSongs:       totalSongs,
@@ -268,6 +314,8 @@ func (s *Server) dashboardPage(w http.ResponseWriter, r *http.Request) {
 			ScheduleSentence: scheduleSentence,
 			ImageURL:         imageURL,
 			FailureBlurb:     failureBlurb,
+			EditsSentence:    editsSentence,
+			Targets:          targets,
 		}
 		tmplData.Playlists = append(tmplData.Playlists, pInfo)
 	}
@@ -303,7 +351,7 @@ func (s *Server) playlistPage(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "invalid playlistID", http.StatusInternalServerError)
 			return
 		}
-		playlist, err := s.Store.GetPlaylist(pid)
+		playlist, err := s.Store.GetPlaylist(r.Context(), pid)
 		if err != nil {
 			s.Log.Errorw("failed to get playlist from db", "err", err.Error())
 			http.Error(w, "server error", http.StatusInternalServerError)
@@ -313,10 +361,34 @@ func (s *Server) playlistPage(w http.ResponseWriter, r *http.Request) {
 		tmplData.Name = playlist.Name
 		tmplData.Description = playlist.Description
 		tmplData.Public = playlist.Public
+		tmplData.Collaborative = playlist.Collaborative
+		tmplData.CollaboratorPolicy = playlist.CollaboratorPolicy
+		tmplData.EditPolicy = playlist.EditPolicy
+		tmplData.Pinned = playlist.Input.Pinned
+		sortPins(tmplData.Pinned)
 		tmplData.Schedule = playlist.Schedule
+		if playlist.Cron != nil {
+			tmplData.Cron = *playlist.Cron
+		}
+		tmplData.BuildTime = playlist.BuildTime
+		tmplData.StartsOn = formatFormDate(playlist.StartsOn)
+		tmplData.EndsOn = formatFormDate(playlist.EndsOn)
+		tmplData.OutputMode = playlist.OutputMode
+		tmplData.KeepBuilds = strconv.Itoa(playlist.KeepBuilds)
+		tmplData.MaxSize = strconv.Itoa(playlist.MaxSize)
+		tmplData.Split = playlist.SplitMode
+		tmplData.SplitSize = strconv.Itoa(playlist.SplitSize)
+
+		excluded, err := s.Store.GetExcludedTracks(r.Context(), pid)
+		if err != nil {
+			s.Log.Errorw("failed to get excluded tracks from db", "err", err.Error(), "playlistID", pid)
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		tmplData.ExcludedCount = len(excluded)
 
 		// Build spotify client
-		user, err := s.Store.GetUserByID(*userID)
+		user, err := s.Store.GetUserByID(r.Context(), *userID)
 		if err != nil {
 			s.Log.Errorw("failed to get user from db", "err", err.Error())
 			http.Error(w, "server error", http.StatusInternalServerError)
@@ -331,13 +403,13 @@ func (s *Server) playlistPage(w http.ResponseWriter, r *http.Request) {
 			case store.LikedSrc:
 				srcImageURL = "/static/liked_songs_cover.svg"
 			case store.AlbumSrc:
-				spotifyAlbum, err := client.GetAlbum(spotify.ID(playlist.Input.TrackSources[i].ID))
+				spotifyAlbum, err := client.GetAlbum(r.Context(), spotify.ID(playlist.Input.TrackSources[i].ID))
 				if err != nil || len(spotifyAlbum.Images) == 0 {
 					s.Log.Warnw("failed to fetch album source cover image", "err", err.Error(), "spotifyID", playlist.Input.TrackSources[i].ID)
 				}
 				srcImageURL = spotifyAlbum.Images[0].URL
 			case store.PlaylistSrc:
-				spotifyPlaylist, err := client.GetPlaylistOpt(spotify.ID(playlist.Input.TrackSources[i].ID), "images")
+				spotifyPlaylist, err := client.GetPlaylistOpt(r.Context(), spotify.ID(playlist.Input.TrackSources[i].ID), "images")
 				if err != nil || len(spotifyPlaylist.Images) == 0 {
 					s.Log.Warnw("failed to fetch playlist album source cover image", "err", err.Error(), "spotifyID", playlist.Input.TrackSources[i].ID)
 				}
@@ -356,6 +428,14 @@ func (s *Server) playlistPage(w http.ResponseWriter, r *http.Request) {
 		// New playlist so most things are empty. Set a few defaults
 		tmplData.IsNew = true
 		tmplData.Schedule = store.Weekly
+		tmplData.BuildTime = schedule.DefaultBuildTime
+		tmplData.OutputMode = store.Replace
+		tmplData.CollaboratorPolicy = store.DropAdded
+		tmplData.EditPolicy = store.CarryEdits
+		tmplData.KeepBuilds = strconv.Itoa(defaultKeepBuilds)
+		tmplData.MaxSize = strconv.Itoa(defaultMaxSize)
+		tmplData.Split = store.NoSplit
+		tmplData.SplitSize = strconv.Itoa(defaultSplitSize)
 		// Build a default source which is 10 latest liked songs
 		tmplData.Sources = []tmpl.TrackSource{
 			tmpl.TrackSource{
@@ -373,7 +453,7 @@ func (s *Server) playlistPage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Regardless we gather the potential sources
-	potentialSources, err := getPotentialSources(s.Store, s.Spotify, userID)
+	potentialSources, err := getPotentialSources(r.Context(), s.Store, s.Spotify, userID)
 	if err != nil {
 		s.Log.Errorw("failed to get potential track sources", "err", err.Error(), "userID", userID)
 		http.Error(w, "server error", http.StatusInternalServerError)
@@ -408,11 +488,18 @@ func (s *Server) playlistForm(w http.ResponseWriter, r *http.Request) {
 	if playlistTmplPtr != nil {
 		s.Log.Info("parsed invalid form")
 		playlistTmpl := *playlistTmplPtr
-		ps, err := getPotentialSources(s.Store, s.Spotify, userID)
+		ps, err := getPotentialSources(r.Context(), s.Store, s.Spotify, userID)
 		if err != nil {
 			s.Log.Errorw("failed to get potential sources", "err", err.Error())
 			http.Error(w, "server error", http.StatusInternalServerError)
 		}
+		if pid, err := uuid.Parse(playlistID); err == nil {
+			excluded, err := s.Store.GetExcludedTracks(r.Context(), pid)
+			if err != nil {
+				s.Log.Warnw("failed to get excluded tracks from db", "err", err.Error(), "playlistID", pid)
+			}
+			playlistTmpl.ExcludedCount = len(excluded)
+		}
 		s.Log.Debugw("before", "ps", playlistTmpl.PotentialSources)
 		playlistTmpl.PotentialSources = ps
 		s.Log.Debugw("after", "ps", playlistTmpl.PotentialSources)
@@ -423,14 +510,7 @@ func (s *Server) playlistForm(w http.ResponseWriter, r *http.Request) {
 	// Move data into store
 	playlist := *playlistPtr
 	if playlistID == "new" {
-		err := s.Store.CreatePlaylist(
-			*userID,
-			playlist.Input,
-			playlist.Name,
-			playlist.Description,
-			playlist.Public,
-			playlist.Schedule,
-		)
+		err := s.Store.CreatePlaylist(r.Context(), *userID, playlist)
 		if err != nil {
 			s.Log.Errorw("failed to insert playlist into db", "err", err.Error())
 			http.Error(w, "server error", http.StatusInternalServerError)
@@ -443,12 +523,20 @@ func (s *Server) playlistForm(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "invalid playlistID", http.StatusInternalServerError)
 			return
 		}
-		err = s.Store.UpdatePlaylistConfig(pid, playlist)
+		err = s.Store.UpdatePlaylistConfig(r.Context(), pid, playlist)
 		if err != nil {
 			s.Log.Errorw("failed to update playlist in db", "err", err.Error(), "playlistID", pid)
 			http.Error(w, "server error", http.StatusInternalServerError)
 			return
 		}
+		if r.Form.Get("clearExcluded") == "on" {
+			err = s.Store.ClearExcludedTracks(r.Context(), pid)
+			if err != nil {
+				s.Log.Errorw("failed to clear excluded tracks in db", "err", err.Error(), "playlistID", pid)
+				http.Error(w, "server error", http.StatusInternalServerError)
+				return
+			}
+		}
 	}
 
 	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
@@ -487,7 +575,7 @@ func (s *Server) playlistTrackSourceAPI(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Build spotify client
-	user, err := s.Store.GetUserByID(*userID)
+	user, err := s.Store.GetUserByID(r.Context(), *userID)
 	if err != nil {
 		s.Log.Errorw("failed to get user from db", "err", err.Error())
 		http.Error(w, "server error", http.StatusInternalServerError)
@@ -515,13 +603,13 @@ func (s *Server) playlistTrackSourceAPI(w http.ResponseWriter, r *http.Request)
 	case store.LikedSrc:
 		srcImageURL = "/static/liked_songs_cover.svg"
 	case store.AlbumSrc:
-		spotifyAlbum, err := client.GetAlbum(spotify.ID(source.ID))
+		spotifyAlbum, err := client.GetAlbum(r.Context(), spotify.ID(source.ID))
 		if err != nil || len(spotifyAlbum.Images) == 0 {
 			s.Log.Warnw("failed to fetch album cover image", "err", err.Error(), "spotifyID", source.ID)
 		}
 		srcImageURL = spotifyAlbum.Images[0].URL
 	case store.PlaylistSrc:
-		spotifyPlaylist, err := client.GetPlaylistOpt(spotify.ID(source.ID), "images")
+		spotifyPlaylist, err := client.GetPlaylistOpt(r.Context(), spotify.ID(source.ID), "images")
 		if err != nil || len(spotifyPlaylist.Images) == 0 {
 			s.Log.Warnw("failed to fetch playlist cover image", "err", err.Error(), "spotifyID", source.ID)
 		}
@@ -532,6 +620,97 @@ func (s *Server) playlistTrackSourceAPI(w http.ResponseWriter, r *http.Request)
 	s.Tmpl.TmplTrackSource(w, tmpl.TrackSource{TrackSource: source, CountErr: "", CountString: ""})
 }
 
+func (s *Server) playlistTrackSearch(w http.ResponseWriter, r *http.Request) {
+	// Get userID
+	userID := getUserID(r.Context())
+	if userID == nil {
+		s.Log.Error("failed to get userID from context")
+		http.Error(w, "failure authenticating", http.StatusForbidden)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" || len(query) > 100 {
+		http.Error(w, "invalid search", http.StatusBadRequest)
+		return
+	}
+
+	// Build spotify client
+	user, err := s.Store.GetUserByID(r.Context(), *userID)
+	if err != nil {
+		s.Log.Errorw("failed to get user from db", "err", err.Error())
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	client := s.Spotify.NewClient(&user.Token)
+
+	limit := trackSearchSize
+	result, err := client.SearchOpt(r.Context(), query, spotify.SearchTypeTrack, &spotify.Options{Limit: &limit})
+	if err != nil {
+		s.Log.Errorw("failed to search for tracks", "err", err.Error(), "query", query)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	tmplData := tmpl.TrackSearch{Query: query}
+	if result.Tracks != nil {
+		for _, track := range result.Tracks.Tracks {
+			var artists []string
+			for _, artist := range track.Artists {
+				artists = append(artists, artist.Name)
+			}
+			searched := tmpl.SearchedTrack{
+				ID:      string(track.ID),
+				Name:    track.Name,
+				Artists: strings.Join(artists, ", "),
+			}
+			// Images are largest first and these are shown as thumbnails
+			if images := track.Album.Images; len(images) > 0 {
+				searched.ImageURL = images[len(images)-1].URL
+			}
+			tmplData.Results = append(tmplData.Results, searched)
+		}
+	}
+
+	s.Tmpl.TmplTrackSearch(w, tmplData)
+}
+
+func (s *Server) playlistPinnedTrack(w http.ResponseWriter, r *http.Request) {
+	// Get userID
+	userID := getUserID(r.Context())
+	if userID == nil {
+		s.Log.Error("failed to get userID from context")
+		http.Error(w, "failure authenticating", http.StatusForbidden)
+		return
+	}
+
+	// Get track ID
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Build spotify client
+	user, err := s.Store.GetUserByID(r.Context(), *userID)
+	if err != nil {
+		s.Log.Errorw("failed to get user from db", "err", err.Error())
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	client := s.Spotify.NewClient(&user.Token)
+
+	track, err := client.GetTrack(r.Context(), spotify.ID(id))
+	if err != nil {
+		s.Log.Errorw("failed to get track to pin", "err", err.Error(), "spotifyID", id)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	pin := store.PinnedTrack{ID: string(track.ID), Name: track.Name}
+	if len(track.Artists) > 0 {
+		pin.Name += " - " + track.Artists[0].Name
+	}
+	s.Tmpl.TmplPinnedTrack(w, pin)
+}
+
 func (s *Server) playlistBuild(w http.ResponseWriter, r *http.Request) {
 	// Get userID
 	userID := getUserID(r.Context())
@@ -551,8 +730,42 @@ func (s *Server) playlistBuild(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.Log.Info("triggering background go routine to build playlist")
-	go s.Builder.BuildPlaylist(*userID, playlistID)
+	s.Log.Info("enqueueing job to build playlist")
+	err = s.Store.EnqueueJob(r.Context(), store.BuildJob, *userID, playlistID)
+	if err != nil {
+		s.Log.Errorw("failed to enqueue build job", "err", err.Error(), "playlistID", playlistID)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) playlistCancel(w http.ResponseWriter, r *http.Request) {
+	// Get userID
+	userID := getUserID(r.Context())
+	if userID == nil {
+		s.Log.Error("failed to get userID from context")
+		http.Error(w, "failure authenticating", http.StatusForbidden)
+		return
+	}
+
+	// Get playlistID
+	vars := mux.Vars(r)
+	pid := vars["playlistID"]
+	playlistID, err := uuid.Parse(pid)
+	if err != nil {
+		s.Log.Errorw("failed to parse playlist as UUID", "err", err.Error())
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	s.Log.Info("cancelling playlist build")
+	err = s.Builder.CancelBuild(r.Context(), *userID, playlistID)
+	if err != nil {
+		s.Log.Errorw("failed to cancel build", "err", err.Error(), "playlistID", playlistID)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
 	w.WriteHeader(http.StatusAccepted)
 }
 
@@ -575,11 +788,284 @@ func (s *Server) playlistDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.Log.Info("triggering background go routine to delete playlist")
-	go s.Builder.DeletePlaylist(*userID, playlistID)
+	s.Log.Info("enqueueing job to delete playlist")
+	err = s.Store.EnqueueJob(r.Context(), store.DeleteJob, *userID, playlistID)
+	if err != nil {
+		s.Log.Errorw("failed to enqueue delete job", "err", err.Error(), "playlistID", playlistID)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// buildEvents streams progress events for the user's playlist builds as Server-Sent Events
+func (s *Server) buildEvents(w http.ResponseWriter, r *http.Request) {
+	// Get userID
+	userID := getUserID(r.Context())
+	if userID == nil {
+		s.Log.Error("failed to get userID from context")
+		http.Error(w, "failure authenticating", http.StatusForbidden)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.Log.Error("response writer does not support flushing")
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := s.Events.Subscribe(*userID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case e := <-events:
+			data, err := json.Marshal(e)
+			if err != nil {
+				s.Log.Errorw("failed to marshal build event", "err", err.Error())
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+func (s *Server) settingsPage(w http.ResponseWriter, r *http.Request) {
+	// Get userID
+	userID := getUserID(r.Context())
+	if userID == nil {
+		s.Log.Error("failed to get userID from context")
+		http.Error(w, "failure authenticating", http.StatusForbidden)
+		return
+	}
+
+	user, err := s.Store.GetUserByID(r.Context(), *userID)
+	if err != nil {
+		s.Log.Errorw("failed to get user from db", "err", err.Error())
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	tmplData := tmpl.Settings{
+		Enabled:        s.Config.SMTPHost != "",
+		NotifyOn:       user.NotifyOn,
+		NotifyDelivery: user.NotifyDelivery,
+		Timezone:       user.Timezone,
+	}
+	if user.Email != nil {
+		tmplData.Email = *user.Email
+	}
+	s.Tmpl.TmplSettings(w, tmplData)
+}
+
+func (s *Server) settingsForm(w http.ResponseWriter, r *http.Request) {
+	// Get userID
+	userID := getUserID(r.Context())
+	if userID == nil {
+		s.Log.Error("failed to get userID from context")
+		http.Error(w, "failure authenticating", http.StatusForbidden)
+		return
+	}
+
+	r.ParseForm()
+
+	settings, tmplPtr := parseSettingsForm(r.Form)
+	if tmplPtr != nil {
+		s.Log.Info("parsed invalid settings form")
+		tmplData := *tmplPtr
+		tmplData.Enabled = s.Config.SMTPHost != ""
+		s.Tmpl.TmplSettings(w, tmplData)
+		return
+	}
+
+	err := s.Store.UpdateUserSettings(r.Context(), *userID, *settings)
+	if err != nil {
+		s.Log.Errorw("failed to update user settings", "err", err.Error(), "userID", userID)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	tmplData := tmpl.Settings{
+		Enabled:        s.Config.SMTPHost != "",
+		Saved:          true,
+		NotifyOn:       settings.NotifyOn,
+		NotifyDelivery: settings.NotifyDelivery,
+		Timezone:       settings.Timezone,
+	}
+	if settings.Email != nil {
+		tmplData.Email = *settings.Email
+	}
+	s.Tmpl.TmplSettings(w, tmplData)
+}
+
+func (s *Server) webhooksPage(w http.ResponseWriter, r *http.Request) {
+	// Get userID
+	userID := getUserID(r.Context())
+	if userID == nil {
+		s.Log.Error("failed to get userID from context")
+		http.Error(w, "failure authenticating", http.StatusForbidden)
+		return
+	}
+
+	s.renderWebhooks(w, r, *userID, tmpl.Webhooks{})
+}
+
+func (s *Server) webhookForm(w http.ResponseWriter, r *http.Request) {
+	// Get userID
+	userID := getUserID(r.Context())
+	if userID == nil {
+		s.Log.Error("failed to get userID from context")
+		http.Error(w, "failure authenticating", http.StatusForbidden)
+		return
+	}
+
+	r.ParseForm()
+
+	rawURL := strings.TrimSpace(r.Form.Get("url"))
+	urlErr := validateWebhookURL(r.Context(), rawURL)
+	if urlErr == "" {
+		webhooks, err := s.Store.GetWebhooks(r.Context(), *userID)
+		if err != nil {
+			s.Log.Errorw("failed to get webhooks from db", "err", err.Error())
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		if len(webhooks) >= maxWebhooks {
+			urlErr = fmt.Sprintf("You can have at most %d webhooks", maxWebhooks)
+		}
+	}
+	if urlErr != "" {
+		s.Log.Info("parsed invalid webhook form")
+		s.renderWebhooks(w, r, *userID, tmpl.Webhooks{URL: rawURL, URLErr: urlErr})
+		return
+	}
+
+	secret, err := generateRandomString(32)
+	if err != nil {
+		s.Log.Errorw("failed to generate webhook secret", "err", err.Error())
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	err = s.Store.CreateWebhook(r.Context(), *userID, rawURL, secret)
+	if err != nil {
+		s.Log.Errorw("failed to insert webhook into db", "err", err.Error())
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+}
+
+func (s *Server) webhookDelete(w http.ResponseWriter, r *http.Request) {
+	// Get userID
+	userID := getUserID(r.Context())
+	if userID == nil {
+		s.Log.Error("failed to get userID from context")
+		http.Error(w, "failure authenticating", http.StatusForbidden)
+		return
+	}
+
+	// Get webhookID
+	vars := mux.Vars(r)
+	wid := vars["webhookID"]
+	webhookID, err := uuid.Parse(wid)
+	if err != nil {
+		s.Log.Errorw("failed to parse webhook as UUID", "err", err.Error())
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = s.Store.DeleteWebhook(r.Context(), *userID, webhookID)
+	if err != nil {
+		s.Log.Errorw("failed to delete webhook", "err", err.Error(), "webhookID", webhookID)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+}
+
+func (s *Server) playlistsPause(w http.ResponseWriter, r *http.Request) {
+	s.setPlaylistsPaused(w, r, true)
+}
+
+func (s *Server) playlistsResume(w http.ResponseWriter, r *http.Request) {
+	s.setPlaylistsPaused(w, r, false)
+}
+
+// setPlaylistsPaused pauses or resumes every playlist selected on the dashboard
+func (s *Server) setPlaylistsPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	// Get userID
+	userID := getUserID(r.Context())
+	if userID == nil {
+		s.Log.Error("failed to get userID from context")
+		http.Error(w, "failure authenticating", http.StatusForbidden)
+		return
+	}
+
+	// Get playlistIDs
+	r.ParseForm()
+	var playlistIDs []uuid.UUID
+	for _, pid := range r.PostForm["playlistID"] {
+		playlistID, err := uuid.Parse(pid)
+		if err != nil {
+			s.Log.Errorw("failed to parse playlist as UUID", "err", err.Error())
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		playlistIDs = append(playlistIDs, playlistID)
+	}
+
+	if len(playlistIDs) > 0 {
+		err := s.Store.SetPlaylistsPaused(r.Context(), *userID, playlistIDs, paused)
+		if err != nil {
+			s.Log.Errorw("failed to update paused playlists", "err", err.Error(), "paused", paused)
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+}
+
+// renderWebhooks fills in the user's webhooks and delivery log before templating '/webhooks'
+func (s *Server) renderWebhooks(w http.ResponseWriter, r *http.Request, userID uuid.UUID, tmplData tmpl.Webhooks) {
+	webhooks, err := s.Store.GetWebhooks(r.Context(), userID)
+	if err != nil {
+		s.Log.Errorw("failed to get webhooks from db", "err", err.Error())
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	deliveries, err := s.Store.GetWebhookDeliveries(r.Context(), userID, deliveryLogSize)
+	if err != nil {
+		s.Log.Errorw("failed to get webhook deliveries from db", "err", err.Error())
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	tmplData.Webhooks = webhooks
+	tmplData.Deliveries = deliveries
+
+	s.Tmpl.TmplWebhooks(w, tmplData)
+}
+
 func (s *Server) mobilePage(w http.ResponseWriter, r *http.Request) {
 	s.Tmpl.TmplMobile(w)
 }
@@ -1,12 +1,15 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 
 	"github.com/calebschoepp/playlist-rotator/pkg/build"
 	"github.com/calebschoepp/playlist-rotator/pkg/config"
+	"github.com/calebschoepp/playlist-rotator/pkg/events"
 	"github.com/calebschoepp/playlist-rotator/pkg/motify"
+	"github.com/calebschoepp/playlist-rotator/pkg/notify"
 	"github.com/calebschoepp/playlist-rotator/pkg/store"
 	"github.com/calebschoepp/playlist-rotator/pkg/tmpl"
 	"github.com/gorilla/mux"
@@ -23,6 +26,9 @@ type Server struct {
 	Store   store.Store
 	Tmpl    tmpl.Templater
 	Builder build.Builder
+	Events  *events.Broker
+
+	done chan struct{}
 }
 
 // New builds a new Server struct
@@ -39,8 +45,14 @@ func New(log *zap.SugaredLogger, config *config.Config, db *sqlx.DB, router *mux
 		return nil, err
 	}
 
+	// Build event broker
+	broker := events.New(db, log)
+
+	// Build failure notifier
+	notifier := notify.New(store, notify.NewMailer(config), log)
+
 	// Build builder
-	builder := build.New(store, spotify, log)
+	builder := build.New(store, spotify, broker, notifier, log, config)
 
 	return &Server{
 		Log:     log,
@@ -50,6 +62,8 @@ func New(log *zap.SugaredLogger, config *config.Config, db *sqlx.DB, router *mux
 		Store:   store,
 		Tmpl:    tmpl,
 		Builder: builder,
+		Events:  broker,
+		done:    make(chan struct{}),
 	}, nil
 }
 
@@ -74,13 +88,49 @@ func (s *Server) SetupRoutes() {
 	s.Router.Path("/playlist/{playlistID}").Methods("GET").HandlerFunc(s.playlistPage)
 	s.Router.Path("/playlist/{playlistID}").Methods("POST").HandlerFunc(s.playlistForm)
 	s.Router.Path("/playlist/{playlistID}/source/type/{type}/name/{name}/id/{id}").Methods("GET").HandlerFunc(s.playlistTrackSourceAPI)
+	s.Router.Path("/playlist/{playlistID}/pin/search").Methods("GET").HandlerFunc(s.playlistTrackSearch)
+	s.Router.Path("/playlist/{playlistID}/pin/id/{id}").Methods("GET").HandlerFunc(s.playlistPinnedTrack)
 	s.Router.Path("/playlist/{playlistID}/build").Methods("POST").HandlerFunc(s.playlistBuild)
+	s.Router.Path("/playlist/{playlistID}/cancel").Methods("POST").HandlerFunc(s.playlistCancel)
+	s.Router.Path("/playlists/pause").Methods("POST").HandlerFunc(s.playlistsPause)
+	s.Router.Path("/playlists/resume").Methods("POST").HandlerFunc(s.playlistsResume)
 	s.Router.Path("/playlist/{playlistID}/delete").Methods("DELETE").HandlerFunc(s.playlistDelete)
+	s.Router.Path("/events").Methods("GET").HandlerFunc(s.buildEvents)
+	s.Router.Path("/settings").Methods("GET").HandlerFunc(s.settingsPage)
+	s.Router.Path("/settings").Methods("POST").HandlerFunc(s.settingsForm)
+	s.Router.Path("/webhooks").Methods("GET").HandlerFunc(s.webhooksPage)
+	s.Router.Path("/webhooks").Methods("POST").HandlerFunc(s.webhookForm)
+	s.Router.Path("/webhooks/{webhookID}/delete").Methods("POST").HandlerFunc(s.webhookDelete)
 	s.Router.Path("/mobile").Methods("GET").HandlerFunc(s.mobilePage)
 }
 
-// Run makes the Server start listening and serving on the configured addr
-func (s *Server) Run() {
+// Run makes the Server start listening and serving on the configured addr until ctx is done
+func (s *Server) Run(ctx context.Context) {
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", s.Config.Port),
+		Handler: s.Router,
+	}
+
+	// Relay build events from worker processes
+	go s.Events.Listen(ctx, s.Config.DatabaseURL)
+
+	go func() {
+		<-ctx.Done()
+		s.Log.Info("shutting down server")
+
+		// Event streams never finish on their own so end them before waiting on requests
+		close(s.done)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.Config.ShutdownGrace)
+		defer cancel()
+		err := srv.Shutdown(shutdownCtx)
+		if err != nil {
+			s.Log.Errorw("failed to gracefully shut down server", "err", err.Error())
+		}
+	}()
+
 	s.Log.Infof("listening on port %d", s.Config.Port)
-	s.Log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", s.Config.Port), s.Router))
+	err := srv.ListenAndServe()
+	if err != http.ErrServerClosed {
+		s.Log.Fatal(err)
+	}
 }
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ArchivedPlaylist is a spotify playlist built for a playlist that hasn't been unfollowed yet
+type ArchivedPlaylist struct {
+	ID         uuid.UUID `db:"id"`
+	PlaylistID uuid.UUID `db:"playlist_id"`
+	SpotifyID  string    `db:"spotify_id"`
+
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// GetArchivedPlaylists returns every spotify playlist still kept for a playlist, newest first
+func (p *Postgres) GetArchivedPlaylists(ctx context.Context, playlistID uuid.UUID) ([]ArchivedPlaylist, error) {
+	var archived []ArchivedPlaylist
+	query := `
+SELECT *
+FROM archived_playlists
+WHERE playlist_id=$1
+ORDER BY created_at DESC;
+`
+	err := p.db.SelectContext(ctx, &archived, query, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	return archived, nil
+}
+
+// DeleteArchivedPlaylist stops tracking a spotify playlist once it has been unfollowed
+func (p *Postgres) DeleteArchivedPlaylist(ctx context.Context, id uuid.UUID) error {
+	query := `
+DELETE FROM archived_playlists
+WHERE id=$1;
+`
+	_, err := p.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -2,14 +2,27 @@ package store
 
 // Output configures the user facing result of a newly built Spotify playlist
 type Output struct {
-	Name        string
-	Description string
-	Public      bool
+	Name          string
+	Description   string
+	Public        bool
+	Collaborative bool
+
+	// Split divides the tracks between several spotify playlists, each of them a target
+	Split     SplitMode
+	SplitSize int // Most tracks in each target when splitting by size
 }
 
 // Input configures the sources used to generate a new Spotify playlist
 type Input struct {
-	TrackSources []TrackSource `json:"trackSources"`
+	TrackSources []TrackSource `json:"-"` // Stored in the track_sources table
+	Pinned       []PinnedTrack `json:"pinned,omitempty"`
+}
+
+// PinnedTrack is a track included in every build of a playlist, whatever its sources pick
+type PinnedTrack struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Position int    `json:"position,omitempty"` // Counts from 1 at the start or -1 at the end, 0 leaves it unfixed
 }
 
 // TrackSource represents a single source of tracks for a generated Spotify playlist
@@ -20,6 +33,26 @@ type TrackSource struct {
 	Count    int             `json:"count"`
 	Method   ExtractMethod   `json:"method"`
 	ImageURL string          // Not serialized and stored in DB, only used to display in UI
+
+	// Filters narrow down the source's tracks before Method picks Count of them. A track is
+	// kept only if it matches every filter, as if they were the children of an All group.
+	Filters []SourceFilter `json:"filters,omitempty"`
+}
+
+// SourceFilter is an expression that decides whether a source keeps a track. Intersect and
+// Subtract compare the track with the tracks of another source, named by Name, ID and Type.
+// All and Any combine their Children instead and nest as deep as needed.
+type SourceFilter struct {
+	Op       SetOp           `json:"op"`
+	Name     string          `json:"name,omitempty"`
+	ID       string          `json:"id,omitempty"`
+	Type     TrackSourceType `json:"type,omitempty"`
+	Children []SourceFilter  `json:"children,omitempty"`
+}
+
+// IsGroup returns whether the filter combines other filters rather than comparing with a source
+func (f SourceFilter) IsGroup() bool {
+	return f.Op == All || f.Op == Any
 }
 
 // StringifyMethod returns a string version of an extraction method
@@ -57,6 +90,74 @@ const (
 	BiWeekly = "Bi-Weekly"
 	// Monthly build the playlist
 	Monthly = "Monthly"
+	// Custom builds the playlist on the playlist's cron expression
+	Custom = "Custom"
+)
+
+// OutputMode is what happens to the previously built spotify playlist when a playlist is built again
+type OutputMode string
+
+const (
+	// Replace unfollows the previously built playlist
+	Replace OutputMode = "Replace"
+	// Archive keeps the most recent builds as separate dated playlists
+	Archive = "Archive"
+	// Append adds each build's tracks to the previous build, trimming the oldest tracks
+	Append = "Append"
+)
+
+// CollaboratorPolicy is what happens to tracks collaborators add to a built playlist before it is built again
+type CollaboratorPolicy string
+
+const (
+	// DropAdded leaves collaborators' tracks out of the next build
+	DropAdded CollaboratorPolicy = "Drop"
+	// KeepAdded carries collaborators' tracks over into the next build
+	KeepAdded = "Keep"
+	// PromoteAdded saves collaborators' tracks to a list that is included in every build
+	PromoteAdded = "Promote"
+)
+
+// SplitMode is how a build divides its tracks between several spotify playlists
+type SplitMode string
+
+const (
+	// NoSplit puts every track in one spotify playlist
+	NoSplit SplitMode = "None"
+	// SplitBySize fills numbered parts of a fixed size
+	SplitBySize = "Size"
+	// SplitBySource gives each source its own spotify playlist
+	SplitBySource = "Source"
+	// SplitByDecade groups tracks by the decade their album was released in
+	SplitByDecade = "Decade"
+	// SplitByGenre groups tracks by the main genre of their first artist
+	SplitByGenre = "Genre"
+)
+
+// SetOp is how a source filter decides whether a track is kept
+type SetOp string
+
+const (
+	// Intersect keeps only the tracks that are also in the other source
+	Intersect SetOp = "Intersect"
+	// Subtract drops the tracks that are in the other source
+	Subtract = "Subtract"
+	// All keeps the tracks that every child filter keeps
+	All = "All"
+	// Any keeps the tracks that at least one child filter keeps
+	Any = "Any"
+)
+
+// EditPolicy is what happens to tracks a user adds by hand to a built playlist before it is built again
+type EditPolicy string
+
+const (
+	// IgnoreEdits replaces the built playlist without looking at what was changed by hand
+	IgnoreEdits EditPolicy = "Ignore"
+	// CarryEdits carries tracks added by hand over into the next build
+	CarryEdits = "Carry"
+	// PinEdits pins tracks added by hand so they are included in every build
+	PinEdits = "Pin"
 )
 
 // TrackSourceType is an enumeration of the possible track sources for a playlist
@@ -70,3 +171,67 @@ const (
 	// PlaylistSrc pulls tracks from a playlist
 	PlaylistSrc = "Playlist"
 )
+
+// JobKind is the type of work a queued job performs
+type JobKind string
+
+const (
+	// BuildJob builds a playlist
+	BuildJob JobKind = "Build"
+	// DeleteJob deletes a playlist
+	DeleteJob = "Delete"
+	// WebhookJob delivers a webhook payload
+	WebhookJob = "Webhook"
+)
+
+// JobStatus is where a job is in its lifecycle
+type JobStatus string
+
+const (
+	// Queued jobs are waiting for a worker
+	Queued JobStatus = "Queued"
+	// Running jobs have been claimed by a worker
+	Running = "Running"
+	// Done jobs finished successfully
+	Done = "Done"
+	// Failed jobs ran out of attempts
+	Failed = "Failed"
+	// Cancelled jobs were called off by the user
+	Cancelled = "Cancelled"
+)
+
+// DeliveryStatus is where a webhook delivery is in its lifecycle
+type DeliveryStatus string
+
+const (
+	// Pending deliveries haven't been attempted yet
+	Pending DeliveryStatus = "Pending"
+	// Delivered deliveries were accepted by the endpoint
+	Delivered = "Delivered"
+	// Retrying deliveries failed at least once and will be tried again
+	Retrying = "Retrying"
+	// Undeliverable deliveries ran out of attempts
+	Undeliverable = "Undeliverable"
+)
+
+// NotifyOn is which failed scheduled builds a user wants to be emailed about
+type NotifyOn string
+
+const (
+	// NotifyNever sends no emails
+	NotifyNever NotifyOn = "Never"
+	// NotifyEvery failed scheduled build is emailed
+	NotifyEvery = "Every"
+	// NotifyRepeated only emails once a playlist has failed several scheduled builds in a row
+	NotifyRepeated = "Repeated"
+)
+
+// NotifyDelivery is when failure emails are sent
+type NotifyDelivery string
+
+const (
+	// Immediate emails are sent as soon as a build fails
+	Immediate NotifyDelivery = "Immediate"
+	// Digest emails collect a day's failures into one message
+	Digest = "Digest"
+)
@@ -0,0 +1,242 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ManualEdits are the changes a build found were made by hand to the playlist it replaced.
+// They are only saved along with the build so a build that doesn't finish changes nothing.
+type ManualEdits struct {
+	Added   int
+	Removed int
+
+	Exclude   []string      // Tracks removed by hand, left out of later builds
+	Unexclude []string      // Excluded tracks added back by hand
+	Unpin     []string      // Pinned tracks removed by hand
+	Pin       []PinnedTrack // Tracks added by hand that the playlist pins
+}
+
+// Pins returns pinned with the edits' pins applied
+func (e ManualEdits) Pins(pinned []PinnedTrack) []PinnedTrack {
+	if len(e.Unpin) == 0 && len(e.Pin) == 0 {
+		return pinned
+	}
+	unpin := make(map[string]bool, len(e.Unpin))
+	for _, id := range e.Unpin {
+		unpin[id] = true
+	}
+	var pins []PinnedTrack
+	isPinned := make(map[string]bool, len(pinned))
+	for _, pin := range pinned {
+		if !unpin[pin.ID] {
+			pins = append(pins, pin)
+			isPinned[pin.ID] = true
+		}
+	}
+	for _, pin := range e.Pin {
+		if !isPinned[pin.ID] {
+			pins = append(pins, pin)
+			isPinned[pin.ID] = true
+		}
+	}
+	return pins
+}
+
+// Excluded returns excluded with the edits' exclusions applied
+func (e ManualEdits) Excluded(excluded []string) []string {
+	unexclude := make(map[string]bool, len(e.Unexclude))
+	for _, id := range e.Unexclude {
+		unexclude[id] = true
+	}
+	var ids []string
+	for _, id := range append(excluded, e.Exclude...) {
+		if !unexclude[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// BuiltTracks is every track the last good build of a playlist left in its Spotify playlist
+type BuiltTracks struct {
+	PlaylistID   uuid.UUID `db:"playlist_id"`
+	SpotifyID    string    `db:"spotify_id"`
+	Tracks       []string
+	TracksString string `db:"tracks"`
+
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// UnmarshalTracks unpacks a JSON string into the tracks slice
+func (b *BuiltTracks) UnmarshalTracks() error {
+	var tracks []string
+	err := json.Unmarshal([]byte(b.TracksString), &tracks)
+	if err != nil {
+		return err
+	}
+	b.Tracks = tracks
+	return nil
+}
+
+// GetBuiltTracks returns what the last good build of a playlist built or nil if none was recorded
+func (p *Postgres) GetBuiltTracks(ctx context.Context, playlistID uuid.UUID) (*BuiltTracks, error) {
+	var builtTracks BuiltTracks
+	query := `
+SELECT *
+FROM built_tracks
+WHERE playlist_id=$1;
+`
+	err := p.db.GetContext(ctx, &builtTracks, query, playlistID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = builtTracks.UnmarshalTracks()
+	if err != nil {
+		return nil, err
+	}
+	return &builtTracks, nil
+}
+
+// AddExcludedTracks saves tracks removed by hand so they are left out of every build of a playlist
+func (p *Postgres) AddExcludedTracks(ctx context.Context, playlistID uuid.UUID, trackIDs []string) error {
+	query := `
+INSERT INTO excluded_tracks (
+	playlist_id,
+	track_id
+)
+SELECT $1, unnest($2::TEXT[])
+ON CONFLICT DO NOTHING;
+`
+	_, err := p.db.ExecContext(ctx, query, playlistID, pq.Array(trackIDs))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RemoveExcludedTracks lets previously excluded tracks back into builds of a playlist
+func (p *Postgres) RemoveExcludedTracks(ctx context.Context, playlistID uuid.UUID, trackIDs []string) error {
+	query := `
+DELETE FROM excluded_tracks
+WHERE playlist_id=$1 AND track_id=ANY($2);
+`
+	_, err := p.db.ExecContext(ctx, query, playlistID, pq.Array(trackIDs))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ClearExcludedTracks lets every excluded track back into builds of a playlist
+func (p *Postgres) ClearExcludedTracks(ctx context.Context, playlistID uuid.UUID) error {
+	query := `
+DELETE FROM excluded_tracks
+WHERE playlist_id=$1;
+`
+	_, err := p.db.ExecContext(ctx, query, playlistID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetExcludedTracks returns the tracks excluded from a playlist, oldest first
+func (p *Postgres) GetExcludedTracks(ctx context.Context, playlistID uuid.UUID) ([]string, error) {
+	var trackIDs []string
+	query := `
+SELECT track_id
+FROM excluded_tracks
+WHERE playlist_id=$1
+ORDER BY created_at, track_id;
+`
+	err := p.db.SelectContext(ctx, &trackIDs, query, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	return trackIDs, nil
+}
+
+// saveManualEdits saves the exclusions and pins of edits as part of tx. Pins are applied to
+// the input as it is now rather than as the build read it, so only they change and any
+// edit the user saved while the build ran is kept. Like writeTrackSources it is shared by
+// every backend so its queries are rebound to the placeholders of tx's driver.
+func saveManualEdits(ctx context.Context, tx *sqlx.Tx, playlistID uuid.UUID, edits ManualEdits) error {
+	query := `
+INSERT INTO excluded_tracks (
+	playlist_id,
+	track_id
+)
+VALUES (
+	?,
+	?
+)
+ON CONFLICT DO NOTHING;
+`
+	for _, trackID := range edits.Exclude {
+		_, err := tx.ExecContext(ctx, tx.Rebind(query), playlistID, trackID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(edits.Unexclude) > 0 {
+		query, args, err := sqlx.In(`
+DELETE FROM excluded_tracks
+WHERE playlist_id=? AND track_id IN (?);
+`, playlistID, edits.Unexclude)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, tx.Rebind(query), args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(edits.Unpin) == 0 && len(edits.Pin) == 0 {
+		return nil
+	}
+	query = `
+SELECT input
+FROM playlists
+WHERE id=?
+`
+	if tx.DriverName() == PostgresDriver {
+		// SQLite transactions already hold the write lock from the start
+		query += "FOR UPDATE"
+	}
+	var playlist Playlist
+	err := tx.GetContext(ctx, &playlist.InputString, tx.Rebind(query), playlistID)
+	if err != nil {
+		return err
+	}
+	err = playlist.UnmarshalInput()
+	if err != nil {
+		return err
+	}
+	playlist.Input.Pinned = edits.Pins(playlist.Input.Pinned)
+	err = playlist.MarshalInput()
+	if err != nil {
+		return err
+	}
+	query = `
+UPDATE playlists SET
+	input=?
+WHERE id=?;
+`
+	_, err = tx.ExecContext(ctx, tx.Rebind(query), playlist.InputString, playlistID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
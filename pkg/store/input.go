@@ -0,0 +1,211 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// trackSourceRow is a track source as it is stored, one row per source in the order of the playlist's input
+type trackSourceRow struct {
+	PlaylistID uuid.UUID       `db:"playlist_id"`
+	Ordinal    int             `db:"ordinal"`
+	Type       TrackSourceType `db:"source_type"`
+	ID         string          `db:"source_id"`
+	Name       string          `db:"name"`
+	Count      int             `db:"count"`
+	Method     ExtractMethod   `db:"method"`
+
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// sourceFilterRow is a source filter as it is stored, one row per filter numbered parents first.
+// Groups leave the type, ID and name empty.
+type sourceFilterRow struct {
+	PlaylistID    uuid.UUID       `db:"playlist_id"`
+	SourceOrdinal int             `db:"source_ordinal"`
+	Ordinal       int             `db:"ordinal"`
+	ParentOrdinal sql.NullInt64   `db:"parent_ordinal"` // NULL for the filters a source starts with
+	Op            SetOp           `db:"op"`
+	Type          TrackSourceType `db:"source_type"`
+	ID            string          `db:"source_id"`
+	Name          string          `db:"name"`
+
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// writeTrackSources replaces every source of a playlist as part of tx. Like readTrackSources it
+// is shared by every backend so its queries are rebound to the placeholders of tx's driver.
+func writeTrackSources(ctx context.Context, tx *sqlx.Tx, playlistID uuid.UUID, sources []TrackSource) error {
+	// Filters go with their sources
+	query := `
+DELETE FROM track_sources
+WHERE playlist_id=?;
+`
+	_, err := tx.ExecContext(ctx, tx.Rebind(query), playlistID)
+	if err != nil {
+		return err
+	}
+
+	sourceQuery := `
+INSERT INTO track_sources (
+	playlist_id,
+	ordinal,
+	source_type,
+	source_id,
+	name,
+	count,
+	method
+)
+VALUES (
+	?,
+	?,
+	?,
+	?,
+	?,
+	?,
+	?
+);
+`
+	for i, source := range sources {
+		_, err = tx.ExecContext(ctx, tx.Rebind(sourceQuery), playlistID, i, source.Type, source.ID, source.Name, source.Count, source.Method)
+		if err != nil {
+			return err
+		}
+		next := 0
+		err = writeSourceFilters(ctx, tx, playlistID, i, source.Filters, sql.NullInt64{}, &next)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSourceFilters writes filters and everything nested in them under parent, numbering
+// them from next so that every parent is written before its children
+func writeSourceFilters(ctx context.Context, tx *sqlx.Tx, playlistID uuid.UUID, sourceOrdinal int, filters []SourceFilter, parent sql.NullInt64, next *int) error {
+	query := `
+INSERT INTO source_filters (
+	playlist_id,
+	source_ordinal,
+	ordinal,
+	parent_ordinal,
+	op,
+	source_type,
+	source_id,
+	name
+)
+VALUES (
+	?,
+	?,
+	?,
+	?,
+	?,
+	?,
+	?,
+	?
+);
+`
+	for _, filter := range filters {
+		ordinal := *next
+		*next++
+		_, err := tx.ExecContext(ctx, tx.Rebind(query), playlistID, sourceOrdinal, ordinal, parent, filter.Op, filter.Type, filter.ID, filter.Name)
+		if err != nil {
+			return err
+		}
+		err = writeSourceFilters(ctx, tx, playlistID, sourceOrdinal, filter.Children, sql.NullInt64{Int64: int64(ordinal), Valid: true}, next)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTrackSources fills in the sources of each playlist's input
+func readTrackSources(ctx context.Context, tx *sqlx.Tx, playlists []Playlist) error {
+	if len(playlists) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(playlists))
+	for i := range playlists {
+		ids[i] = playlists[i].ID
+	}
+
+	var sourceRows []trackSourceRow
+	query, args, err := sqlx.In(`
+SELECT *
+FROM track_sources
+WHERE playlist_id IN (?)
+ORDER BY playlist_id, ordinal;
+`, ids)
+	if err != nil {
+		return err
+	}
+	err = tx.SelectContext(ctx, &sourceRows, tx.Rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	var filterRows []sourceFilterRow
+	query, args, err = sqlx.In(`
+SELECT *
+FROM source_filters
+WHERE playlist_id IN (?)
+ORDER BY playlist_id, source_ordinal, ordinal;
+`, ids)
+	if err != nil {
+		return err
+	}
+	err = tx.SelectContext(ctx, &filterRows, tx.Rebind(query), args...)
+	if err != nil {
+		return err
+	}
+
+	// Group the filters by the source and filter they are nested in, -1 standing in for none
+	type parentKey struct {
+		playlistID    uuid.UUID
+		sourceOrdinal int
+		ordinal       int
+	}
+	children := make(map[parentKey][]sourceFilterRow)
+	for _, row := range filterRows {
+		key := parentKey{row.PlaylistID, row.SourceOrdinal, -1}
+		if row.ParentOrdinal.Valid {
+			key.ordinal = int(row.ParentOrdinal.Int64)
+		}
+		children[key] = append(children[key], row)
+	}
+	var filtersUnder func(key parentKey) []SourceFilter
+	filtersUnder = func(key parentKey) []SourceFilter {
+		var filters []SourceFilter
+		for _, row := range children[key] {
+			filters = append(filters, SourceFilter{
+				Op:       row.Op,
+				Name:     row.Name,
+				ID:       row.ID,
+				Type:     row.Type,
+				Children: filtersUnder(parentKey{row.PlaylistID, row.SourceOrdinal, row.Ordinal}),
+			})
+		}
+		return filters
+	}
+
+	sources := make(map[uuid.UUID][]TrackSource, len(playlists))
+	for _, row := range sourceRows {
+		sources[row.PlaylistID] = append(sources[row.PlaylistID], TrackSource{
+			Name:    row.Name,
+			ID:      row.ID,
+			Type:    row.Type,
+			Count:   row.Count,
+			Method:  row.Method,
+			Filters: filtersUnder(parentKey{row.PlaylistID, row.Ordinal, -1}),
+		})
+	}
+	for i := range playlists {
+		playlists[i].Input.TrackSources = sources[playlists[i].ID]
+	}
+	return nil
+}
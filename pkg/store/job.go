@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Job is a unit of background work in the durable job queue
+type Job struct {
+	ID         uuid.UUID  `db:"id"`
+	Kind       JobKind    `db:"kind"`
+	UserID     uuid.UUID  `db:"user_id"`
+	PlaylistID uuid.UUID  `db:"playlist_id"`
+	DeliveryID *uuid.UUID `db:"delivery_id"` // Only set for webhook jobs
+
+	Status      JobStatus  `db:"status"`
+	Attempts    int        `db:"attempts"`
+	MaxAttempts int        `db:"max_attempts"`
+	LastError   *string    `db:"last_error"`
+	RunAt       time.Time  `db:"run_at"`
+	LockedAt    *time.Time `db:"locked_at"`
+
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// EnqueueJob adds a job to the queue to be run as soon as a worker is free
+func (p *Postgres) EnqueueJob(ctx context.Context, kind JobKind, userID, playlistID uuid.UUID) error {
+	query := `
+INSERT INTO jobs (
+	kind,
+	user_id,
+	playlist_id
+)
+VALUES (
+	$1,
+	$2,
+	$3
+);
+`
+	_, err := p.db.ExecContext(ctx, query, kind, userID, playlistID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ClaimJob locks the next runnable job for the caller and returns nil if there is none.
+// Jobs left running for longer than staleAfter are assumed to belong to a dead worker and are claimed again.
+func (p *Postgres) ClaimJob(ctx context.Context, staleAfter time.Duration) (*Job, error) {
+	var job Job
+	query := `
+UPDATE jobs SET
+	status='Running',
+	attempts=attempts+1,
+	locked_at=NOW()
+WHERE id = (
+	SELECT id
+	FROM jobs
+	WHERE (status='Queued' AND run_at<=NOW())
+		OR (status='Running' AND locked_at<$1)
+	ORDER BY run_at
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+`
+	err := p.db.GetContext(ctx, &job, query, time.Now().Add(-staleAfter))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// HeartbeatJob refreshes the lock on a running job so it isn't mistaken for one whose worker died
+func (p *Postgres) HeartbeatJob(ctx context.Context, id uuid.UUID) error {
+	query := `
+UPDATE jobs SET
+	locked_at=NOW()
+WHERE id=$1 AND status='Running';
+`
+	_, err := p.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CompleteJob marks a claimed job as successfully finished
+func (p *Postgres) CompleteJob(ctx context.Context, id uuid.UUID) error {
+	query := `
+UPDATE jobs SET
+	status='Done',
+	last_error=NULL,
+	locked_at=NULL
+WHERE id=$1;
+`
+	_, err := p.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RetryJob puts a failed job back in the queue to be run again at runAt
+func (p *Postgres) RetryJob(ctx context.Context, id uuid.UUID, lastError string, runAt time.Time) error {
+	query := `
+UPDATE jobs SET
+	status='Queued',
+	last_error=$1,
+	run_at=$2,
+	locked_at=NULL
+WHERE id=$3;
+`
+	_, err := p.db.ExecContext(ctx, query, lastError, runAt, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CancelQueuedJobs cancels any jobs of the given kind for one of a user's playlists that haven't been claimed yet
+func (p *Postgres) CancelQueuedJobs(ctx context.Context, kind JobKind, userID, playlistID uuid.UUID) error {
+	query := `
+UPDATE jobs SET
+	status='Cancelled'
+WHERE kind=$1 AND user_id=$2 AND playlist_id=$3 AND status='Queued';
+`
+	_, err := p.db.ExecContext(ctx, query, kind, userID, playlistID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FailJob marks a job as permanently failed once it has run out of attempts
+func (p *Postgres) FailJob(ctx context.Context, id uuid.UUID, lastError string) error {
+	query := `
+UPDATE jobs SET
+	status='Failed',
+	last_error=$1,
+	locked_at=NULL
+WHERE id=$2;
+`
+	_, err := p.db.ExecContext(ctx, query, lastError, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
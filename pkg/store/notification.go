@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Notification is a failed scheduled build waiting to be sent in a user's digest email
+type Notification struct {
+	ID                  uuid.UUID  `db:"id"`
+	UserID              uuid.UUID  `db:"user_id"`
+	PlaylistID          uuid.UUID  `db:"playlist_id"`
+	PlaylistName        string     `db:"playlist_name"`
+	FailureMsg          string     `db:"failure_msg"`
+	ConsecutiveFailures int        `db:"consecutive_failures"`
+	SentAt              *time.Time `db:"sent_at"`
+
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// CreateNotification holds a failed build for a user's next digest email
+func (p *Postgres) CreateNotification(ctx context.Context, userID, playlistID uuid.UUID, playlistName, failureMsg string, consecutiveFailures int) error {
+	query := `
+INSERT INTO notifications (
+	user_id,
+	playlist_id,
+	playlist_name,
+	failure_msg,
+	consecutive_failures
+)
+VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5
+);
+`
+	_, err := p.db.ExecContext(ctx, query, userID, playlistID, playlistName, failureMsg, consecutiveFailures)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetDigestUsers returns the users with unsent notifications who haven't had a digest within interval
+func (p *Postgres) GetDigestUsers(ctx context.Context, interval time.Duration) ([]User, error) {
+	var users []User
+	query := `
+SELECT *
+FROM users u
+WHERE u.notify_delivery='Digest'
+	AND (u.last_digest_at IS NULL OR u.last_digest_at<=$1)
+	AND EXISTS (
+		SELECT 1
+		FROM notifications n
+		WHERE n.user_id=u.id AND n.sent_at IS NULL
+	);
+`
+	err := p.db.SelectContext(ctx, &users, query, time.Now().Add(-interval))
+	if err != nil {
+		return nil, err
+	}
+	for i := range users {
+		users[i].UnmarshalToken()
+	}
+	return users, nil
+}
+
+// GetPendingNotifications returns a user's unsent notifications, oldest first
+func (p *Postgres) GetPendingNotifications(ctx context.Context, userID uuid.UUID) ([]Notification, error) {
+	var notifications []Notification
+	query := `
+SELECT *
+FROM notifications
+WHERE user_id=$1 AND sent_at IS NULL
+ORDER BY created_at;
+`
+	err := p.db.SelectContext(ctx, &notifications, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// MarkDigestSent marks a user's notifications created up to upTo as sent and records when the digest went out
+func (p *Postgres) MarkDigestSent(ctx context.Context, userID uuid.UUID, upTo time.Time) error {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+UPDATE notifications SET
+	sent_at=NOW()
+WHERE user_id=$1 AND sent_at IS NULL AND created_at<=$2;
+`
+	_, err = tx.ExecContext(ctx, query, userID, upTo)
+	if err != nil {
+		return err
+	}
+
+	query = `
+UPDATE users SET
+	last_digest_at=NOW()
+WHERE id=$1;
+`
+	_, err = tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
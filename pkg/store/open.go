@@ -0,0 +1,69 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"           // Postgres driver
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+// The database/sql drivers a store can be backed by
+const (
+	PostgresDriver = "postgres"
+	SQLiteDriver   = "sqlite3"
+)
+
+// sqliteParams are added to every SQLite DSN. SQLite leaves foreign keys off unless asked,
+// WAL lets readers carry on while another connection writes and taking the write lock as
+// soon as a transaction begins stops two transactions deadlocking when both try to write.
+const sqliteParams = "_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+
+// Driver returns the driver for a database URL, picked by its scheme: postgres:// or
+// postgresql:// for Postgres and sqlite:// for a SQLite file, like sqlite://dev.db or
+// sqlite:///var/lib/playlist-rotator.db. URLs without a scheme are Postgres connection strings.
+func Driver(databaseURL string) (string, error) {
+	i := strings.Index(databaseURL, "://")
+	if i < 0 {
+		return PostgresDriver, nil
+	}
+	switch scheme := databaseURL[:i]; scheme {
+	case "postgres", "postgresql":
+		return PostgresDriver, nil
+	case "sqlite", "sqlite3":
+		return SQLiteDriver, nil
+	default:
+		return "", fmt.Errorf("unsupported database URL scheme: %s", scheme)
+	}
+}
+
+// Open connects to the database at databaseURL using the driver its scheme picks
+func Open(databaseURL string) (*sqlx.DB, error) {
+	driver, err := Driver(databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if driver == PostgresDriver {
+		return sqlx.Open(driver, databaseURL)
+	}
+
+	dsn := databaseURL[strings.Index(databaseURL, "://")+3:]
+	if dsn == "" {
+		return nil, fmt.Errorf("SQLite database URL needs a file path: %s", databaseURL)
+	}
+	if strings.Contains(dsn, "?") {
+		dsn += "&" + sqliteParams
+	} else {
+		dsn += "?" + sqliteParams
+	}
+	return sqlx.Open(driver, dsn)
+}
+
+// New returns the Store backed by db, which must have been opened with one of the supported drivers
+func New(db *sqlx.DB) Store {
+	if db.DriverName() == SQLiteDriver {
+		return NewSQLite(db)
+	}
+	return NewPostgres(db)
+}
@@ -0,0 +1,35 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutputTarget is one of the spotify playlists the last good build of a playlist put its tracks in
+type OutputTarget struct {
+	PlaylistID uuid.UUID `db:"playlist_id"`
+	Position   int       `db:"position"`
+	Name       string    `db:"name"`
+	SpotifyID  string    `db:"spotify_id"`
+
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// GetOutputTargets returns every spotify playlist the last good build of a playlist
+// put its tracks in, in order
+func (p *Postgres) GetOutputTargets(ctx context.Context, playlistID uuid.UUID) ([]OutputTarget, error) {
+	var targets []OutputTarget
+	query := `
+SELECT *
+FROM output_targets
+WHERE playlist_id=$1
+ORDER BY position;
+`
+	err := p.db.SelectContext(ctx, &targets, query, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
@@ -1,10 +1,14 @@
 package store
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // TODO split into two embedded interfaces and generally improve this type
@@ -22,17 +26,45 @@ type Playlist struct {
 	Description string   `db:"description"`
 	Public      bool     `db:"public"`
 	Schedule    Schedule `db:"schedule"`
+	Cron        *string  `db:"cron"`       // Only set for custom schedules
+	BuildTime   string   `db:"build_time"` // Local time of day scheduled builds happen, as 15:04
 	SpotifyID   *string  `db:"spotify_id"`
 	FailureMsg  *string  `db:"failure_msg"`
 	Building    bool     `db:"building"`
 	Current     bool     `db:"current"`
 
+	// Scheduled builds are skipped while paused and outside of the optional start and end dates
+	Paused   bool       `db:"paused"`
+	StartsOn *time.Time `db:"starts_on"`
+	EndsOn   *time.Time `db:"ends_on"`
+
+	OutputMode OutputMode `db:"output_mode"`
+	KeepBuilds int        `db:"keep_builds"` // How many builds archive mode keeps
+	MaxSize    int        `db:"max_size"`    // How many tracks append mode keeps
+
+	// Collaborative playlists are always private
+	Collaborative      bool               `db:"collaborative"`
+	CollaboratorPolicy CollaboratorPolicy `db:"collaborator_policy"`
+
+	// Tracks removed by hand are always excluded from later builds unless edits are ignored
+	EditPolicy   EditPolicy `db:"edit_policy"`
+	EditsAdded   int        `db:"edits_added"`   // Tracks the last build found added by hand
+	EditsRemoved int        `db:"edits_removed"` // Tracks the last build found removed by hand
+
+	// Split playlists are built into several spotify playlists, SpotifyID holding the first
+	SplitMode SplitMode `db:"split_mode"`
+	SplitSize int       `db:"split_size"` // Most tracks in each part when splitting by size
+
+	CancelRequested     bool `db:"cancel_requested"`
+	ConsecutiveFailures int  `db:"consecutive_failures"`
+
 	CreatedAt   time.Time  `db:"created_at"`
 	UpdatedAt   time.Time  `db:"updated_at"`
 	LastBuiltAt *time.Time `db:"last_built_at"`
 }
 
-// MarshalInput packs a input object into a JSON string
+// MarshalInput packs a input object into a JSON string, leaving out the track sources
+// which are stored in their own table
 func (p *Playlist) MarshalInput() error {
 	b, err := json.Marshal(&p.Input)
 	if err != nil {
@@ -53,13 +85,18 @@ func (p *Playlist) UnmarshalInput() error {
 	return nil
 }
 
-// CreatePlaylist inserts a new playlist into the DB
-func (p *Postgres) CreatePlaylist(userID uuid.UUID, input Input, name, description string, public bool, schedule Schedule) error {
-	b, err := json.Marshal(&input)
+// CreatePlaylist inserts a new playlist into the DB using the configuration fields of playlist
+func (p *Postgres) CreatePlaylist(ctx context.Context, userID uuid.UUID, playlist Playlist) error {
+	err := playlist.MarshalInput()
+	if err != nil {
+		return err
+	}
+
+	tx, err := p.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	inputJSON := string(b)
+	defer tx.Rollback()
 
 	query := `
 INSERT INTO playlists (
@@ -68,7 +105,19 @@ INSERT INTO playlists (
 	name,
 	description,
 	public,
-	schedule
+	schedule,
+	cron,
+	build_time,
+	starts_on,
+	ends_on,
+	output_mode,
+	keep_builds,
+	max_size,
+	collaborative,
+	collaborator_policy,
+	edit_policy,
+	split_mode,
+	split_size
 )
 VALUES (
 	$1,
@@ -76,18 +125,57 @@ VALUES (
 	$3,
 	$4,
 	$5,
-	$6
-);
+	$6,
+	$7,
+	$8,
+	$9,
+	$10,
+	$11,
+	$12,
+	$13,
+	$14,
+	$15,
+	$16,
+	$17,
+	$18
+)
+RETURNING id;
 `
-	_, err = p.db.Exec(query, userID, inputJSON, name, description, public, schedule)
+	var id uuid.UUID
+	err = tx.GetContext(ctx, &id,
+		query,
+		userID,
+		playlist.InputString,
+		playlist.Name,
+		playlist.Description,
+		playlist.Public,
+		playlist.Schedule,
+		playlist.Cron,
+		playlist.BuildTime,
+		playlist.StartsOn,
+		playlist.EndsOn,
+		playlist.OutputMode,
+		playlist.KeepBuilds,
+		playlist.MaxSize,
+		playlist.Collaborative,
+		playlist.CollaboratorPolicy,
+		playlist.EditPolicy,
+		playlist.SplitMode,
+		playlist.SplitSize,
+	)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	err = writeTrackSources(ctx, tx, id, playlist.Input.TrackSources)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // UpdatePlaylistConfig updates the part of a playlist row that configures how Spotify playlists are built
-func (p *Postgres) UpdatePlaylistConfig(id uuid.UUID, playlist Playlist) error {
+func (p *Postgres) UpdatePlaylistConfig(ctx context.Context, id uuid.UUID, playlist Playlist) error {
 	query := `
 UPDATE playlists SET
 	input=$1,
@@ -95,135 +183,326 @@ UPDATE playlists SET
 	description=$3,
 	public=$4,
 	schedule=$5,
+	cron=$6,
+	build_time=$7,
+	starts_on=$8,
+	ends_on=$9,
+	output_mode=$10,
+	keep_builds=$11,
+	max_size=$12,
+	collaborative=$13,
+	collaborator_policy=$14,
+	edit_policy=$15,
+	split_mode=$16,
+	split_size=$17,
 	current=FALSE
-WHERE id=$6;
+WHERE id=$18;
 `
 	err := playlist.MarshalInput()
 	if err != nil {
 		return err
 	}
 
-	_, err = p.db.Exec(
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
 		query,
 		playlist.InputString,
 		playlist.Name,
 		playlist.Description,
 		playlist.Public,
 		playlist.Schedule,
+		playlist.Cron,
+		playlist.BuildTime,
+		playlist.StartsOn,
+		playlist.EndsOn,
+		playlist.OutputMode,
+		playlist.KeepBuilds,
+		playlist.MaxSize,
+		playlist.Collaborative,
+		playlist.CollaboratorPolicy,
+		playlist.EditPolicy,
+		playlist.SplitMode,
+		playlist.SplitSize,
 		id,
 	)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	err = writeTrackSources(ctx, tx, id, playlist.Input.TrackSources)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // GetPlaylist returns the playlist with a given id
-func (p *Postgres) GetPlaylist(id uuid.UUID) (*Playlist, error) {
-	var playlist Playlist
+func (p *Postgres) GetPlaylist(ctx context.Context, id uuid.UUID) (*Playlist, error) {
 	query := `
 SELECT *
 FROM playlists
-WHERE id=$1;	
+WHERE id=$1;
 `
-	err := p.db.Get(&playlist, query, id)
+	playlists, err := p.selectPlaylists(ctx, query, id)
 	if err != nil {
 		return nil, err
 	}
-	err = playlist.UnmarshalInput()
-	if err != nil {
-		return nil, err
+	if len(playlists) == 0 {
+		return nil, sql.ErrNoRows
 	}
-	return &playlist, nil
+	return &playlists[0], nil
 }
 
 // GetPlaylists retrieves all the playlists associated with a given userID
-func (p *Postgres) GetPlaylists(userID uuid.UUID) ([]Playlist, error) {
-	playlists := []Playlist{}
+func (p *Postgres) GetPlaylists(ctx context.Context, userID uuid.UUID) ([]Playlist, error) {
 	query := `
 SELECT *
 FROM playlists
 WHERE user_id=$1;
 `
-	err := p.db.Select(&playlists, query, userID)
-	if err != nil {
-		return playlists, err
-	}
-
-	for i := range playlists {
-		err = playlists[i].UnmarshalInput()
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	return playlists, nil
+	return p.selectPlaylists(ctx, query, userID)
 }
 
 // GetAllPlaylists returns all stored playlists
-func (p *Postgres) GetAllPlaylists() ([]Playlist, error) {
-	playlists := []Playlist{}
+func (p *Postgres) GetAllPlaylists(ctx context.Context) ([]Playlist, error) {
 	query := `
 SELECT *
 FROM playlists;
 `
-	err := p.db.Select(&playlists, query)
+	return p.selectPlaylists(ctx, query)
+}
+
+// selectPlaylists runs a query for playlist rows and fills in their inputs, reading the
+// rows and their sources from the same snapshot
+func (p *Postgres) selectPlaylists(ctx context.Context, query string, args ...interface{}) ([]Playlist, error) {
+	tx, err := p.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
 	if err != nil {
-		return playlists, err
+		return nil, err
 	}
+	defer tx.Rollback()
 
+	playlists := []Playlist{}
+	err = tx.SelectContext(ctx, &playlists, query, args...)
+	if err != nil {
+		return nil, err
+	}
 	for i := range playlists {
 		err = playlists[i].UnmarshalInput()
 		if err != nil {
 			return nil, err
 		}
 	}
-
-	return playlists, nil
+	err = readTrackSources(ctx, tx, playlists)
+	if err != nil {
+		return nil, err
+	}
+	return playlists, tx.Commit()
 }
 
 // UpdatePlaylistStartBuild sets a playlists building boolean to true
-func (p *Postgres) UpdatePlaylistStartBuild(id uuid.UUID) error {
+func (p *Postgres) UpdatePlaylistStartBuild(ctx context.Context, id uuid.UUID) error {
 	query := `
 UPDATE playlists SET
-	building=TRUE
+	building=TRUE,
+	cancel_requested=FALSE
 WHERE id=$1;
 	`
-	_, err := p.db.Exec(query, id)
+	_, err := p.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// UpdatePlaylistGoodBuild updates a playlist entry after a successful build of the playlist
-func (p *Postgres) UpdatePlaylistGoodBuild(id uuid.UUID, spotifyID string) error {
+// UpdatePlaylistGoodBuild updates a playlist entry after a successful build of the playlist,
+// recording the spotify playlists it built, the tracks in the first of them and saving the
+// manual edits it found in the build it replaced
+func (p *Postgres) UpdatePlaylistGoodBuild(ctx context.Context, id uuid.UUID, targets []OutputTarget, tracks []string, edits ManualEdits) error {
+	if len(targets) == 0 {
+		return fmt.Errorf("no spotify playlists were built for playlist %s", id)
+	}
+	spotifyID := targets[0].SpotifyID
+	b, err := json.Marshal(&tracks)
+	if err != nil {
+		return err
+	}
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
 UPDATE playlists SET
 	spotify_id=$1,
 	last_built_at=$2,
 	failure_msg=NULL,
+	consecutive_failures=0,
 	building=FALSE,
-	current=TRUE
-WHERE id=$3;
+	cancel_requested=FALSE,
+	current=TRUE,
+	edits_added=$3,
+	edits_removed=$4
+WHERE id=$5;
 `
-	_, err := p.db.Exec(query, spotifyID, time.Now(), id)
+	_, err = tx.ExecContext(ctx, query, spotifyID, time.Now(), edits.Added, edits.Removed, id)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	query = `
+INSERT INTO archived_playlists (
+	playlist_id,
+	spotify_id
+)
+VALUES (
+	$1,
+	$2
+)
+ON CONFLICT (playlist_id, spotify_id) DO UPDATE SET
+	created_at=NOW();
+`
+	for _, target := range targets {
+		_, err = tx.ExecContext(ctx, query, id, target.SpotifyID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query = `
+DELETE FROM output_targets
+WHERE playlist_id=$1;
+`
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	query = `
+INSERT INTO output_targets (
+	playlist_id,
+	position,
+	name,
+	spotify_id
+)
+VALUES (
+	$1,
+	$2,
+	$3,
+	$4
+);
+`
+	for i, target := range targets {
+		_, err = tx.ExecContext(ctx, query, id, i, target.Name, target.SpotifyID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query = `
+INSERT INTO built_tracks (
+	playlist_id,
+	spotify_id,
+	tracks
+)
+VALUES (
+	$1,
+	$2,
+	$3
+)
+ON CONFLICT (playlist_id) DO UPDATE SET
+	spotify_id=EXCLUDED.spotify_id,
+	tracks=EXCLUDED.tracks;
+`
+	_, err = tx.ExecContext(ctx, query, id, spotifyID, string(b))
+	if err != nil {
+		return err
+	}
+
+	err = saveManualEdits(ctx, tx, id, edits)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // UpdatePlaylistBadBuild updates a playlist entry after a failed build of a playlist
-func (p *Postgres) UpdatePlaylistBadBuild(id uuid.UUID, failureMsg string) error {
+func (p *Postgres) UpdatePlaylistBadBuild(ctx context.Context, id uuid.UUID, failureMsg string) error {
 	query := `
 UPDATE playlists SET
 	last_built_at=$1,
 	failure_msg=$2,
-	building=FALSE
+	consecutive_failures=consecutive_failures+1,
+	building=FALSE,
+	cancel_requested=FALSE
 WHERE id=$3;
 `
-	_, err := p.db.Exec(query, time.Now(), failureMsg, id)
+	_, err := p.db.ExecContext(ctx, query, time.Now(), failureMsg, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RequestCancelBuild flags one of a user's building playlists so that whoever is building it stops
+func (p *Postgres) RequestCancelBuild(ctx context.Context, userID, id uuid.UUID) error {
+	query := `
+UPDATE playlists SET
+	cancel_requested=TRUE
+WHERE id=$1 AND user_id=$2 AND building=TRUE;
+`
+	_, err := p.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// IsCancelRequested reports whether a cancel has been requested for the playlist's current build
+func (p *Postgres) IsCancelRequested(ctx context.Context, id uuid.UUID) (bool, error) {
+	var cancelRequested bool
+	query := `
+SELECT cancel_requested
+FROM playlists
+WHERE id=$1;
+`
+	err := p.db.GetContext(ctx, &cancelRequested, query, id)
+	if err != nil {
+		return false, err
+	}
+	return cancelRequested, nil
+}
+
+// UpdatePlaylistRetryingBuild updates a playlist entry after a build attempt failed and
+// will be tried again, leaving the previous build in place without recording a failure
+func (p *Postgres) UpdatePlaylistRetryingBuild(ctx context.Context, id uuid.UUID) error {
+	query := `
+UPDATE playlists SET
+	building=FALSE,
+	cancel_requested=FALSE
+WHERE id=$1;
+`
+	_, err := p.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdatePlaylistCancelledBuild updates a playlist entry after its build was cancelled, leaving the previous build in place
+func (p *Postgres) UpdatePlaylistCancelledBuild(ctx context.Context, id uuid.UUID) error {
+	query := `
+UPDATE playlists SET
+	building=FALSE,
+	cancel_requested=FALSE
+WHERE id=$1;
+`
+	_, err := p.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -231,12 +510,12 @@ WHERE id=$3;
 }
 
 // DeletePlaylist deletes the playlist entry matching the given id
-func (p *Postgres) DeletePlaylist(id uuid.UUID) error {
+func (p *Postgres) DeletePlaylist(ctx context.Context, id uuid.UUID) error {
 	query := `
 DELETE FROM playlists
 WHERE id=$1;
 `
-	_, err := p.db.Exec(query, id)
+	_, err := p.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -244,13 +523,27 @@ WHERE id=$1;
 }
 
 // UpdatePlaylistBadDelete updates a playlist entry after a failed delete of a playlist
-func (p *Postgres) UpdatePlaylistBadDelete(id uuid.UUID, failureMsg string) error {
+func (p *Postgres) UpdatePlaylistBadDelete(ctx context.Context, id uuid.UUID, failureMsg string) error {
 	query := `
 UPDATE playlists SET
 	failure_msg=$1,
 WHERE id=$2;
 `
-	_, err := p.db.Exec(query, failureMsg, id)
+	_, err := p.db.ExecContext(ctx, query, failureMsg, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetPlaylistsPaused pauses or resumes the scheduled builds of a user's playlists
+func (p *Postgres) SetPlaylistsPaused(ctx context.Context, userID uuid.UUID, ids []uuid.UUID, paused bool) error {
+	query := `
+UPDATE playlists SET
+	paused=$1
+WHERE user_id=$2 AND id=ANY($3);
+`
+	_, err := p.db.ExecContext(ctx, query, paused, userID, pq.Array(ids))
 	if err != nil {
 		return err
 	}
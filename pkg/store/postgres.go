@@ -9,8 +9,8 @@ type Postgres struct {
 	db *sqlx.DB
 }
 
-// New returns a new Postgres struct using the given DB
-func New(db *sqlx.DB) *Postgres {
+// NewPostgres returns a new Postgres struct using the given DB
+func NewPostgres(db *sqlx.DB) *Postgres {
 	return &Postgres{
 		db: db,
 	}
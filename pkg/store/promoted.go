@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// AddPromotedTracks saves tracks collaborators added so they are included in every build of a playlist
+func (p *Postgres) AddPromotedTracks(ctx context.Context, playlistID uuid.UUID, trackIDs []string) error {
+	query := `
+INSERT INTO promoted_tracks (
+	playlist_id,
+	track_id
+)
+SELECT $1, unnest($2::TEXT[])
+ON CONFLICT DO NOTHING;
+`
+	_, err := p.db.ExecContext(ctx, query, playlistID, pq.Array(trackIDs))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetPromotedTracks returns the tracks promoted into a playlist, oldest first
+func (p *Postgres) GetPromotedTracks(ctx context.Context, playlistID uuid.UUID) ([]string, error) {
+	var trackIDs []string
+	query := `
+SELECT track_id
+FROM promoted_tracks
+WHERE playlist_id=$1
+ORDER BY created_at, track_id;
+`
+	err := p.db.SelectContext(ctx, &trackIDs, query, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	return trackIDs, nil
+}
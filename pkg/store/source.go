@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// SourceTracks is a cached listing of every track in a track source at a given snapshot
+type SourceTracks struct {
+	SourceID     string   `db:"source_id"`
+	SnapshotID   string   `db:"snapshot_id"`
+	Tracks       []string // Empty IDs hold the place of items that aren't tracks
+	TracksString string   `db:"tracks"`
+
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// UnmarshalTracks unpacks a JSON string into the tracks slice
+func (s *SourceTracks) UnmarshalTracks() error {
+	var tracks []string
+	err := json.Unmarshal([]byte(s.TracksString), &tracks)
+	if err != nil {
+		return err
+	}
+	s.Tracks = tracks
+	return nil
+}
+
+// GetSourceTracks returns the cached listing for a track source or nil if it was never cached
+func (p *Postgres) GetSourceTracks(ctx context.Context, sourceID string) (*SourceTracks, error) {
+	var sourceTracks SourceTracks
+	query := `
+SELECT *
+FROM source_tracks
+WHERE source_id=$1;
+`
+	err := p.db.GetContext(ctx, &sourceTracks, query, sourceID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = sourceTracks.UnmarshalTracks()
+	if err != nil {
+		return nil, err
+	}
+	return &sourceTracks, nil
+}
+
+// PutSourceTracks caches the listing of a track source, replacing any listing from an older snapshot
+func (p *Postgres) PutSourceTracks(ctx context.Context, sourceID, snapshotID string, tracks []string) error {
+	b, err := json.Marshal(&tracks)
+	if err != nil {
+		return err
+	}
+
+	query := `
+INSERT INTO source_tracks (
+	source_id,
+	snapshot_id,
+	tracks
+)
+VALUES (
+	$1,
+	$2,
+	$3
+)
+ON CONFLICT (source_id) DO UPDATE SET
+	snapshot_id=EXCLUDED.snapshot_id,
+	tracks=EXCLUDED.tracks;
+`
+	_, err = p.db.ExecContext(ctx, query, sourceID, snapshotID, string(b))
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package store
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+// SQLite is an implementation of Store backed by a SQLite file, so the app can be tried out
+// and developed on without running Postgres. It matches Postgres with a few differences:
+// IDs are generated here rather than by the database, timestamps are stored as UTC text
+// and are compared through julianday, and NOW() is strftime('%Y-%m-%d %H:%M:%f', 'now').
+// Queries use ? placeholders since SQLite numbers $N placeholders in the order they appear.
+type SQLite struct {
+	db *sqlx.DB
+}
+
+// NewSQLite returns a new SQLite struct using the given DB
+func NewSQLite(db *sqlx.DB) *SQLite {
+	return &SQLite{
+		db: db,
+	}
+}
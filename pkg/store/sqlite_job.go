@@ -0,0 +1,420 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EnqueueJob adds a job to the queue to be run as soon as a worker is free
+func (s *SQLite) EnqueueJob(ctx context.Context, kind JobKind, userID, playlistID uuid.UUID) error {
+	query := `
+INSERT INTO jobs (
+	id,
+	kind,
+	user_id,
+	playlist_id
+)
+VALUES (
+	?,
+	?,
+	?,
+	?
+);
+`
+	_, err := s.db.ExecContext(ctx, query, uuid.New(), kind, userID, playlistID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ClaimJob locks the next runnable job for the caller and returns nil if there is none.
+// Jobs left running for longer than staleAfter are assumed to belong to a dead worker and are claimed again.
+// SQLite only lets one connection write at a time so the single statement can't race another worker.
+func (s *SQLite) ClaimJob(ctx context.Context, staleAfter time.Duration) (*Job, error) {
+	var job Job
+	query := `
+UPDATE jobs SET
+	status='Running',
+	attempts=attempts+1,
+	locked_at=strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE id = (
+	SELECT id
+	FROM jobs
+	WHERE (status='Queued' AND julianday(run_at)<=julianday('now'))
+		OR (status='Running' AND julianday(locked_at)<julianday(?))
+	ORDER BY julianday(run_at)
+	LIMIT 1
+)
+RETURNING *;
+`
+	err := s.db.GetContext(ctx, &job, query, time.Now().Add(-staleAfter).UTC())
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// HeartbeatJob refreshes the lock on a running job so it isn't mistaken for one whose worker died
+func (s *SQLite) HeartbeatJob(ctx context.Context, id uuid.UUID) error {
+	query := `
+UPDATE jobs SET
+	locked_at=strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE id=? AND status='Running';
+`
+	_, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CompleteJob marks a claimed job as successfully finished
+func (s *SQLite) CompleteJob(ctx context.Context, id uuid.UUID) error {
+	query := `
+UPDATE jobs SET
+	status='Done',
+	last_error=NULL,
+	locked_at=NULL
+WHERE id=?;
+`
+	_, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RetryJob puts a failed job back in the queue to be run again at runAt
+func (s *SQLite) RetryJob(ctx context.Context, id uuid.UUID, lastError string, runAt time.Time) error {
+	query := `
+UPDATE jobs SET
+	status='Queued',
+	last_error=?,
+	run_at=?,
+	locked_at=NULL
+WHERE id=?;
+`
+	_, err := s.db.ExecContext(ctx, query, lastError, runAt.UTC(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CancelQueuedJobs cancels any jobs of the given kind for one of a user's playlists that haven't been claimed yet
+func (s *SQLite) CancelQueuedJobs(ctx context.Context, kind JobKind, userID, playlistID uuid.UUID) error {
+	query := `
+UPDATE jobs SET
+	status='Cancelled'
+WHERE kind=? AND user_id=? AND playlist_id=? AND status='Queued';
+`
+	_, err := s.db.ExecContext(ctx, query, kind, userID, playlistID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FailJob marks a job as permanently failed once it has run out of attempts
+func (s *SQLite) FailJob(ctx context.Context, id uuid.UUID, lastError string) error {
+	query := `
+UPDATE jobs SET
+	status='Failed',
+	last_error=?,
+	locked_at=NULL
+WHERE id=?;
+`
+	_, err := s.db.ExecContext(ctx, query, lastError, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CreateWebhook inserts a new webhook endpoint for a user
+func (s *SQLite) CreateWebhook(ctx context.Context, userID uuid.UUID, url, secret string) error {
+	query := `
+INSERT INTO webhooks (
+	id,
+	user_id,
+	url,
+	secret
+)
+VALUES (
+	?,
+	?,
+	?,
+	?
+);
+`
+	_, err := s.db.ExecContext(ctx, query, uuid.New(), userID, url, secret)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetWebhook returns a single webhook
+func (s *SQLite) GetWebhook(ctx context.Context, id uuid.UUID) (*Webhook, error) {
+	var webhook Webhook
+	query := `
+SELECT *
+FROM webhooks
+WHERE id=?;
+`
+	err := s.db.GetContext(ctx, &webhook, query, id)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// GetWebhooks returns all of a user's webhooks
+func (s *SQLite) GetWebhooks(ctx context.Context, userID uuid.UUID) ([]Webhook, error) {
+	var webhooks []Webhook
+	query := `
+SELECT *
+FROM webhooks
+WHERE user_id=?
+ORDER BY created_at;
+`
+	err := s.db.SelectContext(ctx, &webhooks, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes one of a user's webhooks along with its delivery log
+func (s *SQLite) DeleteWebhook(ctx context.Context, userID, id uuid.UUID) error {
+	query := `
+DELETE FROM webhooks
+WHERE id=? AND user_id=?;
+`
+	_, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// QueueWebhookDeliveries records a delivery of payload to each of a user's webhooks
+// and enqueues a job to send each one
+func (s *SQLite) QueueWebhookDeliveries(ctx context.Context, userID, playlistID uuid.UUID, event, payload string) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var webhookIDs []uuid.UUID
+	query := `
+SELECT id
+FROM webhooks
+WHERE user_id=?;
+`
+	err = tx.SelectContext(ctx, &webhookIDs, query, userID)
+	if err != nil {
+		return err
+	}
+
+	deliveryQuery := `
+INSERT INTO webhook_deliveries (
+	id,
+	webhook_id,
+	event,
+	payload
+)
+VALUES (
+	?,
+	?,
+	?,
+	?
+);
+`
+	jobQuery := `
+INSERT INTO jobs (
+	id,
+	kind,
+	user_id,
+	playlist_id,
+	delivery_id,
+	max_attempts
+)
+VALUES (
+	?,
+	?,
+	?,
+	?,
+	?,
+	?
+);
+`
+	for _, webhookID := range webhookIDs {
+		deliveryID := uuid.New()
+		_, err = tx.ExecContext(ctx, deliveryQuery, deliveryID, webhookID, event, payload)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, jobQuery, uuid.New(), WebhookJob, userID, playlistID, deliveryID, webhookMaxAttempts)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetWebhookDelivery returns a single webhook delivery
+func (s *SQLite) GetWebhookDelivery(ctx context.Context, id uuid.UUID) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	query := `
+SELECT d.*, w.url
+FROM webhook_deliveries d
+JOIN webhooks w ON w.id=d.webhook_id
+WHERE d.id=?;
+`
+	err := s.db.GetContext(ctx, &delivery, query, id)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// GetWebhookDeliveries returns a user's most recent webhook deliveries, newest first
+func (s *SQLite) GetWebhookDeliveries(ctx context.Context, userID uuid.UUID, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	query := `
+SELECT d.*, w.url
+FROM webhook_deliveries d
+JOIN webhooks w ON w.id=d.webhook_id
+WHERE w.user_id=?
+ORDER BY d.created_at DESC
+LIMIT ?;
+`
+	err := s.db.SelectContext(ctx, &deliveries, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// UpdateWebhookDeliveryAttempt records the outcome of an attempt to send a webhook delivery
+func (s *SQLite) UpdateWebhookDeliveryAttempt(ctx context.Context, id uuid.UUID, status DeliveryStatus, responseCode *int, lastError *string) error {
+	query := `
+UPDATE webhook_deliveries SET
+	status=?,
+	attempts=attempts+1,
+	response_code=?,
+	last_error=?,
+	delivered_at=CASE WHEN ?='Delivered' THEN strftime('%Y-%m-%d %H:%M:%f', 'now') ELSE NULL END
+WHERE id=?;
+`
+	_, err := s.db.ExecContext(ctx, query, status, responseCode, lastError, status, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CreateNotification holds a failed build for a user's next digest email
+func (s *SQLite) CreateNotification(ctx context.Context, userID, playlistID uuid.UUID, playlistName, failureMsg string, consecutiveFailures int) error {
+	query := `
+INSERT INTO notifications (
+	id,
+	user_id,
+	playlist_id,
+	playlist_name,
+	failure_msg,
+	consecutive_failures
+)
+VALUES (
+	?,
+	?,
+	?,
+	?,
+	?,
+	?
+);
+`
+	_, err := s.db.ExecContext(ctx, query, uuid.New(), userID, playlistID, playlistName, failureMsg, consecutiveFailures)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetDigestUsers returns the users with unsent notifications who haven't had a digest within interval
+func (s *SQLite) GetDigestUsers(ctx context.Context, interval time.Duration) ([]User, error) {
+	var users []User
+	query := `
+SELECT *
+FROM users u
+WHERE u.notify_delivery='Digest'
+	AND (u.last_digest_at IS NULL OR julianday(u.last_digest_at)<=julianday(?))
+	AND EXISTS (
+		SELECT 1
+		FROM notifications n
+		WHERE n.user_id=u.id AND n.sent_at IS NULL
+	);
+`
+	err := s.db.SelectContext(ctx, &users, query, time.Now().Add(-interval).UTC())
+	if err != nil {
+		return nil, err
+	}
+	for i := range users {
+		users[i].UnmarshalToken()
+	}
+	return users, nil
+}
+
+// GetPendingNotifications returns a user's unsent notifications, oldest first
+func (s *SQLite) GetPendingNotifications(ctx context.Context, userID uuid.UUID) ([]Notification, error) {
+	var notifications []Notification
+	query := `
+SELECT *
+FROM notifications
+WHERE user_id=? AND sent_at IS NULL
+ORDER BY created_at;
+`
+	err := s.db.SelectContext(ctx, &notifications, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// MarkDigestSent marks a user's notifications created up to upTo as sent and records when the digest went out
+func (s *SQLite) MarkDigestSent(ctx context.Context, userID uuid.UUID, upTo time.Time) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+UPDATE notifications SET
+	sent_at=strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE user_id=? AND sent_at IS NULL AND julianday(created_at)<=julianday(?);
+`
+	_, err = tx.ExecContext(ctx, query, userID, upTo.UTC())
+	if err != nil {
+		return err
+	}
+
+	query = `
+UPDATE users SET
+	last_digest_at=strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE id=?;
+`
+	_, err = tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,512 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// CreatePlaylist inserts a new playlist into the DB using the configuration fields of playlist
+func (s *SQLite) CreatePlaylist(ctx context.Context, userID uuid.UUID, playlist Playlist) error {
+	err := playlist.MarshalInput()
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+INSERT INTO playlists (
+	id,
+	user_id,
+	input,
+	name,
+	description,
+	public,
+	schedule,
+	cron,
+	build_time,
+	starts_on,
+	ends_on,
+	output_mode,
+	keep_builds,
+	max_size,
+	collaborative,
+	collaborator_policy,
+	edit_policy,
+	split_mode,
+	split_size
+)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+`
+	id := uuid.New()
+	_, err = tx.ExecContext(ctx,
+		query,
+		id,
+		userID,
+		playlist.InputString,
+		playlist.Name,
+		playlist.Description,
+		playlist.Public,
+		playlist.Schedule,
+		playlist.Cron,
+		playlist.BuildTime,
+		playlist.StartsOn,
+		playlist.EndsOn,
+		playlist.OutputMode,
+		playlist.KeepBuilds,
+		playlist.MaxSize,
+		playlist.Collaborative,
+		playlist.CollaboratorPolicy,
+		playlist.EditPolicy,
+		playlist.SplitMode,
+		playlist.SplitSize,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = writeTrackSources(ctx, tx, id, playlist.Input.TrackSources)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdatePlaylistConfig updates the part of a playlist row that configures how Spotify playlists are built
+func (s *SQLite) UpdatePlaylistConfig(ctx context.Context, id uuid.UUID, playlist Playlist) error {
+	query := `
+UPDATE playlists SET
+	input=?,
+	name=?,
+	description=?,
+	public=?,
+	schedule=?,
+	cron=?,
+	build_time=?,
+	starts_on=?,
+	ends_on=?,
+	output_mode=?,
+	keep_builds=?,
+	max_size=?,
+	collaborative=?,
+	collaborator_policy=?,
+	edit_policy=?,
+	split_mode=?,
+	split_size=?,
+	current=FALSE
+WHERE id=?;
+`
+	err := playlist.MarshalInput()
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		query,
+		playlist.InputString,
+		playlist.Name,
+		playlist.Description,
+		playlist.Public,
+		playlist.Schedule,
+		playlist.Cron,
+		playlist.BuildTime,
+		playlist.StartsOn,
+		playlist.EndsOn,
+		playlist.OutputMode,
+		playlist.KeepBuilds,
+		playlist.MaxSize,
+		playlist.Collaborative,
+		playlist.CollaboratorPolicy,
+		playlist.EditPolicy,
+		playlist.SplitMode,
+		playlist.SplitSize,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = writeTrackSources(ctx, tx, id, playlist.Input.TrackSources)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetPlaylist returns the playlist with a given id
+func (s *SQLite) GetPlaylist(ctx context.Context, id uuid.UUID) (*Playlist, error) {
+	query := `
+SELECT *
+FROM playlists
+WHERE id=?;
+`
+	playlists, err := s.selectPlaylists(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(playlists) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &playlists[0], nil
+}
+
+// GetPlaylists retrieves all the playlists associated with a given userID
+func (s *SQLite) GetPlaylists(ctx context.Context, userID uuid.UUID) ([]Playlist, error) {
+	query := `
+SELECT *
+FROM playlists
+WHERE user_id=?;
+`
+	return s.selectPlaylists(ctx, query, userID)
+}
+
+// GetAllPlaylists returns all stored playlists
+func (s *SQLite) GetAllPlaylists(ctx context.Context) ([]Playlist, error) {
+	query := `
+SELECT *
+FROM playlists;
+`
+	return s.selectPlaylists(ctx, query)
+}
+
+// selectPlaylists runs a query for playlist rows and fills in their inputs. SQLite transactions
+// are always serializable so the rows and their sources are read from the same snapshot.
+func (s *SQLite) selectPlaylists(ctx context.Context, query string, args ...interface{}) ([]Playlist, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	playlists := []Playlist{}
+	err = tx.SelectContext(ctx, &playlists, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range playlists {
+		err = playlists[i].UnmarshalInput()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = readTrackSources(ctx, tx, playlists)
+	if err != nil {
+		return nil, err
+	}
+	return playlists, tx.Commit()
+}
+
+// UpdatePlaylistStartBuild sets a playlists building boolean to true
+func (s *SQLite) UpdatePlaylistStartBuild(ctx context.Context, id uuid.UUID) error {
+	query := `
+UPDATE playlists SET
+	building=TRUE,
+	cancel_requested=FALSE
+WHERE id=?;
+`
+	_, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdatePlaylistGoodBuild updates a playlist entry after a successful build of the playlist,
+// recording the spotify playlists it built, the tracks in the first of them and saving the
+// manual edits it found in the build it replaced
+func (s *SQLite) UpdatePlaylistGoodBuild(ctx context.Context, id uuid.UUID, targets []OutputTarget, tracks []string, edits ManualEdits) error {
+	if len(targets) == 0 {
+		return fmt.Errorf("no spotify playlists were built for playlist %s", id)
+	}
+	spotifyID := targets[0].SpotifyID
+	b, err := json.Marshal(&tracks)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+UPDATE playlists SET
+	spotify_id=?,
+	last_built_at=strftime('%Y-%m-%d %H:%M:%f', 'now'),
+	failure_msg=NULL,
+	consecutive_failures=0,
+	building=FALSE,
+	cancel_requested=FALSE,
+	current=TRUE,
+	edits_added=?,
+	edits_removed=?
+WHERE id=?;
+`
+	_, err = tx.ExecContext(ctx, query, spotifyID, edits.Added, edits.Removed, id)
+	if err != nil {
+		return err
+	}
+
+	query = `
+INSERT INTO archived_playlists (
+	id,
+	playlist_id,
+	spotify_id
+)
+VALUES (
+	?,
+	?,
+	?
+)
+ON CONFLICT (playlist_id, spotify_id) DO UPDATE SET
+	created_at=strftime('%Y-%m-%d %H:%M:%f', 'now');
+`
+	for _, target := range targets {
+		_, err = tx.ExecContext(ctx, query, uuid.New(), id, target.SpotifyID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query = `
+DELETE FROM output_targets
+WHERE playlist_id=?;
+`
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	query = `
+INSERT INTO output_targets (
+	playlist_id,
+	position,
+	name,
+	spotify_id
+)
+VALUES (
+	?,
+	?,
+	?,
+	?
+);
+`
+	for i, target := range targets {
+		_, err = tx.ExecContext(ctx, query, id, i, target.Name, target.SpotifyID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query = `
+INSERT INTO built_tracks (
+	playlist_id,
+	spotify_id,
+	tracks
+)
+VALUES (
+	?,
+	?,
+	?
+)
+ON CONFLICT (playlist_id) DO UPDATE SET
+	spotify_id=excluded.spotify_id,
+	tracks=excluded.tracks;
+`
+	_, err = tx.ExecContext(ctx, query, id, spotifyID, string(b))
+	if err != nil {
+		return err
+	}
+
+	err = saveManualEdits(ctx, tx, id, edits)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdatePlaylistBadBuild updates a playlist entry after a failed build of a playlist
+func (s *SQLite) UpdatePlaylistBadBuild(ctx context.Context, id uuid.UUID, failureMsg string) error {
+	query := `
+UPDATE playlists SET
+	last_built_at=strftime('%Y-%m-%d %H:%M:%f', 'now'),
+	failure_msg=?,
+	consecutive_failures=consecutive_failures+1,
+	building=FALSE,
+	cancel_requested=FALSE
+WHERE id=?;
+`
+	_, err := s.db.ExecContext(ctx, query, failureMsg, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RequestCancelBuild flags one of a user's building playlists so that whoever is building it stops
+func (s *SQLite) RequestCancelBuild(ctx context.Context, userID, id uuid.UUID) error {
+	query := `
+UPDATE playlists SET
+	cancel_requested=TRUE
+WHERE id=? AND user_id=? AND building=TRUE;
+`
+	_, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// IsCancelRequested reports whether a cancel has been requested for the playlist's current build
+func (s *SQLite) IsCancelRequested(ctx context.Context, id uuid.UUID) (bool, error) {
+	var cancelRequested bool
+	query := `
+SELECT cancel_requested
+FROM playlists
+WHERE id=?;
+`
+	err := s.db.GetContext(ctx, &cancelRequested, query, id)
+	if err != nil {
+		return false, err
+	}
+	return cancelRequested, nil
+}
+
+// UpdatePlaylistRetryingBuild updates a playlist entry after a build attempt failed and
+// will be tried again, leaving the previous build in place without recording a failure
+func (s *SQLite) UpdatePlaylistRetryingBuild(ctx context.Context, id uuid.UUID) error {
+	query := `
+UPDATE playlists SET
+	building=FALSE,
+	cancel_requested=FALSE
+WHERE id=?;
+`
+	_, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdatePlaylistCancelledBuild updates a playlist entry after its build was cancelled, leaving the previous build in place
+func (s *SQLite) UpdatePlaylistCancelledBuild(ctx context.Context, id uuid.UUID) error {
+	query := `
+UPDATE playlists SET
+	building=FALSE,
+	cancel_requested=FALSE
+WHERE id=?;
+`
+	_, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeletePlaylist deletes the playlist entry matching the given id
+func (s *SQLite) DeletePlaylist(ctx context.Context, id uuid.UUID) error {
+	query := `
+DELETE FROM playlists
+WHERE id=?;
+`
+	_, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdatePlaylistBadDelete updates a playlist entry after a failed delete of a playlist
+func (s *SQLite) UpdatePlaylistBadDelete(ctx context.Context, id uuid.UUID, failureMsg string) error {
+	query := `
+UPDATE playlists SET
+	failure_msg=?
+WHERE id=?;
+`
+	_, err := s.db.ExecContext(ctx, query, failureMsg, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetPlaylistsPaused pauses or resumes the scheduled builds of a user's playlists
+func (s *SQLite) SetPlaylistsPaused(ctx context.Context, userID uuid.UUID, ids []uuid.UUID, paused bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query, args, err := sqlx.In(`
+UPDATE playlists SET
+	paused=?
+WHERE user_id=? AND id IN (?);
+`, paused, userID, ids)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetArchivedPlaylists returns every spotify playlist still kept for a playlist, newest first
+func (s *SQLite) GetArchivedPlaylists(ctx context.Context, playlistID uuid.UUID) ([]ArchivedPlaylist, error) {
+	var archived []ArchivedPlaylist
+	query := `
+SELECT *
+FROM archived_playlists
+WHERE playlist_id=?
+ORDER BY created_at DESC;
+`
+	err := s.db.SelectContext(ctx, &archived, query, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	return archived, nil
+}
+
+// DeleteArchivedPlaylist stops tracking a spotify playlist once it has been unfollowed
+func (s *SQLite) DeleteArchivedPlaylist(ctx context.Context, id uuid.UUID) error {
+	query := `
+DELETE FROM archived_playlists
+WHERE id=?;
+`
+	_, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetOutputTargets returns every spotify playlist the last good build of a playlist
+// put its tracks in, in order
+func (s *SQLite) GetOutputTargets(ctx context.Context, playlistID uuid.UUID) ([]OutputTarget, error) {
+	var targets []OutputTarget
+	query := `
+SELECT *
+FROM output_targets
+WHERE playlist_id=?
+ORDER BY position;
+`
+	err := s.db.SelectContext(ctx, &targets, query, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
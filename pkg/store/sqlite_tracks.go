@@ -0,0 +1,195 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// AddPromotedTracks saves tracks collaborators added so they are included in every build of a playlist
+func (s *SQLite) AddPromotedTracks(ctx context.Context, playlistID uuid.UUID, trackIDs []string) error {
+	query := `
+INSERT INTO promoted_tracks (
+	playlist_id,
+	track_id
+)
+VALUES (
+	?,
+	?
+)
+ON CONFLICT DO NOTHING;
+`
+	return s.insertTracks(ctx, query, playlistID, trackIDs)
+}
+
+// GetPromotedTracks returns the tracks promoted into a playlist, oldest first
+func (s *SQLite) GetPromotedTracks(ctx context.Context, playlistID uuid.UUID) ([]string, error) {
+	var trackIDs []string
+	query := `
+SELECT track_id
+FROM promoted_tracks
+WHERE playlist_id=?
+ORDER BY created_at, track_id;
+`
+	err := s.db.SelectContext(ctx, &trackIDs, query, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	return trackIDs, nil
+}
+
+// GetBuiltTracks returns what the last good build of a playlist built or nil if none was recorded
+func (s *SQLite) GetBuiltTracks(ctx context.Context, playlistID uuid.UUID) (*BuiltTracks, error) {
+	var builtTracks BuiltTracks
+	query := `
+SELECT *
+FROM built_tracks
+WHERE playlist_id=?;
+`
+	err := s.db.GetContext(ctx, &builtTracks, query, playlistID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = builtTracks.UnmarshalTracks()
+	if err != nil {
+		return nil, err
+	}
+	return &builtTracks, nil
+}
+
+// AddExcludedTracks saves tracks removed by hand so they are left out of every build of a playlist
+func (s *SQLite) AddExcludedTracks(ctx context.Context, playlistID uuid.UUID, trackIDs []string) error {
+	query := `
+INSERT INTO excluded_tracks (
+	playlist_id,
+	track_id
+)
+VALUES (
+	?,
+	?
+)
+ON CONFLICT DO NOTHING;
+`
+	return s.insertTracks(ctx, query, playlistID, trackIDs)
+}
+
+// RemoveExcludedTracks lets previously excluded tracks back into builds of a playlist
+func (s *SQLite) RemoveExcludedTracks(ctx context.Context, playlistID uuid.UUID, trackIDs []string) error {
+	if len(trackIDs) == 0 {
+		return nil
+	}
+	query, args, err := sqlx.In(`
+DELETE FROM excluded_tracks
+WHERE playlist_id=? AND track_id IN (?);
+`, playlistID, trackIDs)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ClearExcludedTracks lets every excluded track back into builds of a playlist
+func (s *SQLite) ClearExcludedTracks(ctx context.Context, playlistID uuid.UUID) error {
+	query := `
+DELETE FROM excluded_tracks
+WHERE playlist_id=?;
+`
+	_, err := s.db.ExecContext(ctx, query, playlistID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetExcludedTracks returns the tracks excluded from a playlist, oldest first
+func (s *SQLite) GetExcludedTracks(ctx context.Context, playlistID uuid.UUID) ([]string, error) {
+	var trackIDs []string
+	query := `
+SELECT track_id
+FROM excluded_tracks
+WHERE playlist_id=?
+ORDER BY created_at, track_id;
+`
+	err := s.db.SelectContext(ctx, &trackIDs, query, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	return trackIDs, nil
+}
+
+// insertTracks runs an insert of a playlist and track ID once for each track, all or nothing,
+// since SQLite has no arrays to unnest
+func (s *SQLite) insertTracks(ctx context.Context, query string, playlistID uuid.UUID, trackIDs []string) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, trackID := range trackIDs {
+		_, err = tx.ExecContext(ctx, query, playlistID, trackID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetSourceTracks returns the cached listing for a track source or nil if it was never cached
+func (s *SQLite) GetSourceTracks(ctx context.Context, sourceID string) (*SourceTracks, error) {
+	var sourceTracks SourceTracks
+	query := `
+SELECT *
+FROM source_tracks
+WHERE source_id=?;
+`
+	err := s.db.GetContext(ctx, &sourceTracks, query, sourceID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = sourceTracks.UnmarshalTracks()
+	if err != nil {
+		return nil, err
+	}
+	return &sourceTracks, nil
+}
+
+// PutSourceTracks caches the listing of a track source, replacing any listing from an older snapshot
+func (s *SQLite) PutSourceTracks(ctx context.Context, sourceID, snapshotID string, tracks []string) error {
+	b, err := json.Marshal(&tracks)
+	if err != nil {
+		return err
+	}
+
+	query := `
+INSERT INTO source_tracks (
+	source_id,
+	snapshot_id,
+	tracks
+)
+VALUES (
+	?,
+	?,
+	?
+)
+ON CONFLICT (source_id) DO UPDATE SET
+	snapshot_id=excluded.snapshot_id,
+	tracks=excluded.tracks;
+`
+	_, err = s.db.ExecContext(ctx, query, sourceID, snapshotID, string(b))
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+// GetUserByID returns a User matching the given id
+func (s *SQLite) GetUserByID(ctx context.Context, id uuid.UUID) (*User, error) {
+	var user User
+	query := `
+SELECT *
+FROM users
+WHERE id=?;
+`
+	err := s.db.GetContext(ctx, &user, query, id)
+	if err != nil {
+		return nil, err
+	}
+	user.UnmarshalToken()
+	return &user, nil
+}
+
+// GetUserBySpotifyID returns a User matching the given spotifyID
+func (s *SQLite) GetUserBySpotifyID(ctx context.Context, spotifyID string) (*User, error) {
+	return nil, errors.New("not implemented")
+}
+
+// GetUserID returns the UUID for a user based off of a session token
+func (s *SQLite) GetUserID(ctx context.Context, sessionToken string) (*uuid.UUID, error) {
+	var id uuid.UUID
+	query := `
+SELECT id
+FROM users
+WHERE session_token=?;
+`
+	err := s.db.GetContext(ctx, &id, query, sessionToken)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// UserExists determines if there is a user for the give spotifyID already
+func (s *SQLite) UserExists(ctx context.Context, spotifyID string) (bool, error) {
+	var exists bool
+	query := `
+SELECT exists (
+	SELECT *
+	FROM users
+	WHERE spotify_id=?
+);
+`
+	err := s.db.QueryRowContext(ctx, query, spotifyID).Scan(&exists)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	return exists, nil
+}
+
+// GetSessionExpiry returns the expiry time of a sessionToken
+func (s *SQLite) GetSessionExpiry(ctx context.Context, sessionToken string) (*time.Time, error) {
+	query := `
+SELECT session_expiry
+FROM users
+WHERE session_token=?;
+`
+	var sessionExpiry time.Time
+	err := s.db.GetContext(ctx, &sessionExpiry, query, sessionToken)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionExpiry, nil
+}
+
+// CreateUser creates a new user row in the DB
+func (s *SQLite) CreateUser(ctx context.Context, spotifyID, sessionToken string, sessionExpiry time.Time, token oauth2.Token) error {
+	query := `
+INSERT INTO users (
+	id,
+	spotify_id,
+	playlists_built,
+	session_token,
+	session_expiry,
+	access_token,
+	refresh_token,
+	token_type,
+	token_expiry
+)
+VALUES
+	(?, ?, ?, ?, ?, ?, ?, ?, ?);
+`
+	_, err := s.db.ExecContext(ctx,
+		query,
+		uuid.New(),
+		spotifyID,
+		0,
+		sessionToken,
+		sessionExpiry.UTC(),
+		token.AccessToken,
+		token.RefreshToken,
+		token.TokenType,
+		token.Expiry.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateUser updates an existing user with new sesion and oauth2 token data
+func (s *SQLite) UpdateUser(ctx context.Context, spotifyID, sessionToken string, sessionExpiry time.Time, token oauth2.Token) error {
+	query := `
+UPDATE users SET
+	session_token=?,
+	session_expiry=?,
+	access_token=?,
+	refresh_token=?,
+	token_type=?,
+	token_expiry=?
+WHERE
+	spotify_id=?;
+`
+	_, err := s.db.ExecContext(ctx,
+		query,
+		sessionToken,
+		sessionExpiry.UTC(),
+		token.AccessToken,
+		token.RefreshToken,
+		token.TokenType,
+		token.Expiry.UTC(),
+		spotifyID,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// IncrementUserBuildCount increments playlists_built by one for the given userID
+func (s *SQLite) IncrementUserBuildCount(ctx context.Context, userID uuid.UUID) error {
+	query := `
+UPDATE users SET
+	playlists_built=playlists_built+1
+WHERE id=?;
+`
+	_, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateUserSettings saves the preferences a user changes from the settings page
+func (s *SQLite) UpdateUserSettings(ctx context.Context, userID uuid.UUID, settings UserSettings) error {
+	query := `
+UPDATE users SET
+	email=?,
+	notify_on=?,
+	notify_delivery=?,
+	timezone=?
+WHERE id=?;
+`
+	_, err := s.db.ExecContext(ctx, query, settings.Email, settings.NotifyOn, settings.NotifyDelivery, settings.Timezone, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,24 +11,77 @@ import (
 // Store provides methods for getting data on users, playlists, and more
 type Store interface {
 	// Users
-	GetUserByID(id uuid.UUID) (*User, error)
-	GetUserBySpotifyID(spotifyID string) (*User, error)
-	GetUserID(sessionToken string) (*uuid.UUID, error)
-	UserExists(spotifyID string) (bool, error)
-	GetSessionExpiry(sessionToken string) (*time.Time, error)
-	CreateUser(spotifyID, sessionToken string, sessionExpiry time.Time, token oauth2.Token) error
-	UpdateUser(spotifyID, sessionToken string, sessionExpiry time.Time, token oauth2.Token) error
-	IncrementUserBuildCount(userID uuid.UUID) error
+	GetUserByID(ctx context.Context, id uuid.UUID) (*User, error)
+	GetUserBySpotifyID(ctx context.Context, spotifyID string) (*User, error)
+	GetUserID(ctx context.Context, sessionToken string) (*uuid.UUID, error)
+	UserExists(ctx context.Context, spotifyID string) (bool, error)
+	GetSessionExpiry(ctx context.Context, sessionToken string) (*time.Time, error)
+	CreateUser(ctx context.Context, spotifyID, sessionToken string, sessionExpiry time.Time, token oauth2.Token) error
+	UpdateUser(ctx context.Context, spotifyID, sessionToken string, sessionExpiry time.Time, token oauth2.Token) error
+	IncrementUserBuildCount(ctx context.Context, userID uuid.UUID) error
+	UpdateUserSettings(ctx context.Context, userID uuid.UUID, settings UserSettings) error
 
 	// Playlists
-	CreatePlaylist(userID uuid.UUID, input Input, name, description string, public bool, schedule Schedule) error
-	UpdatePlaylistConfig(id uuid.UUID, playlist Playlist) error
-	GetPlaylist(id uuid.UUID) (*Playlist, error)
-	GetPlaylists(userID uuid.UUID) ([]Playlist, error)
-	GetAllPlaylists() ([]Playlist, error)
-	UpdatePlaylistGoodBuild(id uuid.UUID, spotifyID string) error
-	UpdatePlaylistBadBuild(id uuid.UUID, failureMsg string) error
-	UpdatePlaylistStartBuild(id uuid.UUID) error
-	DeletePlaylist(id uuid.UUID) error
-	UpdatePlaylistBadDelete(id uuid.UUID, failureMsg string) error
+	CreatePlaylist(ctx context.Context, userID uuid.UUID, playlist Playlist) error
+	UpdatePlaylistConfig(ctx context.Context, id uuid.UUID, playlist Playlist) error
+	GetPlaylist(ctx context.Context, id uuid.UUID) (*Playlist, error)
+	GetPlaylists(ctx context.Context, userID uuid.UUID) ([]Playlist, error)
+	GetAllPlaylists(ctx context.Context) ([]Playlist, error)
+	UpdatePlaylistGoodBuild(ctx context.Context, id uuid.UUID, targets []OutputTarget, tracks []string, edits ManualEdits) error
+	UpdatePlaylistBadBuild(ctx context.Context, id uuid.UUID, failureMsg string) error
+	UpdatePlaylistStartBuild(ctx context.Context, id uuid.UUID) error
+	UpdatePlaylistRetryingBuild(ctx context.Context, id uuid.UUID) error
+	RequestCancelBuild(ctx context.Context, userID, id uuid.UUID) error
+	IsCancelRequested(ctx context.Context, id uuid.UUID) (bool, error)
+	UpdatePlaylistCancelledBuild(ctx context.Context, id uuid.UUID) error
+	SetPlaylistsPaused(ctx context.Context, userID uuid.UUID, ids []uuid.UUID, paused bool) error
+	DeletePlaylist(ctx context.Context, id uuid.UUID) error
+	UpdatePlaylistBadDelete(ctx context.Context, id uuid.UUID, failureMsg string) error
+
+	// Archived playlists
+	GetArchivedPlaylists(ctx context.Context, playlistID uuid.UUID) ([]ArchivedPlaylist, error)
+	DeleteArchivedPlaylist(ctx context.Context, id uuid.UUID) error
+
+	// Output targets
+	GetOutputTargets(ctx context.Context, playlistID uuid.UUID) ([]OutputTarget, error)
+
+	// Promoted tracks
+	AddPromotedTracks(ctx context.Context, playlistID uuid.UUID, trackIDs []string) error
+	GetPromotedTracks(ctx context.Context, playlistID uuid.UUID) ([]string, error)
+
+	// Manual edits
+	GetBuiltTracks(ctx context.Context, playlistID uuid.UUID) (*BuiltTracks, error)
+	AddExcludedTracks(ctx context.Context, playlistID uuid.UUID, trackIDs []string) error
+	RemoveExcludedTracks(ctx context.Context, playlistID uuid.UUID, trackIDs []string) error
+	ClearExcludedTracks(ctx context.Context, playlistID uuid.UUID) error
+	GetExcludedTracks(ctx context.Context, playlistID uuid.UUID) ([]string, error)
+
+	// Source track caches
+	GetSourceTracks(ctx context.Context, sourceID string) (*SourceTracks, error)
+	PutSourceTracks(ctx context.Context, sourceID, snapshotID string, tracks []string) error
+
+	// Jobs
+	EnqueueJob(ctx context.Context, kind JobKind, userID, playlistID uuid.UUID) error
+	ClaimJob(ctx context.Context, staleAfter time.Duration) (*Job, error)
+	HeartbeatJob(ctx context.Context, id uuid.UUID) error
+	CompleteJob(ctx context.Context, id uuid.UUID) error
+	RetryJob(ctx context.Context, id uuid.UUID, lastError string, runAt time.Time) error
+	CancelQueuedJobs(ctx context.Context, kind JobKind, userID, playlistID uuid.UUID) error
+	FailJob(ctx context.Context, id uuid.UUID, lastError string) error
+
+	// Webhooks
+	CreateWebhook(ctx context.Context, userID uuid.UUID, url, secret string) error
+	GetWebhook(ctx context.Context, id uuid.UUID) (*Webhook, error)
+	GetWebhooks(ctx context.Context, userID uuid.UUID) ([]Webhook, error)
+	DeleteWebhook(ctx context.Context, userID, id uuid.UUID) error
+	QueueWebhookDeliveries(ctx context.Context, userID, playlistID uuid.UUID, event, payload string) error
+	GetWebhookDelivery(ctx context.Context, id uuid.UUID) (*WebhookDelivery, error)
+	GetWebhookDeliveries(ctx context.Context, userID uuid.UUID, limit int) ([]WebhookDelivery, error)
+	UpdateWebhookDeliveryAttempt(ctx context.Context, id uuid.UUID, status DeliveryStatus, responseCode *int, lastError *string) error
+
+	// Notifications
+	CreateNotification(ctx context.Context, userID, playlistID uuid.UUID, playlistName, failureMsg string, consecutiveFailures int) error
+	GetDigestUsers(ctx context.Context, interval time.Duration) ([]User, error)
+	GetPendingNotifications(ctx context.Context, userID uuid.UUID) ([]Notification, error)
+	MarkDigestSent(ctx context.Context, userID uuid.UUID, upTo time.Time) error
 }
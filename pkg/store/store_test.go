@@ -0,0 +1,453 @@
+package store_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+
+	"github.com/calebschoepp/playlist-rotator/migrations"
+	"github.com/calebschoepp/playlist-rotator/pkg/migrate"
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+)
+
+// forEachStore runs test against every backend available. SQLite always runs on a fresh
+// file. Postgres only runs when DATABASE_URL is set, which must point at a scratch
+// database since the suite migrates it and clears its job queue.
+func forEachStore(t *testing.T, test func(t *testing.T, s store.Store)) {
+	t.Run("SQLite", func(t *testing.T) {
+		db, err := store.Open("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		migrateUp(t, db)
+		test(t, store.NewSQLite(db))
+	})
+
+	t.Run("Postgres", func(t *testing.T) {
+		databaseURL := os.Getenv("DATABASE_URL")
+		if databaseURL == "" {
+			t.Skip("DATABASE_URL is not set")
+		}
+		db, err := store.Open(databaseURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		migrateUp(t, db)
+		// Jobs from earlier runs would be claimed ahead of the ones the test queues
+		if _, err := db.Exec("DELETE FROM jobs;"); err != nil {
+			t.Fatal(err)
+		}
+		test(t, store.NewPostgres(db))
+	})
+}
+
+func migrateUp(t *testing.T, db *sqlx.DB) {
+	t.Helper()
+	m, err := migrate.New(db, migrations.For(db.DriverName()), zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+}
+
+// createUser adds a user and returns their ID
+func createUser(t *testing.T, s store.Store) uuid.UUID {
+	t.Helper()
+	ctx := context.Background()
+	sessionToken := uuid.New().String()
+	token := oauth2.Token{AccessToken: "access", RefreshToken: "refresh", TokenType: "Bearer", Expiry: time.Now().Add(time.Hour)}
+	if err := s.CreateUser(ctx, uuid.New().String(), sessionToken, time.Now().Add(time.Hour), token); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	userID, err := s.GetUserID(ctx, sessionToken)
+	if err != nil {
+		t.Fatalf("GetUserID: %v", err)
+	}
+	return *userID
+}
+
+// createPlaylist adds a playlist with the given sources for a new user and returns it as stored
+func createPlaylist(t *testing.T, s store.Store, sources []store.TrackSource) store.Playlist {
+	t.Helper()
+	ctx := context.Background()
+	userID := createUser(t, s)
+	playlist := store.Playlist{
+		Input:              store.Input{TrackSources: sources},
+		Name:               "Morning Mix",
+		Description:        "Built every morning",
+		Schedule:           store.Daily,
+		BuildTime:          "06:00",
+		OutputMode:         store.Replace,
+		KeepBuilds:         4,
+		MaxSize:            200,
+		CollaboratorPolicy: store.DropAdded,
+		EditPolicy:         store.CarryEdits,
+		SplitMode:          store.NoSplit,
+		SplitSize:          50,
+	}
+	if err := s.CreatePlaylist(ctx, userID, playlist); err != nil {
+		t.Fatalf("CreatePlaylist: %v", err)
+	}
+	playlists, err := s.GetPlaylists(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetPlaylists: %v", err)
+	}
+	if len(playlists) != 1 {
+		t.Fatalf("user has %d playlists, want 1", len(playlists))
+	}
+	return playlists[0]
+}
+
+// claim claims the next job, failing the test if there isn't one
+func claim(t *testing.T, s store.Store, staleAfter time.Duration) *store.Job {
+	t.Helper()
+	job, err := s.ClaimJob(context.Background(), staleAfter)
+	if err != nil {
+		t.Fatalf("ClaimJob: %v", err)
+	}
+	if job == nil {
+		t.Fatal("ClaimJob found no job")
+	}
+	return job
+}
+
+// claimNone checks there is no job to claim
+func claimNone(t *testing.T, s store.Store, staleAfter time.Duration) {
+	t.Helper()
+	job, err := s.ClaimJob(context.Background(), staleAfter)
+	if err != nil {
+		t.Fatalf("ClaimJob: %v", err)
+	}
+	if job != nil {
+		t.Fatalf("ClaimJob claimed job %s in status %s, want none", job.ID, job.Status)
+	}
+}
+
+func TestJobQueue(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store) {
+		ctx := context.Background()
+		playlist := createPlaylist(t, s, nil)
+
+		claimNone(t, s, time.Hour)
+		if err := s.EnqueueJob(ctx, store.BuildJob, playlist.UserID, playlist.ID); err != nil {
+			t.Fatalf("EnqueueJob: %v", err)
+		}
+
+		job := claim(t, s, time.Hour)
+		if job.Kind != store.BuildJob || job.UserID != playlist.UserID || job.PlaylistID != playlist.ID {
+			t.Errorf("claimed %s job for user %s playlist %s", job.Kind, job.UserID, job.PlaylistID)
+		}
+		if job.Status != store.Running || job.Attempts != 1 || job.LockedAt == nil {
+			t.Errorf("claimed job is %s after %d attempts, locked at %v", job.Status, job.Attempts, job.LockedAt)
+		}
+		// A running job isn't claimed again while its worker is alive
+		claimNone(t, s, time.Hour)
+
+		// Retrying in the future keeps it from being claimed until then
+		if err := s.RetryJob(ctx, job.ID, "spotify is down", time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("RetryJob: %v", err)
+		}
+		claimNone(t, s, time.Hour)
+
+		if err := s.RetryJob(ctx, job.ID, "spotify is down", time.Now().Add(-time.Second)); err != nil {
+			t.Fatalf("RetryJob: %v", err)
+		}
+		job = claim(t, s, time.Hour)
+		if job.Attempts != 2 {
+			t.Errorf("retried job claimed with %d attempts, want 2", job.Attempts)
+		}
+		if job.LastError == nil || *job.LastError != "spotify is down" {
+			t.Errorf("retried job has last error %v", job.LastError)
+		}
+
+		// A job whose lock is older than staleAfter belongs to a dead worker and is reclaimed.
+		// A negative staleAfter makes every lock stale without waiting or trusting clocks.
+		if err := s.HeartbeatJob(ctx, job.ID); err != nil {
+			t.Fatalf("HeartbeatJob: %v", err)
+		}
+		claimNone(t, s, time.Hour)
+		reclaimed := claim(t, s, -time.Minute)
+		if reclaimed.ID != job.ID || reclaimed.Attempts != 3 {
+			t.Errorf("reclaimed job %s with %d attempts, want %s with 3", reclaimed.ID, reclaimed.Attempts, job.ID)
+		}
+
+		if err := s.CompleteJob(ctx, job.ID); err != nil {
+			t.Fatalf("CompleteJob: %v", err)
+		}
+		claimNone(t, s, -time.Minute)
+	})
+}
+
+func TestCancelQueuedJobs(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store) {
+		ctx := context.Background()
+		playlist := createPlaylist(t, s, nil)
+		if err := s.EnqueueJob(ctx, store.BuildJob, playlist.UserID, playlist.ID); err != nil {
+			t.Fatalf("EnqueueJob: %v", err)
+		}
+
+		// Only the playlist's owner can cancel its jobs
+		if err := s.CancelQueuedJobs(ctx, store.BuildJob, uuid.New(), playlist.ID); err != nil {
+			t.Fatalf("CancelQueuedJobs: %v", err)
+		}
+		job := claim(t, s, time.Hour)
+		if err := s.RetryJob(ctx, job.ID, "", time.Now().Add(-time.Second)); err != nil {
+			t.Fatalf("RetryJob: %v", err)
+		}
+
+		if err := s.CancelQueuedJobs(ctx, store.BuildJob, playlist.UserID, playlist.ID); err != nil {
+			t.Fatalf("CancelQueuedJobs: %v", err)
+		}
+		claimNone(t, s, -time.Minute)
+	})
+}
+
+func TestUpdatePlaylistGoodBuild(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store) {
+		ctx := context.Background()
+		playlist := createPlaylist(t, s, nil)
+
+		if err := s.UpdatePlaylistStartBuild(ctx, playlist.ID); err != nil {
+			t.Fatalf("UpdatePlaylistStartBuild: %v", err)
+		}
+		targets := []store.OutputTarget{
+			{Name: "Morning Mix (1/2)", SpotifyID: "spotify1"},
+			{Name: "Morning Mix (2/2)", SpotifyID: "spotify2"},
+		}
+		tracks := []string{"track1", "track2", "track3"}
+		err := s.UpdatePlaylistGoodBuild(ctx, playlist.ID, targets, tracks, store.ManualEdits{Added: 2, Removed: 1})
+		if err != nil {
+			t.Fatalf("UpdatePlaylistGoodBuild: %v", err)
+		}
+
+		got, err := s.GetPlaylist(ctx, playlist.ID)
+		if err != nil {
+			t.Fatalf("GetPlaylist: %v", err)
+		}
+		if got.SpotifyID == nil || *got.SpotifyID != "spotify1" {
+			t.Errorf("playlist spotify ID is %v, want spotify1", got.SpotifyID)
+		}
+		if got.Building || !got.Current || got.LastBuiltAt == nil {
+			t.Errorf("built playlist has building %t, current %t, last built at %v", got.Building, got.Current, got.LastBuiltAt)
+		}
+		if got.EditsAdded != 2 || got.EditsRemoved != 1 {
+			t.Errorf("playlist recorded %d added and %d removed edits", got.EditsAdded, got.EditsRemoved)
+		}
+
+		gotTargets, err := s.GetOutputTargets(ctx, playlist.ID)
+		if err != nil {
+			t.Fatalf("GetOutputTargets: %v", err)
+		}
+		if len(gotTargets) != len(targets) {
+			t.Fatalf("got %d output targets, want %d", len(gotTargets), len(targets))
+		}
+		for i, target := range gotTargets {
+			if target.Position != i || target.Name != targets[i].Name || target.SpotifyID != targets[i].SpotifyID {
+				t.Errorf("output target %d is %+v, want %+v", i, target, targets[i])
+			}
+		}
+
+		built, err := s.GetBuiltTracks(ctx, playlist.ID)
+		if err != nil {
+			t.Fatalf("GetBuiltTracks: %v", err)
+		}
+		if built == nil || built.SpotifyID != "spotify1" || !reflect.DeepEqual(built.Tracks, tracks) {
+			t.Errorf("built tracks are %+v, want %v in spotify1", built, tracks)
+		}
+
+		archived, err := s.GetArchivedPlaylists(ctx, playlist.ID)
+		if err != nil {
+			t.Fatalf("GetArchivedPlaylists: %v", err)
+		}
+		if len(archived) != 2 {
+			t.Errorf("got %d archived playlists, want 2", len(archived))
+		}
+
+		// A later build with a single target replaces the targets and tracks of the last one
+		err = s.UpdatePlaylistGoodBuild(ctx, playlist.ID, []store.OutputTarget{{Name: "Morning Mix", SpotifyID: "spotify3"}}, []string{"track4"}, store.ManualEdits{})
+		if err != nil {
+			t.Fatalf("UpdatePlaylistGoodBuild: %v", err)
+		}
+		gotTargets, err = s.GetOutputTargets(ctx, playlist.ID)
+		if err != nil {
+			t.Fatalf("GetOutputTargets: %v", err)
+		}
+		if len(gotTargets) != 1 || gotTargets[0].SpotifyID != "spotify3" {
+			t.Errorf("output targets after rebuild are %+v, want only spotify3", gotTargets)
+		}
+		built, err = s.GetBuiltTracks(ctx, playlist.ID)
+		if err != nil {
+			t.Fatalf("GetBuiltTracks: %v", err)
+		}
+		if built == nil || built.SpotifyID != "spotify3" || !reflect.DeepEqual(built.Tracks, []string{"track4"}) {
+			t.Errorf("built tracks after rebuild are %+v", built)
+		}
+
+		if err := s.UpdatePlaylistGoodBuild(ctx, playlist.ID, nil, nil, store.ManualEdits{}); err == nil {
+			t.Error("UpdatePlaylistGoodBuild accepted a build without targets")
+		}
+	})
+}
+
+func TestUpdatePlaylistGoodBuildSavesEdits(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store) {
+		ctx := context.Background()
+		sources := []store.TrackSource{{Name: "Liked Songs", ID: "liked", Type: store.LikedSrc, Count: 20, Method: store.Latest}}
+		playlist := createPlaylist(t, s, sources)
+		targets := []store.OutputTarget{{Name: "Morning Mix", SpotifyID: "spotify1"}}
+
+		// The user pins a track and changes the sources while a build is running
+		updated := playlist
+		updated.Input.Pinned = []store.PinnedTrack{{ID: "pinned1", Name: "Pinned One"}, {ID: "pinned2", Name: "Pinned Two"}}
+		updated.Input.TrackSources = append(sources, store.TrackSource{Name: "Some Album", ID: "album1", Type: store.AlbumSrc, Count: 5, Method: store.Randomly})
+		if err := s.UpdatePlaylistConfig(ctx, playlist.ID, updated); err != nil {
+			t.Fatalf("UpdatePlaylistConfig: %v", err)
+		}
+		if err := s.AddExcludedTracks(ctx, playlist.ID, []string{"track1", "track2"}); err != nil {
+			t.Fatalf("AddExcludedTracks: %v", err)
+		}
+
+		edits := store.ManualEdits{
+			Added:     2,
+			Removed:   2,
+			Exclude:   []string{"track3", "pinned1"},
+			Unexclude: []string{"track1"},
+			Unpin:     []string{"pinned1"},
+			Pin:       []store.PinnedTrack{{ID: "track4", Name: "Track Four"}},
+		}
+		if err := s.UpdatePlaylistGoodBuild(ctx, playlist.ID, targets, []string{"track4"}, edits); err != nil {
+			t.Fatalf("UpdatePlaylistGoodBuild: %v", err)
+		}
+
+		excluded, err := s.GetExcludedTracks(ctx, playlist.ID)
+		if err != nil {
+			t.Fatalf("GetExcludedTracks: %v", err)
+		}
+		sort.Strings(excluded)
+		if want := []string{"pinned1", "track2", "track3"}; !reflect.DeepEqual(excluded, want) {
+			t.Errorf("excluded tracks are %v, want %v", excluded, want)
+		}
+
+		got, err := s.GetPlaylist(ctx, playlist.ID)
+		if err != nil {
+			t.Fatalf("GetPlaylist: %v", err)
+		}
+		wantPins := []store.PinnedTrack{{ID: "pinned2", Name: "Pinned Two"}, {ID: "track4", Name: "Track Four"}}
+		if !reflect.DeepEqual(got.Input.Pinned, wantPins) {
+			t.Errorf("pins are %+v, want %+v", got.Input.Pinned, wantPins)
+		}
+		if !reflect.DeepEqual(got.Input.TrackSources, updated.Input.TrackSources) {
+			t.Errorf("saving the build's edits changed the sources to %+v", got.Input.TrackSources)
+		}
+	})
+}
+
+func TestTrackSourcesRoundTrip(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store) {
+		ctx := context.Background()
+		sources := []store.TrackSource{
+			{Name: "Liked Songs", ID: "liked", Type: store.LikedSrc, Count: 20, Method: store.Latest},
+			{
+				Name:   "Discover Weekly",
+				ID:     "playlist1",
+				Type:   store.PlaylistSrc,
+				Count:  10,
+				Method: store.Randomly,
+				Filters: []store.SourceFilter{
+					{Op: store.Subtract, Name: "Liked Songs", ID: "liked", Type: store.LikedSrc},
+					{Op: store.Intersect, Name: "Some Album", ID: "album1", Type: store.AlbumSrc},
+					{Op: store.Any, Children: []store.SourceFilter{
+						{Op: store.Intersect, Name: "Road Trip", ID: "playlist2", Type: store.PlaylistSrc},
+						{Op: store.All, Children: []store.SourceFilter{
+							{Op: store.Subtract, Name: "Other Album", ID: "album2", Type: store.AlbumSrc},
+							{Op: store.Intersect, Name: "Liked Songs", ID: "liked", Type: store.LikedSrc},
+						}},
+					}},
+				},
+			},
+		}
+		playlist := createPlaylist(t, s, sources)
+		got, err := s.GetPlaylist(ctx, playlist.ID)
+		if err != nil {
+			t.Fatalf("GetPlaylist: %v", err)
+		}
+		if !reflect.DeepEqual(got.Input.TrackSources, sources) {
+			t.Errorf("track sources are\n%+v\nwant\n%+v", got.Input.TrackSources, sources)
+		}
+
+		// Updating the config replaces the sources and their filters
+		updated := got
+		updated.Input.TrackSources = []store.TrackSource{
+			{Name: "Some Album", ID: "album1", Type: store.AlbumSrc, Count: 5, Method: store.Randomly},
+			sources[1],
+		}
+		updated.Input.TrackSources[1].Filters = sources[1].Filters[2:]
+		if err := s.UpdatePlaylistConfig(ctx, playlist.ID, *updated); err != nil {
+			t.Fatalf("UpdatePlaylistConfig: %v", err)
+		}
+		got, err = s.GetPlaylist(ctx, playlist.ID)
+		if err != nil {
+			t.Fatalf("GetPlaylist: %v", err)
+		}
+		if !reflect.DeepEqual(got.Input.TrackSources, updated.Input.TrackSources) {
+			t.Errorf("updated track sources are\n%+v\nwant\n%+v", got.Input.TrackSources, updated.Input.TrackSources)
+		}
+
+		// Playlists listed together each get their own sources back
+		other := createPlaylist(t, s, sources[:1])
+		playlists, err := s.GetPlaylists(ctx, other.UserID)
+		if err != nil {
+			t.Fatalf("GetPlaylists: %v", err)
+		}
+		if !reflect.DeepEqual(playlists[0].Input.TrackSources, sources[:1]) {
+			t.Errorf("listed track sources are %+v, want %+v", playlists[0].Input.TrackSources, sources[:1])
+		}
+	})
+}
+
+func TestSourceTracksCache(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store) {
+		ctx := context.Background()
+		// Postgres databases are reused between runs so each run caches its own source
+		sourceID := uuid.New().String()
+		cached, err := s.GetSourceTracks(ctx, sourceID)
+		if err != nil {
+			t.Fatalf("GetSourceTracks: %v", err)
+		}
+		if cached != nil {
+			t.Fatalf("found %+v before anything was cached", cached)
+		}
+
+		for _, snapshot := range []struct {
+			id     string
+			tracks []string
+		}{
+			{"snapshot1", []string{"track1", "", "track2"}},
+			{"snapshot2", []string{"track3"}},
+		} {
+			if err := s.PutSourceTracks(ctx, sourceID, snapshot.id, snapshot.tracks); err != nil {
+				t.Fatalf("PutSourceTracks: %v", err)
+			}
+			cached, err = s.GetSourceTracks(ctx, sourceID)
+			if err != nil {
+				t.Fatalf("GetSourceTracks: %v", err)
+			}
+			if cached == nil || cached.SnapshotID != snapshot.id || !reflect.DeepEqual(cached.Tracks, snapshot.tracks) {
+				t.Errorf("cached %+v, want %v at %s", cached, snapshot.tracks, snapshot.id)
+			}
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"time"
@@ -24,10 +25,24 @@ type User struct {
 	TokenType    string    `db:"token_type"`
 	TokenExpiry  time.Time `db:"token_expiry"`
 
+	Email          *string        `db:"email"`
+	NotifyOn       NotifyOn       `db:"notify_on"`
+	NotifyDelivery NotifyDelivery `db:"notify_delivery"`
+	LastDigestAt   *time.Time     `db:"last_digest_at"`
+	Timezone       string         `db:"timezone"`
+
 	CreatedAt time.Time `db:"created_at"`
 	UpdatedAt time.Time `db:"updated_at"`
 }
 
+// UserSettings are the preferences a user can change from the settings page
+type UserSettings struct {
+	Email          *string
+	NotifyOn       NotifyOn
+	NotifyDelivery NotifyDelivery
+	Timezone       string
+}
+
 // MarshalToken unpacks the Token field into the token db mapping fields
 func (u *User) MarshalToken() {
 	u.AccessToken = u.Token.AccessToken
@@ -36,6 +51,15 @@ func (u *User) MarshalToken() {
 	u.TokenExpiry = u.Token.Expiry
 }
 
+// Location returns the user's timezone, falling back to UTC if it can't be loaded
+func (u *User) Location() *time.Location {
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
 // UnmarshalToken packs the token db mapping fields into the Token field
 func (u *User) UnmarshalToken() {
 	u.Token = oauth2.Token{
@@ -47,14 +71,14 @@ func (u *User) UnmarshalToken() {
 }
 
 // GetUserByID returns a User matching the given id
-func (p *Postgres) GetUserByID(id uuid.UUID) (*User, error) {
+func (p *Postgres) GetUserByID(ctx context.Context, id uuid.UUID) (*User, error) {
 	var user User
 	query := `
 SELECT *
 FROM users
 WHERE id=$1;	
 `
-	err := p.db.Get(&user, query, id)
+	err := p.db.GetContext(ctx, &user, query, id)
 	if err != nil {
 		return nil, err
 	}
@@ -63,19 +87,19 @@ WHERE id=$1;
 }
 
 // GetUserBySpotifyID returns a User matching the given spotifyID
-func (p *Postgres) GetUserBySpotifyID(spotifyID string) (*User, error) {
+func (p *Postgres) GetUserBySpotifyID(ctx context.Context, spotifyID string) (*User, error) {
 	return nil, errors.New("not implemented")
 }
 
 // GetUserID returns the UUID for a user based off of a session token
-func (p *Postgres) GetUserID(sessionToken string) (*uuid.UUID, error) {
+func (p *Postgres) GetUserID(ctx context.Context, sessionToken string) (*uuid.UUID, error) {
 	var id uuid.UUID
 	query := `
 SELECT id
 FROM users
 WHERE session_token=$1;
 `
-	err := p.db.Get(&id, query, sessionToken)
+	err := p.db.GetContext(ctx, &id, query, sessionToken)
 	if err != nil {
 		return nil, err
 	}
@@ -83,7 +107,7 @@ WHERE session_token=$1;
 }
 
 // UserExists determines if there is a user for the give spotifyID already
-func (p *Postgres) UserExists(spotifyID string) (bool, error) {
+func (p *Postgres) UserExists(ctx context.Context, spotifyID string) (bool, error) {
 	var exists bool
 	query := `
 SELECT exists (
@@ -92,7 +116,7 @@ SELECT exists (
 	WHERE spotify_id=$1
 );
 `
-	err := p.db.QueryRow(query, spotifyID).Scan(&exists)
+	err := p.db.QueryRowContext(ctx, query, spotifyID).Scan(&exists)
 	if err != nil && err != sql.ErrNoRows {
 		return false, err
 	}
@@ -100,14 +124,14 @@ SELECT exists (
 }
 
 // GetSessionExpiry returns the expiry time of a sessionToken
-func (p *Postgres) GetSessionExpiry(sessionToken string) (*time.Time, error) {
+func (p *Postgres) GetSessionExpiry(ctx context.Context, sessionToken string) (*time.Time, error) {
 	query := `
 SELECT session_expiry
 FROM users
 WHERE session_token=$1;
 `
 	var sessionExpiry time.Time
-	err := p.db.Get(&sessionExpiry, query, sessionToken)
+	err := p.db.GetContext(ctx, &sessionExpiry, query, sessionToken)
 	if err != nil {
 		return nil, err
 	}
@@ -115,7 +139,7 @@ WHERE session_token=$1;
 }
 
 // CreateUser creates a new user row in the DB
-func (p *Postgres) CreateUser(spotifyID, sessionToken string, sessionExpiry time.Time, token oauth2.Token) error {
+func (p *Postgres) CreateUser(ctx context.Context, spotifyID, sessionToken string, sessionExpiry time.Time, token oauth2.Token) error {
 	query := `
 INSERT INTO users (
 	spotify_id,
@@ -130,7 +154,7 @@ INSERT INTO users (
 VALUES 
 	($1, $2, $3, $4, $5, $6, $7, $8);
 `
-	_, err := p.db.Exec(
+	_, err := p.db.ExecContext(ctx,
 		query,
 		spotifyID,
 		0,
@@ -148,7 +172,7 @@ VALUES
 }
 
 // UpdateUser updates an existing user with new sesion and oauth2 token data
-func (p *Postgres) UpdateUser(spotifyID, sessionToken string, sessionExpiry time.Time, token oauth2.Token) error {
+func (p *Postgres) UpdateUser(ctx context.Context, spotifyID, sessionToken string, sessionExpiry time.Time, token oauth2.Token) error {
 	query := `
 UPDATE users SET
 	session_token=$1,
@@ -160,7 +184,7 @@ UPDATE users SET
 WHERE
 	spotify_id=$7;
 `
-	_, err := p.db.Exec(
+	_, err := p.db.ExecContext(ctx,
 		query,
 		sessionToken,
 		sessionExpiry,
@@ -177,13 +201,30 @@ WHERE
 }
 
 // IncrementUserBuildCount increments playlists_built by one for the given userID
-func (p *Postgres) IncrementUserBuildCount(userID uuid.UUID) error {
+func (p *Postgres) IncrementUserBuildCount(ctx context.Context, userID uuid.UUID) error {
 	query := `
 UPDATE users SET
 	playlists_built=playlists_built+1
 WHERE id=$1;
 `
-	_, err := p.db.Exec(query, userID)
+	_, err := p.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateUserSettings saves the preferences a user changes from the settings page
+func (p *Postgres) UpdateUserSettings(ctx context.Context, userID uuid.UUID, settings UserSettings) error {
+	query := `
+UPDATE users SET
+	email=$1,
+	notify_on=$2,
+	notify_delivery=$3,
+	timezone=$4
+WHERE id=$5;
+`
+	_, err := p.db.ExecContext(ctx, query, settings.Email, settings.NotifyOn, settings.NotifyDelivery, settings.Timezone, userID)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,190 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// webhookMaxAttempts is how many times a webhook delivery is tried before giving up
+const webhookMaxAttempts = 6
+
+// Webhook is an endpoint a user wants build results sent to
+type Webhook struct {
+	ID     uuid.UUID `db:"id"`
+	UserID uuid.UUID `db:"user_id"`
+	URL    string    `db:"url"`
+	Secret string    `db:"secret"`
+
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// WebhookDelivery is a single payload sent, or to be sent, to a webhook
+type WebhookDelivery struct {
+	ID        uuid.UUID `db:"id"`
+	WebhookID uuid.UUID `db:"webhook_id"`
+	Event     string    `db:"event"`
+	Payload   string    `db:"payload"`
+
+	Status       DeliveryStatus `db:"status"`
+	Attempts     int            `db:"attempts"`
+	ResponseCode *int           `db:"response_code"`
+	LastError    *string        `db:"last_error"`
+	DeliveredAt  *time.Time     `db:"delivered_at"`
+
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+
+	URL string `db:"url"` // Joined from the webhook for display
+}
+
+// CreateWebhook inserts a new webhook endpoint for a user
+func (p *Postgres) CreateWebhook(ctx context.Context, userID uuid.UUID, url, secret string) error {
+	query := `
+INSERT INTO webhooks (
+	user_id,
+	url,
+	secret
+)
+VALUES (
+	$1,
+	$2,
+	$3
+);
+`
+	_, err := p.db.ExecContext(ctx, query, userID, url, secret)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetWebhook returns a single webhook
+func (p *Postgres) GetWebhook(ctx context.Context, id uuid.UUID) (*Webhook, error) {
+	var webhook Webhook
+	query := `
+SELECT *
+FROM webhooks
+WHERE id=$1;
+`
+	err := p.db.GetContext(ctx, &webhook, query, id)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// GetWebhooks returns all of a user's webhooks
+func (p *Postgres) GetWebhooks(ctx context.Context, userID uuid.UUID) ([]Webhook, error) {
+	var webhooks []Webhook
+	query := `
+SELECT *
+FROM webhooks
+WHERE user_id=$1
+ORDER BY created_at;
+`
+	err := p.db.SelectContext(ctx, &webhooks, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes one of a user's webhooks along with its delivery log
+func (p *Postgres) DeleteWebhook(ctx context.Context, userID, id uuid.UUID) error {
+	query := `
+DELETE FROM webhooks
+WHERE id=$1 AND user_id=$2;
+`
+	_, err := p.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// QueueWebhookDeliveries records a delivery of payload to each of a user's webhooks
+// and enqueues a job to send each one
+func (p *Postgres) QueueWebhookDeliveries(ctx context.Context, userID, playlistID uuid.UUID, event, payload string) error {
+	query := `
+WITH deliveries AS (
+	INSERT INTO webhook_deliveries (
+		webhook_id,
+		event,
+		payload
+	)
+	SELECT id, $3, $4
+	FROM webhooks
+	WHERE user_id=$1
+	RETURNING id
+)
+INSERT INTO jobs (
+	kind,
+	user_id,
+	playlist_id,
+	delivery_id,
+	max_attempts
+)
+SELECT $5, $1, $2, id, $6
+FROM deliveries;
+`
+	_, err := p.db.ExecContext(ctx, query, userID, playlistID, event, payload, WebhookJob, webhookMaxAttempts)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetWebhookDelivery returns a single webhook delivery
+func (p *Postgres) GetWebhookDelivery(ctx context.Context, id uuid.UUID) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	query := `
+SELECT d.*, w.url
+FROM webhook_deliveries d
+JOIN webhooks w ON w.id=d.webhook_id
+WHERE d.id=$1;
+`
+	err := p.db.GetContext(ctx, &delivery, query, id)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// GetWebhookDeliveries returns a user's most recent webhook deliveries, newest first
+func (p *Postgres) GetWebhookDeliveries(ctx context.Context, userID uuid.UUID, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	query := `
+SELECT d.*, w.url
+FROM webhook_deliveries d
+JOIN webhooks w ON w.id=d.webhook_id
+WHERE w.user_id=$1
+ORDER BY d.created_at DESC
+LIMIT $2;
+`
+	err := p.db.SelectContext(ctx, &deliveries, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// UpdateWebhookDeliveryAttempt records the outcome of an attempt to send a webhook delivery
+func (p *Postgres) UpdateWebhookDeliveryAttempt(ctx context.Context, id uuid.UUID, status DeliveryStatus, responseCode *int, lastError *string) error {
+	query := `
+UPDATE webhook_deliveries SET
+	status=$1,
+	attempts=attempts+1,
+	response_code=$2,
+	last_error=$3,
+	delivered_at=CASE WHEN $1='Delivered' THEN NOW() ELSE NULL END
+WHERE id=$4;
+`
+	_, err := p.db.ExecContext(ctx, query, status, responseCode, lastError, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -18,8 +18,12 @@ type Templater interface {
 	TmplDashboard(w http.ResponseWriter, data Dashboard)
 	TmplPlaylist(w http.ResponseWriter, data Playlist)
 	TmplTrackSource(w http.ResponseWriter, data TrackSource)
+	TmplTrackSearch(w http.ResponseWriter, data TrackSearch)
+	TmplPinnedTrack(w http.ResponseWriter, data store.PinnedTrack)
 	TmplMobile(w http.ResponseWriter)
 	TmplHelp(w http.ResponseWriter)
+	TmplWebhooks(w http.ResponseWriter, data Webhooks)
+	TmplSettings(w http.ResponseWriter, data Settings)
 }
 
 // Home is the data required to template '/' and `/login`
@@ -43,6 +47,8 @@ type PlaylistInfo struct {
 	ScheduleSentence string
 	ImageURL         string
 	FailureBlurb     string
+	EditsSentence    string
+	Targets          []store.OutputTarget // Every spotify playlist a split playlist was built into
 }
 
 // Playlist is the data required to template '/playlist/{playlistID}'
@@ -54,7 +60,29 @@ type Playlist struct {
 	Description    string
 	DescriptionErr string
 	Schedule       store.Schedule
+	Cron           string
+	BuildTime      string
+	ScheduleErr    string
+	StartsOn       string
+	EndsOn         string
+	DatesErr       string
+	OutputMode     store.OutputMode
+	KeepBuilds     string
+	MaxSize        string
+	OutputErr      string
+	Split          store.SplitMode
+	SplitSize      string
+	SplitErr       string
 	Public         bool
+	AccessErr      string
+
+	Collaborative      bool
+	CollaboratorPolicy store.CollaboratorPolicy
+
+	EditPolicy    store.EditPolicy
+	ExcludedCount int // Tracks left out of builds because they were removed by hand
+	Pinned        []store.PinnedTrack
+	PinnedErr     string
 
 	Sources          []TrackSource
 	SourcesErr       string
@@ -76,6 +104,21 @@ type TrackSource struct {
 	store.TrackSource
 	CountString string
 	CountErr    string
+	FiltersErr  string
+}
+
+// TrackSearch is the data required to template '/playlist/{playlistID}/pin/search'
+type TrackSearch struct {
+	Query   string
+	Results []SearchedTrack
+}
+
+// SearchedTrack is a track found by searching Spotify
+type SearchedTrack struct {
+	ID       string
+	Name     string
+	Artists  string
+	ImageURL string
 }
 
 // Help is the data required to template '/help'
@@ -83,6 +126,32 @@ type Help struct {
 	Env string
 }
 
+// Webhooks is the data required to template '/webhooks'
+type Webhooks struct {
+	Webhooks   []store.Webhook
+	Deliveries []store.WebhookDelivery
+
+	URL    string
+	URLErr string
+
+	Env string
+}
+
+// Settings is the data required to template '/settings'
+type Settings struct {
+	Enabled bool
+	Saved   bool
+
+	Email          string
+	EmailErr       string
+	NotifyOn       store.NotifyOn
+	NotifyDelivery store.NotifyDelivery
+	Timezone       string
+	TimezoneErr    string
+
+	Env string
+}
+
 // Mobile is the data required to template '/mobile'
 type Mobile struct {
 	Env string
@@ -99,6 +168,7 @@ type TemplateService struct {
 func New(log *zap.SugaredLogger, env string) (*TemplateService, error) {
 	funcMap := template.FuncMap{
 		"unixTime": func() string { return fmt.Sprintf("%v", time.Now().Unix()) },
+		"inc":      func(i int) int { return i + 1 },
 		"dict": func(values ...interface{}) (map[string]interface{}, error) {
 			if len(values)%2 != 0 {
 				return nil, errors.New("invalid dict call")
@@ -155,6 +225,16 @@ func (t *TemplateService) TmplTrackSource(w http.ResponseWriter, data TrackSourc
 	t.renderTemplate(w, "track-source", data)
 }
 
+// TmplTrackSearch templates '/playlist/{playlistID}/pin/search'
+func (t *TemplateService) TmplTrackSearch(w http.ResponseWriter, data TrackSearch) {
+	t.renderTemplate(w, "track-search", data)
+}
+
+// TmplPinnedTrack templates '/playlist/{playlistID}/pin/id/{id}'
+func (t *TemplateService) TmplPinnedTrack(w http.ResponseWriter, data store.PinnedTrack) {
+	t.renderTemplate(w, "pinned-track", data)
+}
+
 // TmplMobile templates `/mobile`
 func (t *TemplateService) TmplMobile(w http.ResponseWriter) {
 	data := Mobile{}
@@ -169,6 +249,18 @@ func (t *TemplateService) TmplHelp(w http.ResponseWriter) {
 	t.renderTemplate(w, "help", data)
 }
 
+// TmplWebhooks templates `/webhooks`
+func (t *TemplateService) TmplWebhooks(w http.ResponseWriter, data Webhooks) {
+	data.Env = t.env
+	t.renderTemplate(w, "webhooks", data)
+}
+
+// TmplSettings templates `/settings`
+func (t *TemplateService) TmplSettings(w http.ResponseWriter, data Settings) {
+	data.Env = t.env
+	t.renderTemplate(w, "settings", data)
+}
+
 func (t *TemplateService) renderTemplate(w http.ResponseWriter, tmpl string, data interface{}) {
 	err := t.templates.ExecuteTemplate(w, tmpl+".gohtml", data)
 	if err != nil {
@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// ErrDisallowedAddress is returned for webhooks pointing at loopback, private or otherwise internal addresses
+var ErrDisallowedAddress = errors.New("webhook address is not publicly routable")
+
+// privateNets are the private IPv4 ranges of RFC 1918 and the IPv6 unique local range
+var privateNets = mustParseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7")
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
+
+// isPrivate reports whether ip is in one of privateNets
+func isPrivate(ip net.IP) bool {
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedIP reports whether deliveries may be sent to ip
+func allowedIP(ip net.IP) bool {
+	return !(ip.IsLoopback() ||
+		isPrivate(ip) ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified())
+}
+
+// CheckHost resolves host and returns ErrDisallowedAddress if any of its addresses
+// is internal. It is only a courtesy to users filling in the form, deliveries are
+// checked again when connecting since the host can resolve differently by then.
+func CheckHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !allowedIP(addr.IP) {
+			return ErrDisallowedAddress
+		}
+	}
+	return nil
+}
+
+// dialControl refuses connections to internal addresses. It runs after DNS resolution
+// for every address dialed so a host can't be rebound to an internal one after CheckHost.
+func dialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("dialed address %q is not an IP", host)
+	}
+	if !allowedIP(ip) {
+		return ErrDisallowedAddress
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package webhook
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAllowedIP(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34":      true,
+		"2606:2800:220:1::1": true,
+		"172.32.0.1":         true,
+		"127.0.0.1":          false,
+		"::1":                false,
+		"10.1.2.3":           false,
+		"172.16.0.1":         false,
+		"172.31.255.255":     false,
+		"192.168.1.1":        false,
+		"::ffff:192.168.1.1": false,
+		"fd00::1":            false,
+		"169.254.169.254":    false,
+		"fe80::1":            false,
+		"0.0.0.0":            false,
+		"::":                 false,
+		"224.0.0.1":          false,
+	} {
+		if got := allowedIP(net.ParseIP(addr)); got != want {
+			t.Errorf("allowedIP(%s) = %t, want %t", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+)
+
+// deliveryTimeout is how long an endpoint has to respond to a delivery
+const deliveryTimeout = 10 * time.Second
+
+const (
+	// SignatureHeader carries the hex encoded HMAC-SHA256 of the request body, keyed with the webhook secret
+	SignatureHeader = "X-Playlist-Rotator-Signature"
+	// EventHeader carries the type of event being delivered
+	EventHeader = "X-Playlist-Rotator-Event"
+	// DeliveryHeader carries the ID of the delivery so receivers can ignore retries they've already seen
+	DeliveryHeader = "X-Playlist-Rotator-Delivery"
+)
+
+const (
+	// BuildSucceeded is sent when a playlist build finishes successfully
+	BuildSucceeded = "build.succeeded"
+	// BuildFailed is sent when a playlist build fails
+	BuildFailed = "build.failed"
+	// BuildCancelled is sent when a playlist build is stopped before it finishes
+	BuildCancelled = "build.cancelled"
+)
+
+// Payload is the JSON body sent to webhooks when a build finishes
+type Payload struct {
+	Event      string    `json:"event"`
+	Trigger    string    `json:"trigger"`
+	Playlist   Playlist  `json:"playlist"`
+	SpotifyID  string    `json:"spotifyPlaylistId,omitempty"`
+	TrackCount int       `json:"trackCount"`
+	Sources    []Source  `json:"sources,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// Playlist identifies the playlist a payload is about
+type Playlist struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// Source is how many tracks a single track source contributed to a build
+type Source struct {
+	Name       string `json:"name"`
+	TrackCount int    `json:"trackCount"`
+}
+
+// Sign returns the signature of body for the given secret as sent in SignatureHeader
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliverer sends queued webhook deliveries
+type Deliverer struct {
+	store  store.Store
+	client *http.Client
+	log    *zap.SugaredLogger
+}
+
+// New returns a pointer to a new Deliverer
+func New(store store.Store, log *zap.SugaredLogger) *Deliverer {
+	return &Deliverer{
+		store:  store,
+		client: newClient(),
+		log:    log,
+	}
+}
+
+// newClient returns the client deliveries are sent with. It only connects to public
+// addresses and doesn't follow redirects, which could otherwise lead anywhere.
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   deliveryTimeout,
+		KeepAlive: 30 * time.Second,
+		Control:   dialControl,
+	}
+	return &http.Client{
+		Timeout: deliveryTimeout,
+		Transport: &http.Transport{
+			// No proxy since the dialer would then only check the proxy's address
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   deliveryTimeout,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Deliver sends a webhook delivery and records the outcome. An error is returned
+// if the endpoint didn't accept it so the caller can retry. final marks the last
+// attempt, after which a failed delivery is recorded as undeliverable.
+func (d *Deliverer) Deliver(ctx context.Context, deliveryID uuid.UUID, final bool) error {
+	delivery, err := d.store.GetWebhookDelivery(ctx, deliveryID)
+	if err != nil {
+		return err
+	}
+	webhook, err := d.store.GetWebhook(ctx, delivery.WebhookID)
+	if err != nil {
+		return err
+	}
+
+	responseCode, sendErr := d.send(ctx, webhook, delivery)
+
+	status := store.DeliveryStatus(store.Delivered)
+	var lastError *string
+	if sendErr != nil {
+		status = store.Retrying
+		if final {
+			status = store.Undeliverable
+		}
+		msg := sendErr.Error()
+		lastError = &msg
+	}
+
+	// Record on a fresh context so an interrupted attempt is still logged
+	err = d.store.UpdateWebhookDeliveryAttempt(context.Background(), deliveryID, status, responseCode, lastError)
+	if err != nil {
+		d.log.Errorw("failed to record webhook delivery attempt", "err", err.Error(), "deliveryID", deliveryID)
+	}
+	return sendErr
+}
+
+func (d *Deliverer) send(ctx context.Context, webhook *store.Webhook, delivery *store.WebhookDelivery) (*int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "playlist-rotator-webhooks")
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, body))
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID.String())
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	code := resp.StatusCode
+	if code < 200 || code >= 300 {
+		return &code, fmt.Errorf("endpoint responded with %d", code)
+	}
+	return &code, nil
+}
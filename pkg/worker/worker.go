@@ -0,0 +1,200 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/calebschoepp/playlist-rotator/pkg/build"
+	"github.com/calebschoepp/playlist-rotator/pkg/config"
+	"github.com/calebschoepp/playlist-rotator/pkg/store"
+	"github.com/calebschoepp/playlist-rotator/pkg/webhook"
+)
+
+// staleJobAfter is how long a job can go without a heartbeat before it is assumed its worker died
+const staleJobAfter = 30 * time.Minute
+
+// heartbeatInterval is how often a running job's lock is refreshed, well within staleJobAfter
+const heartbeatInterval = 5 * time.Minute
+
+// retryBackoff is how long to wait before the first retry of a failed job, doubling each attempt
+const retryBackoff = 30 * time.Second
+
+// Worker claims jobs from the durable job queue and runs them
+type Worker struct {
+	store     store.Store
+	builder   build.Builder
+	deliverer *webhook.Deliverer
+	log       *zap.SugaredLogger
+
+	concurrency   int
+	pollInterval  time.Duration
+	shutdownGrace time.Duration
+}
+
+// New returns a pointer to a new Worker
+func New(store store.Store, builder build.Builder, deliverer *webhook.Deliverer, log *zap.SugaredLogger, config *config.Config) *Worker {
+	return &Worker{
+		store:         store,
+		builder:       builder,
+		deliverer:     deliverer,
+		log:           log,
+		concurrency:   config.WorkerConcurrency,
+		pollInterval:  config.WorkerPollInterval,
+		shutdownGrace: config.ShutdownGrace,
+	}
+}
+
+// Run processes jobs until ctx is done. In-flight jobs are then given the
+// shutdown grace period to finish before they are cancelled and requeued.
+func (w *Worker) Run(ctx context.Context) {
+	w.log.Infow("starting worker", "concurrency", w.concurrency)
+
+	// Jobs run on their own context so a shutdown doesn't abandon them halfway
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx, jobCtx)
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	<-ctx.Done()
+	w.log.Infow("worker shutting down, waiting for in-flight jobs", "grace", w.shutdownGrace)
+	select {
+	case <-done:
+	case <-time.After(w.shutdownGrace):
+		w.log.Warn("in-flight jobs didn't finish in time, cancelling them")
+		cancelJobs()
+		<-done
+	}
+	w.log.Info("worker stopped")
+}
+
+func (w *Worker) loop(ctx, jobCtx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		job, err := w.store.ClaimJob(ctx, staleJobAfter)
+		if err != nil {
+			if ctx.Err() == nil {
+				w.log.Errorw("failed to claim job", "err", err.Error())
+			}
+			w.sleep(ctx)
+			continue
+		}
+		if job == nil {
+			// Nothing to do right now
+			w.sleep(ctx)
+			continue
+		}
+
+		w.process(jobCtx, job)
+	}
+}
+
+// sleep waits for the poll interval or until ctx is done
+func (w *Worker) sleep(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(w.pollInterval):
+	}
+}
+
+func (w *Worker) process(ctx context.Context, job *store.Job) {
+	w.log.Infow("running job", "jobID", job.ID, "kind", job.Kind, "playlistID", job.PlaylistID, "attempt", job.Attempts)
+
+	// Keep the job locked for as long as it runs, however long that is
+	stopHeartbeat := make(chan struct{})
+	go w.heartbeat(job.ID, stopHeartbeat)
+
+	var err error
+	switch job.Kind {
+	case store.BuildJob:
+		err = w.builder.BuildPlaylist(ctx, job.UserID, job.PlaylistID, build.ManualTrigger, job.Attempts >= job.MaxAttempts)
+	case store.DeleteJob:
+		err = w.builder.DeletePlaylist(ctx, job.UserID, job.PlaylistID)
+	case store.WebhookJob:
+		if job.DeliveryID == nil {
+			err = errors.New("webhook job is missing its delivery")
+			break
+		}
+		err = w.deliverer.Deliver(ctx, *job.DeliveryID, job.Attempts >= job.MaxAttempts)
+	default:
+		err = fmt.Errorf("unknown job kind: %v", job.Kind)
+	}
+
+	close(stopHeartbeat)
+
+	// Bookkeeping happens on a fresh context since ctx may be why the job stopped
+	recordCtx := context.Background()
+
+	if err == nil {
+		err = w.store.CompleteJob(recordCtx, job.ID)
+		if err != nil {
+			w.log.Errorw("failed to mark job as done", "err", err.Error(), "jobID", job.ID)
+		}
+		return
+	}
+
+	if ctx.Err() != nil {
+		// The worker is shutting down so put the job straight back for the next one
+		w.log.Warnw("job interrupted by shutdown and will be retried", "jobID", job.ID)
+		err = w.store.RetryJob(recordCtx, job.ID, err.Error(), time.Now())
+		if err != nil {
+			w.log.Errorw("failed to requeue job", "err", err.Error(), "jobID", job.ID)
+		}
+		return
+	}
+
+	if errors.Is(err, context.Canceled) || build.IsPermanent(err) || job.Attempts >= job.MaxAttempts {
+		// Either the user cancelled the job, retrying it can't help or it has no attempts left
+		w.log.Errorw("job failed for the last time", "err", err.Error(), "jobID", job.ID, "attempts", job.Attempts)
+		err = w.store.FailJob(recordCtx, job.ID, err.Error())
+		if err != nil {
+			w.log.Errorw("failed to mark job as failed", "err", err.Error(), "jobID", job.ID)
+		}
+		return
+	}
+
+	backoff := retryBackoff << uint(job.Attempts-1)
+	w.log.Warnw("job failed and will be retried", "err", err.Error(), "jobID", job.ID, "attempts", job.Attempts, "backoff", backoff)
+	err = w.store.RetryJob(recordCtx, job.ID, err.Error(), time.Now().Add(backoff))
+	if err != nil {
+		w.log.Errorw("failed to requeue job", "err", err.Error(), "jobID", job.ID)
+	}
+}
+
+// heartbeat refreshes a running job's lock every heartbeatInterval until stop is closed
+func (w *Worker) heartbeat(id uuid.UUID, stop <-chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := w.store.HeartbeatJob(context.Background(), id)
+			if err != nil {
+				w.log.Warnw("failed to refresh job lock", "err", err.Error(), "jobID", id)
+			}
+		}
+	}
+}
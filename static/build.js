@@ -9,10 +9,6 @@ function buildPlaylist(playlistID) {
   var buildTag = document.querySelector("#build-tag-" + playlistID);
   buildTag.setAttribute("src", "/static/building_pill.svg");
 
-  var refresh = document.querySelector("#refresh-" + playlistID);
-  refresh.classList.remove("hidden");
-  refresh.classList.add("block");
-
   var buildButton = document.querySelector("#build-button-" + playlistID);
   buildButton.classList.add("cursor-not-allowed");
   buildButton.classList.add("opacity-50");
@@ -20,6 +16,9 @@ function buildPlaylist(playlistID) {
   buildButton.classList.remove("btn-secondary-green");
   buildButton.textContent = "Building";
 
+  var cancelButton = document.querySelector("#cancel-button-" + playlistID);
+  cancelButton.classList.remove("hidden");
+
   var url = window.location.protocol + "//" + window.location.host;
   url = url + "/playlist/" + playlistID + "/build";
   const Http = new XMLHttpRequest();
@@ -36,6 +35,27 @@ function buildPlaylist(playlistID) {
   };
 }
 
+function cancelBuild(playlistID) {
+  var cancelButton = document.querySelector("#cancel-button-" + playlistID);
+  cancelButton.classList.add("cursor-not-allowed");
+  cancelButton.classList.add("opacity-50");
+  cancelButton.textContent = "Cancelling";
+
+  var url = window.location.protocol + "//" + window.location.host;
+  url = url + "/playlist/" + playlistID + "/cancel";
+  const Http = new XMLHttpRequest();
+  Http.open("POST", url);
+  Http.send();
+
+  Http.onreadystatechange = (e) => {
+    if (Http.readyState !== Http.DONE) {
+      return;
+    }
+    // The build stops within a few seconds so reload to show the previous state
+    setTimeout(() => location.reload(), 3000);
+  };
+}
+
 function deletePlaylist(playlistID, elemID) {
   var url = window.location.protocol + "//" + window.location.host;
   url = url + "/playlist/" + playlistID + "/delete";
@@ -54,3 +74,102 @@ function deletePlaylist(playlistID, elemID) {
     return;
   };
 }
+
+function listenForBuildEvents() {
+  if (!window.EventSource) {
+    return;
+  }
+  var source = new EventSource("/events");
+
+  source.addEventListener("started", (e) => {
+    var event = JSON.parse(e.data);
+    setBuildTag(event.playlistID, "building");
+    setFailure(event.playlistID, "");
+    setProgress(event.playlistID, "Starting build...");
+  });
+
+  source.addEventListener("source", (e) => {
+    var event = JSON.parse(e.data);
+    setProgress(
+      event.playlistID,
+      "Found " + event.count + " songs in " + event.source
+    );
+  });
+
+  source.addEventListener("tracks", (e) => {
+    var event = JSON.parse(e.data);
+    setProgress(
+      event.playlistID,
+      "Added " + event.count + " of " + event.total + " songs"
+    );
+  });
+
+  source.addEventListener("succeeded", (e) => {
+    var event = JSON.parse(e.data);
+    setBuildTag(event.playlistID, "built");
+    setProgress(event.playlistID, "");
+    if (event.imageURL) {
+      var cover = document.querySelector("#cover-" + event.playlistID);
+      cover.setAttribute("src", event.imageURL);
+    }
+    resetBuildButtons(event.playlistID);
+  });
+
+  source.addEventListener("failed", (e) => {
+    var event = JSON.parse(e.data);
+    setBuildTag(event.playlistID, "failed");
+    setProgress(event.playlistID, "");
+    setFailure(event.playlistID, event.message);
+    resetBuildButtons(event.playlistID);
+  });
+
+  source.addEventListener("retrying", (e) => {
+    // The build is queued to run again so it stays cancellable
+    var event = JSON.parse(e.data);
+    setProgress(event.playlistID, "Hit an error, trying again shortly: " + event.message);
+  });
+
+  source.addEventListener("cancelled", (e) => {
+    // The previous build is left in place so reload to show it
+    location.reload();
+  });
+}
+
+function setBuildTag(playlistID, pillName) {
+  var buildTag = document.querySelector("#build-tag-" + playlistID);
+  if (buildTag) {
+    buildTag.setAttribute("src", "/static/" + pillName + "_pill.svg");
+  }
+}
+
+function setProgress(playlistID, text) {
+  var progress = document.querySelector("#progress-" + playlistID);
+  if (progress) {
+    progress.textContent = text;
+  }
+}
+
+function setFailure(playlistID, text) {
+  var failure = document.querySelector("#failure-" + playlistID);
+  if (failure) {
+    failure.textContent = text;
+  }
+}
+
+function resetBuildButtons(playlistID) {
+  BUILDING[playlistID] = false;
+
+  var buildButton = document.querySelector("#build-button-" + playlistID);
+  if (buildButton) {
+    buildButton.classList.remove("cursor-not-allowed");
+    buildButton.classList.remove("opacity-50");
+    buildButton.classList.remove("btn-primary");
+    buildButton.classList.add("btn-secondary-green");
+    buildButton.textContent = "Build";
+  }
+
+  var cancelButton = document.querySelector("#cancel-button-" + playlistID);
+  if (cancelButton) {
+    cancelButton.classList.add("hidden");
+  }
+}
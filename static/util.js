@@ -34,6 +34,7 @@ function addNewSourceInput() {
     var inputID = "#source-input-holder";
     var inputHolder = document.querySelector(inputID);
     inputHolder.insertBefore(fragment, inputHolder.lastElementChild);
+    populateFilterSources();
   };
 }
 
@@ -65,3 +66,197 @@ function toggleFAQ(id) {
     chevron.src = "/static/chevron_up.svg";
   }
 }
+
+function toggleScheduleInputs(scheduleSelect) {
+  var cronInput = document.getElementById("cron-input");
+  var buildTimeInput = document.getElementById("build-time-input");
+  var dateInputs = document.getElementById("date-inputs");
+  cronInput.classList.toggle("hidden", scheduleSelect.value !== "Custom");
+  buildTimeInput.classList.toggle(
+    "hidden",
+    scheduleSelect.value === "Custom" || scheduleSelect.value === "Never"
+  );
+  dateInputs.classList.toggle("hidden", scheduleSelect.value === "Never");
+}
+
+function toggleOutputInputs(outputSelect) {
+  var keepBuildsInput = document.getElementById("keep-builds-input");
+  var maxSizeInput = document.getElementById("max-size-input");
+  keepBuildsInput.classList.toggle("hidden", outputSelect.value !== "Archive");
+  maxSizeInput.classList.toggle("hidden", outputSelect.value !== "Append");
+}
+
+function toggleSplitInputs(splitSelect) {
+  var splitSizeInput = document.getElementById("split-size-input");
+  splitSizeInput.classList.toggle("hidden", splitSelect.value !== "Size");
+}
+
+function toggleCollaboratorInputs(collaborativeCheckbox) {
+  var policyInput = document.getElementById("collaborator-policy-input");
+  policyInput.classList.toggle("hidden", !collaborativeCheckbox.checked);
+}
+
+function useBrowserTimezone() {
+  var timezoneInput = document.getElementById("timezone");
+  timezoneInput.value = Intl.DateTimeFormat().resolvedOptions().timeZone;
+}
+
+function playlistURL() {
+  return (
+    window.location.protocol +
+    "//" +
+    window.location.host +
+    window.location.pathname
+  );
+}
+
+function searchTracks() {
+  var query = document.getElementById("trackSearch").value.trim();
+  if (query === "") {
+    return;
+  }
+
+  const Http = new XMLHttpRequest();
+  Http.open("GET", playlistURL() + "/pin/search?q=" + encodeURIComponent(query));
+  Http.send();
+
+  Http.onreadystatechange = (e) => {
+    if (Http.readyState !== Http.DONE) {
+      return;
+    }
+    var results = document.getElementById("track-search-results");
+    results.innerHTML = Http.responseText;
+  };
+}
+
+function addPinnedTrack(id) {
+  // A track can only be pinned once
+  if (document.getElementById("PinnedTrack" + id) !== null) {
+    return;
+  }
+
+  const Http = new XMLHttpRequest();
+  Http.open("GET", playlistURL() + "/pin/id/" + encodeURIComponent(id));
+  Http.send();
+
+  Http.onreadystatechange = (e) => {
+    if (Http.readyState !== Http.DONE) {
+      return;
+    }
+    var fragment = createFragment(Http.responseText);
+    document.getElementById("pinned-track-holder").appendChild(fragment);
+    document.getElementById("track-search-results").innerHTML = "";
+  };
+}
+
+// Fill in the source choices of every filter input that doesn't have them yet,
+// copying them from the select used to add sources
+function populateFilterSources() {
+  var sourceOptions = document.getElementById("sourceOptions");
+  if (sourceOptions === null) {
+    return;
+  }
+  document.querySelectorAll("select.filter-source").forEach((select) => {
+    if (select.options.length > 0) {
+      return;
+    }
+    for (var i = 0; i < sourceOptions.options.length; i++) {
+      var source = sourceOptions.options[i];
+      var id = source.id;
+      if (id === "") {
+        id = "LIKEDID";
+      }
+      var option = document.createElement("option");
+      option.value = source.classList[0] + "::" + id + "::" + source.innerText;
+      option.innerText = source.innerText;
+      select.appendChild(option);
+    }
+  });
+}
+
+// Filters are submitted in the order they appear, each as its depth, operation,
+// type, ID and name joined by ::, so groups come before the filters inside them
+function filterInput(sourceID, depth, value) {
+  var input = document.createElement("input");
+  input.type = "hidden";
+  input.name = sourceID + "::filter";
+  input.value = depth + "::" + value;
+  return input;
+}
+
+function removeFilterButton(filter) {
+  var remove = document.createElement("span");
+  remove.className = "select-none ml-4 text-gray-500 hover:text-red-500 cursor-pointer";
+  remove.innerText = "Remove";
+  remove.onclick = () => filter.remove();
+  return remove;
+}
+
+// Add a filter to the group whose controls hold button
+function addSourceFilter(button, sourceID) {
+  var group = button.closest(".filter-group");
+  var controls = button.parentElement;
+  var op = controls.querySelector("select.filter-op");
+  var source = controls.querySelector("select.filter-source");
+  if (source.selectedIndex < 0) {
+    return;
+  }
+
+  var row = document.createElement("div");
+  row.className = "flex flex-row justify-start items-center text-sm text-gray-700 py-1";
+  var label = document.createElement("span");
+  label.innerText =
+    op.options[op.selectedIndex].innerText +
+    " " +
+    source.options[source.selectedIndex].innerText;
+  row.appendChild(filterInput(sourceID, group.dataset.depth, op.value + "::" + source.value));
+  row.appendChild(label);
+  row.appendChild(removeFilterButton(row));
+  group.querySelector(".source-filters").appendChild(row);
+}
+
+// Add a group to the group whose controls hold button. Inside an All group
+// tracks have to match any of the new group's filters and the other way around.
+function addFilterGroup(button, sourceID) {
+  var parent = button.closest(".filter-group");
+  var depth = Number(parent.dataset.depth);
+  var maxDepth = Number(parent.closest("[data-max-depth]").dataset.maxDepth);
+  var op = parent.dataset.op === "Any" ? "All" : "Any";
+
+  var filter = document.createElement("div");
+  filter.className = "text-sm text-gray-700 py-1";
+  filter.appendChild(filterInput(sourceID, depth, op + "::::::"));
+  var header = document.createElement("div");
+  header.className = "flex flex-row justify-start items-center";
+  var label = document.createElement("span");
+  label.innerText = op === "Any" ? "Any of" : "All of";
+  header.appendChild(label);
+  header.appendChild(removeFilterButton(filter));
+  filter.appendChild(header);
+
+  // The new group gets its own copy of the controls, without the button to
+  // add another group once groups can't be nested any deeper
+  var group = parent.cloneNode(false);
+  group.dataset.depth = depth + 1;
+  group.dataset.op = op;
+  var filters = document.createElement("div");
+  filters.className = "source-filters";
+  group.appendChild(filters);
+  var controls = button.parentElement.cloneNode(true);
+  controls.querySelectorAll("select").forEach((select) => (select.selectedIndex = 0));
+  var groupButton = controls.lastElementChild;
+  if (depth + 1 < maxDepth) {
+    groupButton.innerText = op === "Any" ? "All of…" : "Any of…";
+  } else {
+    groupButton.remove();
+  }
+  group.appendChild(controls);
+
+  var nested = document.createElement("div");
+  nested.className = "pl-6 border-l-2 border-gray-200";
+  nested.appendChild(group);
+  filter.appendChild(nested);
+  parent.querySelector(".source-filters").appendChild(filter);
+}
+
+document.addEventListener("DOMContentLoaded", populateFilterSources);